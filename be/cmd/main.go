@@ -1,35 +1,53 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
+	"io"
 	"net/http"
+	"net/url"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"sort"
 	"syscall"
 	"time"
 
 	"fmt"
 	"os"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/bot/analytics"
 	"github.com/shallowBunny/app/be/internal/bot/api"
+	"github.com/shallowBunny/app/be/internal/importer"
 	"github.com/shallowBunny/app/be/internal/infrastructure/config"
 	"github.com/shallowBunny/app/be/internal/infrastructure/logging"
+	"github.com/shallowBunny/app/be/internal/infrastructure/metrics"
 	"github.com/shallowBunny/app/be/internal/infrastructure/middleware"
 	dao "github.com/shallowBunny/app/be/internal/infrastructure/repository"
 	DaoDb "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoDb"
 	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+	DaoSqlite "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoSqlite"
+	"github.com/shallowBunny/app/be/internal/lint"
 	"github.com/shallowBunny/app/be/internal/utils"
 
+	"github.com/shallowBunny/app/be/internal/bot/matrix"
 	"github.com/shallowBunny/app/be/internal/bot/telegram"
+	"github.com/shallowBunny/app/be/internal/bot/transport"
 )
 
-func createServer(b *bot.Bot) *http.Server {
+// createServer creates the rest api, webhooks are the telegram webhook handlers by path,
+// reload reloads the config files of the festivals
+func createServer(b *bot.Bot, festivals []*bot.Bot, webhooks map[string]http.Handler, reload func() (string, error)) *http.Server {
 
 	r := gin.New()
 
@@ -50,16 +68,64 @@ func createServer(b *bot.Bot) *http.Server {
 	r.POST("/api", botHandler.TokenAuthMiddleware(), botHandler.Restart)
 	r.PUT("/api", botHandler.TokenAuthMiddleware(), botHandler.UpdateLineUp)
 	r.POST("/message", botHandler.TokenAuthMiddleware(), botHandler.Message)
+	r.GET("/api/calendar.ics", botHandler.GetCalendar)
+	r.GET("/api/mergerequests", botHandler.TokenAuthMiddleware(), botHandler.GetMergeRequests)
+	r.GET("/api/mergerequests/:id", botHandler.TokenAuthMiddleware(), botHandler.GetMergeRequest)
+	r.POST("/api/mergerequests/:id/:action", botHandler.TokenAuthMiddleware(), botHandler.DecideMergeRequest)
+	r.GET("/api/calendar/:room", botHandler.GetRoomCalendar)
+	r.GET("/api/stream", botHandler.Stream)
+	r.POST("/api/announce", botHandler.TokenAuthMiddleware(), botHandler.Announce)
+	r.GET("/api/stats", botHandler.TokenAuthMiddleware(), botHandler.GetStats)
+	r.GET("/api/push/key", botHandler.GetPushKey)
+	r.POST("/api/push/subscribe", botHandler.SubscribePush)
+	r.POST("/api/push/unsubscribe", botHandler.UnsubscribePush)
+
+	reloadHandler := api.NewReloadHandler(reload)
+	r.POST("/api/reload", botHandler.TokenAuthMiddleware(), reloadHandler.Reload)
+
+	if b.GetConfig().MetricsAddress == "" {
+		r.GET("/metrics", botHandler.TokenAuthMiddleware(), gin.WrapH(metrics.Handler()))
+	}
+
+	likesHandler := api.NewLikesHandler(b)
+	r.POST("/api/likes", likesHandler.PostLikes)
 
-	manifestHandler := api.NewManifestHandler(b.GetConfig())
+	manifestHandler := api.NewManifestHandler(b)
 	r.GET("/manifest", manifestHandler.GetManifest)
 	r.GET("/manifest.webmanifest", manifestHandler.GetManifest)
 
+	festivalsHandler := api.NewFestivalsHandler(festivals)
+	r.GET("/api/lineup/:festival", festivalsHandler.GetLineUp)
+	r.PUT("/api/lineup/:festival", festivalsHandler.TokenAuthMiddleware(), festivalsHandler.UpdateLineUp)
+	r.GET("/api/lineup/:festival/calendar.ics", festivalsHandler.GetCalendar)
+	r.GET("/api/lineup/:festival/calendar/:room", festivalsHandler.GetRoomCalendar)
+	r.GET("/api/lineup/:festival/stream", festivalsHandler.Stream)
+	r.GET("/api/lineup/:festival/stats", festivalsHandler.TokenAuthMiddleware(), festivalsHandler.GetStats)
+	r.GET("/api/lineup/:festival/mergerequests", festivalsHandler.TokenAuthMiddleware(), festivalsHandler.GetMergeRequests)
+	r.GET("/api/lineup/:festival/mergerequests/:id", festivalsHandler.TokenAuthMiddleware(), festivalsHandler.GetMergeRequest)
+	r.POST("/api/lineup/:festival/mergerequests/:id/:action", festivalsHandler.TokenAuthMiddleware(), festivalsHandler.DecideMergeRequest)
+	r.GET("/api/lineup/:festival/push/key", festivalsHandler.GetPushKey)
+	r.POST("/api/lineup/:festival/push/subscribe", festivalsHandler.SubscribePush)
+	r.POST("/api/lineup/:festival/push/unsubscribe", festivalsHandler.UnsubscribePush)
+	r.POST("/api/lineup/:festival/announce", festivalsHandler.TokenAuthMiddleware(), festivalsHandler.Announce)
+	r.POST("/api/lineup/:festival/likes", festivalsHandler.PostLikes)
+	r.GET("/api/lineup/:festival/manifest", festivalsHandler.GetManifest)
+
+	for path, h := range webhooks {
+		r.POST(path, gin.WrapH(h))
+	}
+
 	// Create an HTTP server using the Gin router
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", b.GetConfig().Port),
 		Handler: r, // Gin engine as the HTTP handler
 	}
+	// Shutdown waits for the requests in progress, the streams would never end
+	server.RegisterOnShutdown(func() {
+		for _, f := range festivals {
+			f.CloseStreams()
+		}
+	})
 	return server
 }
 
@@ -72,31 +138,396 @@ func runRestartScript(runRestartScriptArg string) (string, error) {
 	return string(output), nil
 }
 
+// runImport converts a csv/xlsx timetable and prints the lineup section of the config,
+// or sends it as a merge request to the running server (output "mr")
+func runImport(c *config.Config, fileName string, output string, columns string, server string) error {
+	mapping, err := importer.ParseMapping(columns)
+	if err != nil {
+		return err
+	}
+	lineup, err := importer.New(c.Lineup.Rooms, c.Lineup.BeginningSchedule, mapping).ImportFile(fileName)
+	if err != nil {
+		return err
+	}
+	switch output {
+	case "yaml":
+		out, err := importer.ToYaml(lineup)
+		if err != nil {
+			return err
+		}
+		fmt.Print(out)
+		return nil
+	case "mr":
+		if c.ServerToken == "" {
+			return fmt.Errorf("secrets.serverToken is needed to create a merge request")
+		}
+		if server == "" {
+			server = fmt.Sprintf("http://localhost:%d", c.Port)
+		}
+		body, err := json.Marshal(lineup)
+		if err != nil {
+			return err
+		}
+		// the route of every festival, the default one included
+		req, err := http.NewRequest(http.MethodPut, server+"/api/lineup/"+url.PathEscape(c.Meta.Prefix), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+c.ServerToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		answer, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%v: %s", resp.Status, answer)
+		}
+		fmt.Println(string(answer))
+		return nil
+	}
+	return fmt.Errorf("unknown import output <%v>, use yaml or mr", output)
+}
+
+// runCheck validates the config files and prints a report, it returns the exit code
+func runCheck(configFiles []string, format string) int {
+	reports := []lint.Report{}
+	lineups := []string{}
+	for _, f := range configFiles {
+		c, err := config.New(f, true)
+		if err != nil {
+			reports = append(reports, lint.ConfigError(f, err))
+			continue
+		}
+		report := lint.Check(f, c)
+		reports = append(reports, report)
+		if !report.HasErrors() && format != "json" {
+			lineups = append(lineups, bot.New(DaoMem.New(), c).PrintLineupForCheckConfig())
+		}
+	}
+
+	exitCode := 0
+	for _, r := range reports {
+		if r.HasErrors() {
+			exitCode = 1
+		}
+	}
+
+	switch format {
+	case "json":
+		out, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(out))
+	default:
+		for _, r := range reports {
+			fmt.Print(r.String())
+		}
+		for _, v := range lineups {
+			fmt.Println(v)
+		}
+	}
+	return exitCode
+}
+
+type festival struct {
+	configFile    string
+	config        *config.Config
+	telegramToken string
+	dao           dao.Dao
+	bot           *bot.Bot
+}
+
+// sqliteFile is the database of every festival for the sqlite storage
+const sqliteFile = "shallowbunny.db"
+
+// daoSeed returns what the namespace of the keys of a festival is derived from
+func daoSeed(f *festival, isDefault bool) string {
+	if f.telegramToken == "" && !isDefault {
+		// festivals without telegram bot must not share the redis namespace of the default one
+		return "prefix-" + f.config.Meta.Prefix
+	}
+	return f.telegramToken
+}
+
+// newDao returns the storage of a festival, the backend is the one of the default festival
+func newDao(c *config.Config, f *festival, isDefault bool, redisclient *redis.Client, db *sql.DB) (dao.Dao, error) {
+	switch c.Storage {
+	case config.StorageMemory:
+		return DaoMem.New(), nil
+	case config.StorageFile:
+		return DaoMem.NewFile(filepath.Join(c.DataDirectory, f.config.Meta.Prefix+".json"))
+	case config.StorageSqlite:
+		return DaoSqlite.New(daoSeed(f, isDefault), db), nil
+	}
+	return DaoDb.New(daoSeed(f, isDefault), redisclient), nil
+}
+
+// runMigrateRedis copies the redis keys of every festival into the sqlite database
+func runMigrateRedis(festivals []*festival) error {
+	c := festivals[0].config
+	if c.Storage != config.StorageSqlite {
+		return errors.New("--migrate-redis needs secrets.storage: sqlite")
+	}
+	db, err := DaoSqlite.Open(filepath.Join(c.DataDirectory, sqliteFile))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	redisclient := redis.NewClient(&redis.Options{Addr: c.RedisAddress})
+	defer redisclient.Close()
+	for i, f := range festivals {
+		d := DaoSqlite.New(daoSeed(f, i == 0), db)
+		n, err := DaoSqlite.MigrateRedis(redisclient, d)
+		if err != nil {
+			return fmt.Errorf("%v: %w", f.configFile, err)
+		}
+		fmt.Printf("%v: %d keys copied from redis namespace %v\n", f.configFile, n, d.GetKey())
+	}
+	return nil
+}
+
+// reloadFestival reads the config file of a festival again and reloads its bot, the admins
+// are told when it fails
+func reloadFestival(f *festival) (string, error) {
+	c, err := config.New(f.configFile, false)
+	if err == nil {
+		var res string
+		res, err = f.bot.Reload(c)
+		if err == nil {
+			log.Info().Msg(fmt.Sprintf("%v reloaded", f.configFile))
+			return res, nil
+		}
+	}
+	err = fmt.Errorf("%v: %w", f.configFile, err)
+	log.Error().Msg(err.Error())
+	f.bot.SendAdminsMessage("⚠️ Config not reloaded, " + err.Error())
+	return "", err
+}
+
+// reloadFestivals reloads every festival, it returns their reports and the first error
+func reloadFestivals(festivals []*festival) (string, error) {
+	res := ""
+	var firstErr error
+	for _, f := range festivals {
+		r, err := reloadFestival(f)
+		if err != nil {
+			r = err.Error()
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		res += f.configFile + ": " + r + "\n"
+	}
+	return res, firstErr
+}
+
+// configWatchDelay lets the editors finish writing a config file before reloading it
+const configWatchDelay = time.Second
+
+// watchConfigFiles reloads a festival when its config file changes. The directories are
+// watched as editors replace the files.
+func watchConfigFiles(festivals []*festival) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*festival)
+	for _, f := range festivals {
+		file, err := filepath.Abs(f.configFile)
+		if err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		files[file] = f
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	go func() {
+		timers := make(map[string]*time.Timer)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				f, found := files[event.Name]
+				if !found || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+					continue
+				}
+				if t, ok := timers[event.Name]; ok {
+					t.Reset(configWatchDelay)
+					continue
+				}
+				timers[event.Name] = time.AfterFunc(configWatchDelay, func() { reloadFestival(f) })
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error().Msg(err.Error())
+			}
+		}
+	}()
+	return watcher, nil
+}
+
+// registerMetrics registers the gauges of the festivals
+func registerMetrics(festivals []*festival) {
+	gauge := func(name, help string, value func(bot.ActivityStats) int) {
+		metrics.NewGaugeFunc(name, help, func(set func(float64, ...string)) {
+			for _, f := range festivals {
+				set(float64(value(f.bot.ActivityStats())), f.config.Meta.Prefix)
+			}
+		}, "festival")
+	}
+	gauge("shallowbunny_pending_merge_requests", "Merge requests waiting for a moderator.", func(s bot.ActivityStats) int { return s.PendingMergeRequests })
+	gauge("shallowbunny_inputs_in_progress", "Users in the middle of a wizard (input, edit, rebase...).", func(s bot.ActivityStats) int { return s.Inputs })
+	gauge("shallowbunny_notified_users", "Telegram and matrix users with the notifications on.", func(s bot.ActivityStats) int { return s.NotifiedUsers })
+	gauge("shallowbunny_stream_subscribers", "Open lineup streams.", func(s bot.ActivityStats) int { return s.StreamSubscribers })
+}
+
+// saveAnalytics saves the analytics of the festivals which changed
+func saveAnalytics(festivals []*festival) {
+	for _, f := range festivals {
+		if err := f.bot.SaveAnalytics(); err != nil {
+			log.Error().Msg(fmt.Sprintf("%v: saving analytics: %v", f.configFile, err))
+		}
+	}
+}
+
+// listConfigFiles returns the yaml files of a directory, sorted by name
+func listConfigFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(e.Name())
+		if ext == ".yml" || ext == ".yaml" {
+			res = append(res, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
 func main() {
 
-	configFileArg := flag.String("config", "", "use given config file")
-	checkConfig := flag.Bool("check", false, "check config")
+	configFileArg := flag.String("config", "", "use given config file (default festival)")
+	configDirArg := flag.String("configs", "", "also serve every config file (*.yml, *.yaml) of the given directory as /api/lineup/<prefix>")
+	checkConfig := flag.Bool("check", false, "check config files and report lineup errors and warnings, exits 1 on errors")
+	checkFormatArg := flag.String("check-format", "text", "output of --check: text or json")
 	restartScriptArg := flag.String("script", "", "restart script")
+	importArg := flag.String("import", "", "convert a csv or xlsx timetable using the rooms of --config")
+	importOutputArg := flag.String("import-output", "yaml", "output of --import: yaml (lineup section of the config) or mr (merge request on the running server)")
+	importColumnsArg := flag.String("import-columns", "", "column mapping for --import, e.g. \"Stage=room,Artist=dj,Soundcloud=link\"")
+	migrateRedisArg := flag.Bool("migrate-redis", false, "copy the redis keys of the festivals into the sqlite database of secrets.dataDirectory and exit")
+	importServerArg := flag.String("import-server", "", "server receiving the merge request of --import (default http://localhost:<port>)")
+	watchArg := flag.Bool("watch", false, "reload a festival when its config file changes")
+	replayArg := flag.Bool("replay", false, "play the festival of --config from its first set to its last one, print the notifications and /now, and exit")
+	replaySpeedArg := flag.Float64("replay-speed", 60, "speed of --replay, 60 plays a festival minute per second, 0 doesn't wait")
 
 	flag.Parse()
 
-	if *configFileArg == "" {
-		fmt.Println("Error: --config is a mandatory flag")
+	if *configFileArg == "" && *configDirArg == "" {
+		fmt.Println("Error: --config or --configs is a mandatory flag")
 		flag.Usage() // Display the usage information
 		os.Exit(1)   // Exit the program with a non-zero status
 	}
 
+	if *importArg != "" {
+		if *configFileArg == "" {
+			fmt.Println("Error: --import needs --config")
+			os.Exit(1)
+		}
+		c, err := config.New(*configFileArg, false)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if err := runImport(c, *importArg, *importOutputArg, *importColumnsArg, *importServerArg); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *replayArg {
+		if *configFileArg == "" {
+			fmt.Println("Error: --replay needs --config")
+			os.Exit(1)
+		}
+		c, err := config.New(*configFileArg, false)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		// nothing is saved, the festival keys are not touched
+		if err := bot.Replay(DaoMem.New(), c, *replaySpeedArg, os.Stdout); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	var restartScriptOutput string
 	var restartScriptError error
 	if *restartScriptArg != "" {
 		restartScriptOutput, restartScriptError = runRestartScript(*restartScriptArg)
 	}
 
-	config, err := config.New(*configFileArg, *checkConfig)
-	if err != nil {
-		panic(err)
+	configFiles := []string{}
+	if *configFileArg != "" {
+		configFiles = append(configFiles, *configFileArg)
+	}
+	if *configDirArg != "" {
+		files, err := listConfigFiles(*configDirArg)
+		if err != nil {
+			panic(err)
+		}
+		for _, f := range files {
+			if *configFileArg != "" && filepath.Clean(f) == filepath.Clean(*configFileArg) {
+				continue
+			}
+			configFiles = append(configFiles, f)
+		}
+	}
+	if len(configFiles) == 0 {
+		panic("no config file found in " + *configDirArg)
+	}
+
+	if *checkConfig {
+		os.Exit(runCheck(configFiles, *checkFormatArg))
+	}
+
+	festivals := []*festival{}
+	for _, f := range configFiles {
+		config, err := config.New(f, false)
+		if err != nil {
+			panic(fmt.Errorf("%v: %w", f, err))
+		}
+		festivals = append(festivals, &festival{configFile: f, config: config, telegramToken: config.TelegramToken})
+	}
+
+	if *migrateRedisArg {
+		if err := runMigrateRedis(festivals); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
 	}
 
+	// the first config is the default festival served on /api
+	config := festivals[0].config
+
 	// Initialize logging and get the file handles
 	logFile := logging.InitLogging(config.LogFile)
 	if logFile != nil {
@@ -105,108 +536,226 @@ func main() {
 
 	log.Info().Msg("using config " + config.LogFile)
 
-	telegramToken := config.TelegramToken
-
 	if utils.IsLocalhostTesting() {
 		log.Debug().Msg("isLocalhostTesting is true: using env SHALLOWBUNNY_TELEGRAM_API_TOKEN and port 8082")
 		envToken := os.Getenv("SHALLOWBUNNY_TELEGRAM_API_TOKEN")
 		if envToken != "" {
-			telegramToken = envToken
+			festivals[0].telegramToken = envToken
 		}
 		config.Port = 8082
 	}
 
-	var dao dao.Dao
+	prefixes := make(map[string]string)
+	tokens := make(map[string]string)
+	for _, f := range festivals {
+		prefix := f.config.Meta.Prefix
+		if other, ok := prefixes[prefix]; ok {
+			panic(fmt.Sprintf("prefix <%v> used by %v and %v", prefix, other, f.configFile))
+		}
+		prefixes[prefix] = f.configFile
+		if f.telegramToken != "" {
+			if other, ok := tokens[f.telegramToken]; ok {
+				panic(fmt.Sprintf("same telegram token used by %v and %v", other, f.configFile))
+			}
+			tokens[f.telegramToken] = f.configFile
+		}
+	}
 
-	if *checkConfig {
-		dao = DaoMem.New()
-	} else {
-		redisclient := redis.NewClient(&redis.Options{
-			Addr:     "localhost:6379",
+	var redisclient *redis.Client
+	var db *sql.DB
+	var err error
+	switch config.Storage {
+	case "redis":
+		redisclient = redis.NewClient(&redis.Options{
+			Addr:     config.RedisAddress,
 			Password: "", // no password set
 			DB:       0,  // use default DB
 		})
-		dao = DaoDb.New(telegramToken, redisclient)
+	case "sqlite":
+		db, err = DaoSqlite.Open(filepath.Join(config.DataDirectory, sqliteFile))
+		if err != nil {
+			panic(err)
+		}
+		defer db.Close()
 	}
 
-	bot := bot.New(dao, config)
+	bots := []*bot.Bot{}
+	for i, f := range festivals {
+		f.dao, err = newDao(config, f, i == 0, redisclient, db)
+		if err != nil {
+			panic(fmt.Errorf("%v: %w", f.configFile, err))
+		}
+		if d, ok := f.dao.(*DaoMem.DaoMem); ok {
+			defer d.Close()
+		}
+		f.bot = bot.New(f.dao, f.config)
+		bots = append(bots, f.bot)
+	}
+	bot := festivals[0].bot
+
+	gin.SetMode(gin.ReleaseMode)
+
+	registerMetrics(festivals)
+	if config.MetricsAddress != "" {
+		log.Info().Msg("serving metrics on " + config.MetricsAddress)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer := &http.Server{Addr: config.MetricsAddress, Handler: mux}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal().Msg(err.Error())
+			}
+		}()
+		defer metricsServer.Close()
+	}
 
-	if *checkConfig {
-		log.Info().Msg("Checked config: OK")
-		log.Info().Msg(bot.PrintLineupForCheckConfig())
+	var server *http.Server
+	quitTransports := make(chan struct{})
+	startedTransports := []<-chan struct{}{}
+
+	festivalsTransports := make([][]transport.Transport, len(festivals))
+	webhooks := make(map[string]http.Handler)
+	for i, f := range festivals {
+		if f.telegramToken != "" {
+			log.Info().Msg("starting telegram bot for " + f.configFile)
+			t := telegram.New(f.telegramToken, f.config.TelegramDeleteLeftTheGroupMessages)
+			if f.config.TelegramWebhookURL != "" {
+				if config.Port == 0 {
+					panic(f.configFile + ": telegram webhook needs the rest api, set secrets.port")
+				}
+				u, _ := url.Parse(f.config.TelegramWebhookURL)
+				if _, ok := webhooks[u.Path]; ok {
+					panic(fmt.Sprintf("telegram webhook path <%v> used twice", u.Path))
+				}
+				t.UseWebhook(f.config.TelegramWebhookURL, f.config.TelegramWebhookSecret)
+				webhooks[u.Path] = t
+			}
+			festivalsTransports[i] = append(festivalsTransports[i], t)
+		} else {
+			log.Info().Msg("no telegram token for " + f.configFile + ". skipping telegram")
+		}
+		if f.config.MatrixHomeserver != "" {
+			log.Info().Msg("starting matrix bot " + f.config.MatrixUserID + " for " + f.configFile)
+			festivalsTransports[i] = append(festivalsTransports[i], matrix.New(f.config.MatrixHomeserver, f.config.MatrixUserID, f.config.MatrixAccessToken, f.dao, f.config.Lineup.BeginningSchedule))
+		}
+	}
 
+	if config.Port != 0 {
+		log.Info().Msg("starting rest api")
+		server = createServer(bot, bots, webhooks, func() (string, error) { return reloadFestivals(festivals) })
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal().Msg(err.Error())
+			}
+		}()
 	} else {
+		log.Info().Msg("skipping rest api")
+	}
 
-		gin.SetMode(gin.ReleaseMode)
-
-		var server *http.Server
-		quitTelegram := make(chan struct{})
-
-		if config.Port != 0 {
-			log.Info().Msg("starting rest api")
-			server = createServer(bot)
+	for i, f := range festivals {
+		if f.config.WebPushSubject != "" {
+			log.Info().Msg("sending web push notifications for " + f.configFile)
+			go f.bot.SendPushNotifications(quitTransports, nil)
+		}
+		transports := festivalsTransports[i]
+		if len(transports) == 0 {
+			// nobody would read the messages of the bot (i.e. sent by the rest api)
+			messages := f.bot.GetMessageChannel()
 			go func() {
-				if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-					log.Fatal().Msg(err.Error())
+				for msg := range messages {
+					log.Debug().Msg(fmt.Sprintf("no transport, dropped message to %v", msg.UserID))
 				}
 			}()
-		} else {
-			log.Info().Msg("skipping rest api")
+			if f.config.WebPushSubject != "" {
+				// the sets starting are only notified by web push
+				go f.bot.SendEvents(quitTransports)
+			}
+			continue
 		}
+		go func(f *festival) {
 
-		if telegramToken != "" {
-			log.Info().Msg("starting telegram bot")
-			telegram := telegram.New(telegramToken, bot)
-			go func() {
+			restartMsg := fmt.Sprintf("✅ Restarted using %v key: %v", f.configFile, f.dao.GetKey())
 
-				restartMsg := fmt.Sprintf("✅ Restarted using %v key: %v", *configFileArg, dao.GetKey())
+			if f.config.TelegramDeleteLeftTheGroupMessages {
+				restartMsg += "\n✅ TelegramDeleteLeftTheGroupMessages Activated"
+			}
+			if f.config.TelegramWebhookURL != "" {
+				restartMsg += "\n✅ Telegram webhook " + f.config.TelegramWebhookURL
+			}
 
-				if config.TelegramDeleteLeftTheGroupMessages {
-					restartMsg += "\n✅ TelegramDeleteLeftTheGroupMessages Activated"
-				}
+			if restartScriptError != nil {
+				restartMsg += "\n⚠️ " + restartScriptError.Error() + "\n"
+			} else {
+				restartMsg += "\n✅ "
+			}
+			if restartScriptOutput != "" {
+				restartMsg += restartScriptOutput
+			}
+			restartMsg += f.bot.GetSetsAndDurations()
+			f.bot.SendAdminsMessage(restartMsg)
+			f.bot.Log(0, restartMsg, "")
+		}(f)
+		go f.bot.SendEvents(quitTransports)
+		startedTransports = append(startedTransports, transport.Run(f.bot, transports, quitTransports))
+	}
 
-				if restartScriptError != nil {
-					restartMsg += "\n⚠️ " + restartScriptError.Error() + "\n"
-				} else {
-					restartMsg += "\n✅ "
-				}
-				if restartScriptOutput != "" {
-					restartMsg += restartScriptOutput
-				}
-				restartMsg += bot.RootLineUp.GetSetsAndDurations()
-				bot.SendAdminsMessage(restartMsg)
-				bot.Log(0, restartMsg, "")
-			}()
-			go telegram.Listen(quitTelegram)
-		} else {
-			log.Info().Msg("no telegram token. skipping telegram")
-		}
+	if len(startedTransports) != 0 || server != nil {
+		go func() {
+			for range time.Tick(analytics.SaveInterval) {
+				saveAnalytics(festivals)
+			}
+		}()
 
-		if telegramToken != "" || server != nil {
-			// Create a channel to listen for termination signals
-			quit := make(chan os.Signal, 1)
+		// Create a channel to listen for termination signals
+		quit := make(chan os.Signal, 1)
 
-			// Relay SIGINT, SIGTERM to the quit channel
-			signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		// Relay SIGINT, SIGTERM to the quit channel
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
-			// Block until we receive a signal
-			<-quit
+		// SIGHUP reloads the config files
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				log.Info().Msg("SIGHUP: reloading the config files")
+				reloadFestivals(festivals)
+			}
+		}()
 
-			if server != nil {
-				log.Info().Msg("Shutting down rest api...")
-				// Create a context with a timeout for graceful shutdown
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer cancel()
-				// Attempt a graceful shutdown
-				if err := server.Shutdown(ctx); err != nil {
-					log.Error().Msg(fmt.Sprintf("Rest api to shutdown:%v", err))
-				}
+		if *watchArg {
+			watcher, err := watchConfigFiles(festivals)
+			if err != nil {
+				panic(err)
 			}
+			defer watcher.Close()
+		}
 
-			if telegramToken != "" {
-				close(quitTelegram)
+		// Block until we receive a signal
+		<-quit
+
+		if server != nil {
+			log.Info().Msg("Shutting down rest api...")
+			// Create a context with a timeout for graceful shutdown
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			// Attempt a graceful shutdown
+			if err := server.Shutdown(ctx); err != nil {
+				log.Error().Msg(fmt.Sprintf("Rest api to shutdown:%v", err))
+			}
+		}
+
+		if len(startedTransports) != 0 {
+			close(quitTransports)
+			// let the transports clean up (i.e. delete the telegram webhook)
+			timeout := time.After(5 * time.Second)
+			for _, done := range startedTransports {
+				select {
+				case <-done:
+				case <-timeout:
+				}
 			}
 		}
-		log.Info().Msg("Server exiting")
+		saveAnalytics(festivals)
 	}
+	log.Info().Msg("Server exiting")
 }
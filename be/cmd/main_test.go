@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoSqlite "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoSqlite"
+)
+
+func TestFestivalsDao(t *testing.T) {
+	dir := t.TempDir()
+	db, err := DaoSqlite.Open(filepath.Join(dir, sqliteFile))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer db.Close()
+	c := &config.Config{Storage: config.StorageSqlite, DataDirectory: dir}
+
+	festivals := []*festival{
+		{telegramToken: "token", config: &config.Config{Meta: config.Meta{Prefix: "default"}}},
+		{telegramToken: "other token", config: &config.Config{Meta: config.Meta{Prefix: "telegram"}}},
+		{config: &config.Config{Meta: config.Meta{Prefix: "a"}}},
+		{config: &config.Config{Meta: config.Meta{Prefix: "b"}}},
+	}
+	startTime := time.Date(2024, 8, 15, 0, 0, 0, 0, time.UTC)
+	keys := make(map[string]string)
+	for i, f := range festivals {
+		d, err := newDao(c, f, i == 0, nil, db)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		f.dao = d
+		if other, ok := keys[d.GetKey()]; ok {
+			t.Fatalf("%v and %v share the namespace %v", other, f.config.Meta.Prefix, d.GetKey())
+		}
+		keys[d.GetKey()] = f.config.Meta.Prefix
+		if err := d.Save("bot", startTime, f.config.Meta.Prefix); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	for _, f := range festivals {
+		value, err := f.dao.Get("bot", startTime)
+		if err != nil || value != f.config.Meta.Prefix {
+			t.Fatalf("%v: expected its own value, got %v %v", f.config.Meta.Prefix, value, err)
+		}
+	}
+
+	// the default festival uses its telegram token even when empty, the others without token their prefix
+	if daoSeed(festivals[0], true) != "token" || daoSeed(&festival{config: festivals[2].config}, true) != "" || daoSeed(festivals[2], false) != "prefix-a" {
+		t.Fatalf("unexpected seeds")
+	}
+}
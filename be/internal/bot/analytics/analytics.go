@@ -0,0 +1,294 @@
+// Package analytics counts the daily and hourly unique users of a festival by channel, the new
+// and returning ones, the djs and rooms searched and the commands used. Everything is counted in
+// memory and saved by Save without ttl, so the history outlives the keys of the festival.
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dao "github.com/shallowBunny/app/be/internal/infrastructure/repository"
+)
+
+// channels of the users
+const (
+	API      = "api"
+	Telegram = "telegram"
+	Matrix   = "matrix"
+)
+
+const (
+	dayFormat = "2006-01-02"
+	maxTop    = 10 // names printed by Print, the json has them all
+	printDays = 7  // days printed by Print
+)
+
+// SaveInterval is the delay between two saves of the analytics
+var SaveInterval = time.Minute
+
+// Channel is the stats of a channel for a day
+type Channel struct {
+	Uniques   int     `json:"uniques"`
+	New       int     `json:"new"`       // never seen on a previous day
+	Returning int     `json:"returning"` // seen on a previous day
+	Hours     [24]int `json:"hours"`     // unique users by hour
+}
+
+// data is what is saved
+type data struct {
+	Days     map[string]map[string]*Channel // day -> channel -> stats
+	Seen     map[string]bool                // users seen before, by id
+	Djs      map[string]int
+	Rooms    map[string]int
+	Commands map[string]int
+	Today    string
+	Users    map[string]int // users seen today by id -> last hour seen
+}
+
+// Analytics is safe for concurrent use, it doesn't use the lock of the bot so the rest api
+// doesn't wait for the telegram commands
+type Analytics struct {
+	mu    sync.Mutex
+	dao   dao.Dao
+	data  data
+	dirty bool
+}
+
+func newData() data {
+	return data{
+		Days:     make(map[string]map[string]*Channel),
+		Seen:     make(map[string]bool),
+		Djs:      make(map[string]int),
+		Rooms:    make(map[string]int),
+		Commands: make(map[string]int),
+		Users:    make(map[string]int),
+	}
+}
+
+// New loads the analytics saved in dao
+func New(d dao.Dao) (*Analytics, error) {
+	a := &Analytics{dao: d, data: newData()}
+	s, err := d.GetAnalytics()
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			return a, nil
+		}
+		return a, err
+	}
+	if s == "" {
+		return a, nil
+	}
+	loaded := newData()
+	if err := json.Unmarshal([]byte(s), &loaded); err != nil {
+		return a, err
+	}
+	// a missing map in an older value stays empty
+	for _, m := range []*map[string]int{&loaded.Djs, &loaded.Rooms, &loaded.Commands, &loaded.Users} {
+		if *m == nil {
+			*m = make(map[string]int)
+		}
+	}
+	if loaded.Days == nil {
+		loaded.Days = make(map[string]map[string]*Channel)
+	}
+	if loaded.Seen == nil {
+		loaded.Seen = make(map[string]bool)
+	}
+	a.data = loaded
+	return a, nil
+}
+
+// userId hashes the user, the ips and chat ids are not kept
+func userId(channel, user string) string {
+	h := sha256.Sum256([]byte(channel + "\x00" + user))
+	return hex.EncodeToString(h[:8])
+}
+
+// Visit records a request of user (an ip, a chat id) on channel
+func (a *Analytics) Visit(channel, user string, now time.Time) {
+	id := userId(channel, user)
+	day := now.Format(dayFormat)
+	hour := now.Hour()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.data.Today != day {
+		a.data.Today = day
+		a.data.Users = make(map[string]int)
+	}
+	if a.data.Days[day] == nil {
+		a.data.Days[day] = make(map[string]*Channel)
+	}
+	c := a.data.Days[day][channel]
+	if c == nil {
+		c = &Channel{}
+		a.data.Days[day][channel] = c
+	}
+	last, ok := a.data.Users[id]
+	if ok && last == hour {
+		return
+	}
+	if !ok {
+		c.Uniques++
+		if a.data.Seen[id] {
+			c.Returning++
+		} else {
+			c.New++
+			a.data.Seen[id] = true
+		}
+	}
+	c.Hours[hour]++
+	a.data.Users[id] = hour
+	a.dirty = true
+}
+
+func (a *Analytics) inc(m map[string]int, name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m[name]++
+	a.dirty = true
+}
+
+// Dj records a search finding the dj
+func (a *Analytics) Dj(name string) {
+	a.inc(a.data.Djs, name)
+}
+
+// Room records a search finding the room
+func (a *Analytics) Room(name string) {
+	a.inc(a.data.Rooms, name)
+}
+
+// Command records a command, the callers must bound the names (see bot.commandLabel)
+func (a *Analytics) Command(name string) {
+	a.inc(a.data.Commands, name)
+}
+
+// Save saves the analytics if they changed since the last save
+func (a *Analytics) Save() error {
+	a.mu.Lock()
+	if !a.dirty {
+		a.mu.Unlock()
+		return nil
+	}
+	bytes, err := json.Marshal(a.data)
+	a.dirty = false
+	a.mu.Unlock()
+	if err != nil {
+		panic(err)
+	}
+	err = a.dao.SaveAnalytics(string(bytes))
+	if err != nil {
+		a.mu.Lock()
+		a.dirty = true
+		a.mu.Unlock()
+	}
+	return err
+}
+
+// Count is a name and how many times it was used
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Day is the stats of a day by channel
+type Day struct {
+	Day      string              `json:"day"`
+	Channels map[string]*Channel `json:"channels"`
+}
+
+// Report is returned by GET /api/stats, the days and the counts are sorted, the most used first
+type Report struct {
+	Users    int     `json:"users"` // unique users since the first day
+	Days     []Day   `json:"days"`
+	Djs      []Count `json:"djs"`
+	Rooms    []Count `json:"rooms"`
+	Commands []Count `json:"commands"`
+}
+
+func counts(m map[string]int) []Count {
+	res := make([]Count, 0, len(m))
+	for k, v := range m {
+		res = append(res, Count{Name: k, Count: v})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// Report returns a copy of the analytics
+func (a *Analytics) Report() Report {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	res := Report{
+		Users:    len(a.data.Seen),
+		Days:     []Day{},
+		Djs:      counts(a.data.Djs),
+		Rooms:    counts(a.data.Rooms),
+		Commands: counts(a.data.Commands),
+	}
+	for day, channels := range a.data.Days {
+		d := Day{Day: day, Channels: make(map[string]*Channel)}
+		for k, v := range channels {
+			c := *v
+			d.Channels[k] = &c
+		}
+		res.Days = append(res.Days, d)
+	}
+	sort.Slice(res.Days, func(i, j int) bool { return res.Days[i].Day < res.Days[j].Day })
+	return res
+}
+
+func printCounts(title string, c []Count) string {
+	if len(c) == 0 {
+		return ""
+	}
+	names := []string{}
+	for i, v := range c {
+		if i == maxTop {
+			break
+		}
+		names = append(names, fmt.Sprintf("%v (%d)", v.Name, v.Count))
+	}
+	return title + strings.Join(names, ", ") + "\n"
+}
+
+// Print returns the report of the last days for the /stats command
+func (r Report) Print() string {
+	res := fmt.Sprintf("📊 %d users\n", r.Users)
+	days := r.Days
+	if len(days) > printDays {
+		days = days[len(days)-printDays:]
+	}
+	for _, d := range days {
+		channels := []string{}
+		for _, name := range []string{API, Telegram, Matrix} {
+			c, ok := d.Channels[name]
+			if !ok {
+				continue
+			}
+			peak := 0
+			for h, v := range c.Hours {
+				if v > c.Hours[peak] {
+					peak = h
+				}
+			}
+			channels = append(channels, fmt.Sprintf("%v %d (%d new, peak %02dh %d)", name, c.Uniques, c.New, peak, c.Hours[peak]))
+		}
+		res += d.Day + ": " + strings.Join(channels, ", ") + "\n"
+	}
+	res += printCounts("🎧 ", r.Djs)
+	res += printCounts("🏠 ", r.Rooms)
+	res += printCounts("⌨️ ", r.Commands)
+	return res
+}
@@ -0,0 +1,62 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func TestAnalytics(t *testing.T) {
+	d := DaoMem.New()
+	a, err := New(d)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	day1 := time.Date(2024, 8, 15, 22, 10, 0, 0, time.UTC)
+	a.Visit(API, "1.2.3.4", day1)
+	a.Visit(API, "1.2.3.4", day1.Add(time.Minute))
+	a.Visit(API, "5.6.7.8", day1)
+	a.Visit(API, "1.2.3.4", day1.Add(time.Hour))
+	a.Visit(Telegram, "123", day1)
+	a.Dj("DJ FART")
+	a.Dj("DJ FART")
+	a.Dj("A")
+	a.Room("🍵")
+	a.Command("now")
+	if err := a.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the analytics are loaded after a restart
+	a, err = New(d)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	day2 := day1.Add(24 * time.Hour)
+	a.Visit(API, "1.2.3.4", day2)
+	a.Visit(API, "9.9.9.9", day2)
+
+	r := a.Report()
+	if r.Users != 4 || len(r.Days) != 2 || r.Days[0].Day != "2024-08-15" || r.Days[1].Day != "2024-08-16" {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	api := r.Days[0].Channels[API]
+	if api.Uniques != 2 || api.New != 2 || api.Returning != 0 || api.Hours[22] != 2 || api.Hours[23] != 1 {
+		t.Fatalf("unexpected first day %+v", api)
+	}
+	if c := r.Days[0].Channels[Telegram]; c.Uniques != 1 || c.New != 1 {
+		t.Fatalf("unexpected telegram %+v", c)
+	}
+	if c := r.Days[1].Channels[API]; c.Uniques != 2 || c.New != 1 || c.Returning != 1 || c.Hours[22] != 2 {
+		t.Fatalf("unexpected second day %+v", c)
+	}
+	if len(r.Djs) != 2 || r.Djs[0] != (Count{Name: "DJ FART", Count: 2}) || r.Rooms[0].Name != "🍵" || r.Commands[0].Name != "now" {
+		t.Fatalf("unexpected counts %+v %+v %+v", r.Djs, r.Rooms, r.Commands)
+	}
+	text := r.Print()
+	if !strings.Contains(text, "2024-08-16: api 2 (1 new, peak 22h 2)") || !strings.Contains(text, "DJ FART (2), A (1)") {
+		t.Fatalf("unexpected print\n%v", text)
+	}
+}
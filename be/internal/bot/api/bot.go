@@ -55,8 +55,8 @@ type Icon struct {
 func (b *BotHandler) GetLineUp(c *gin.Context) {
 	var response Response
 	ip := utils.GetClientIPByRequest(c.Request)
-	go b.Bot.StatsUsingUserIp(ip)
-	response.Sets = b.Bot.RootLineUp.Sets
+	b.Bot.StatsUsingUserIp(ip)
+	response.Sets = b.Bot.Sets()
 	response.Meta = b.Bot.GetConfig().Meta
 	response.Meta.Rooms = b.Bot.GetConfig().Lineup.Rooms
 	b.Bot.Log(0, c.Request.UserAgent(), ip)
@@ -75,6 +75,7 @@ func convertLineupToInputCommandResultSets(lineup config.Lineup) []inputs.InputC
 				Hour:     set.Hour,
 				Minute:   set.Minute,
 				Duration: set.Duration,
+				Meta:     set.Meta,
 			}
 			results = append(results, result)
 		}
@@ -109,19 +110,12 @@ func (b *BotHandler) UpdateLineUp(c *gin.Context) {
 
 	mr := bot.NewMergeRequest(lineup.BeginningSchedule, convertLineupToInputCommandResultSets(lineup), 0, "api", utils.GetClientIPByRequest(c.Request))
 
-	err := b.Bot.ChecForDuplicateMergeRequest(mr)
+	err := b.Bot.SubmitMergeRequest(mr)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, err = b.Bot.CheckMergeRequest(mr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	b.Bot.CreateMergeRequest(*mr)
-
 	// Respond to the client
 	c.JSON(http.StatusOK, gin.H{
 		"message": fmt.Sprintf("Created MR %v with changes", mr.ID),
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+const testToken = "token"
+
+func request(r *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// go test -race -run TestConcurrentApiAndBot ./internal/bot/api/
+func TestConcurrentApiAndBot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, err := config.New("../../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := time.Now()
+	c.Lineup.BeginningSchedule = time.Date(tt.Year()+1, 1, 1, 0, 0, 0, 0, tt.Location())
+	c.ServerToken = testToken
+
+	b := bot.New(DaoMem.New(), c)
+	go func() {
+		for range b.GetMessageChannel() {
+		}
+	}()
+	quit := make(chan struct{})
+	defer close(quit)
+	go b.SendEvents(quit)
+
+	h := NewBotHandler(b)
+	r := gin.New()
+	r.GET("/api", h.GetLineUp)
+	r.PUT("/api", h.TokenAuthMiddleware(), h.UpdateLineUp)
+	r.GET("/api/calendar.ics", h.GetCalendar)
+	r.GET("/api/calendar/:room", h.GetRoomCalendar)
+	r.GET("/api/mergerequests", h.TokenAuthMiddleware(), h.GetMergeRequests)
+	r.POST("/api/mergerequests/:id/:action", h.TokenAuthMiddleware(), h.DecideMergeRequest)
+
+	day := c.Lineup.BeginningSchedule.Format("Mon")
+	nb := 5
+	var wg sync.WaitGroup
+	// the admins reloading the config file, the root lineup is replaced
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 10; j++ {
+			if _, err := b.Reload(c); err != nil {
+				t.Errorf("Reload: %v", err)
+			}
+		}
+	}()
+	for i := 0; i < nb; i++ {
+		wg.Add(3)
+		// telegram users submitting merge requests
+		go func(i int) {
+			defer wg.Done()
+			user := int64(100 + i)
+			for _, text := range []string{inputs.InputCommand, "🍵", day, fmt.Sprintf("%d:00", 10+i), fmt.Sprintf("DJ T%d", i), "60", inputs.ValidateCommand,
+				inputs.MergeCommand, inputs.MergeSubmitCommand, "now", "🍵"} {
+				b.ProcessCommand(user, text, "test")
+				b.Log(user, text, "test")
+			}
+		}(i)
+		// pwa users reading the lineup
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if w := request(r, http.MethodGet, "/api", nil); w.Code != http.StatusOK {
+					t.Errorf("GET /api: %v", w.Code)
+				}
+				if w := request(r, http.MethodGet, "/api/calendar.ics", nil); w.Code != http.StatusOK {
+					t.Errorf("GET /api/calendar.ics: %v", w.Code)
+				}
+				if w := request(r, http.MethodGet, "/api/calendar/"+url.PathEscape("🍵")+".ics", nil); w.Code != http.StatusOK {
+					t.Errorf("GET /api/calendar/🍵.ics: %v", w.Code)
+				}
+			}
+		}()
+		// the api submitting and moderating merge requests
+		go func(i int) {
+			defer wg.Done()
+			lineup := config.Lineup{Sets: map[string][]config.Set{
+				"🔨": {{Day: 0, Hour: 10 + i, Duration: 60, Dj: fmt.Sprintf("DJ A%d", i)}},
+			}}
+			if w := request(r, http.MethodPut, "/api", lineup); w.Code != http.StatusOK {
+				t.Errorf("PUT /api: %v %v", w.Code, w.Body.String())
+			}
+			w := request(r, http.MethodGet, "/api/mergerequests", nil)
+			var mrs []MergeRequestResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &mrs); err != nil {
+				t.Errorf("GET /api/mergerequests: %v", err)
+				return
+			}
+			for _, mr := range mrs {
+				if mr.Status == "pending" {
+					// another goroutine may have decided it first
+					w := request(r, http.MethodPost, fmt.Sprintf("/api/mergerequests/%d/accept", mr.ID), nil)
+					if w.Code != http.StatusOK && w.Code != http.StatusConflict {
+						t.Errorf("accept #%d: %v %v", mr.ID, w.Code, w.Body.String())
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	ids := make(map[int]bool)
+	for _, mr := range b.GetMergeRequests() {
+		if ids[mr.ID] {
+			t.Errorf("duplicate merge request id %d", mr.ID)
+		}
+		ids[mr.ID] = true
+	}
+	if len(ids) != 2*nb {
+		t.Errorf("expected %d merge requests, got %d", 2*nb, len(ids))
+	}
+}
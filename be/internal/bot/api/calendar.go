@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot/calendar"
+)
+
+const (
+	calendarContentType = "text/calendar; charset=utf-8"
+	distanceMaxRoom     = 3
+)
+
+func (b *BotHandler) writeCalendar(c *gin.Context, room string) {
+	config := b.Bot.GetConfig()
+	ics, err := calendar.New(b.Bot.Sets(), config.Meta.Title, config.Meta.Prefix, config.Meta.TimeZone, room, time.Now())
+	if err != nil {
+		log.Error().Msg(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, calendarContentType, []byte(ics))
+}
+
+func (b *BotHandler) GetCalendar(c *gin.Context) {
+	b.writeCalendar(c, "")
+}
+
+func (b *BotHandler) GetRoomCalendar(c *gin.Context) {
+	name := strings.TrimSuffix(c.Param("room"), ".ics")
+	_, room := b.Bot.FindRoom(name, distanceMaxRoom)
+	if room == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown room " + name})
+		return
+	}
+	b.writeCalendar(c, room)
+}
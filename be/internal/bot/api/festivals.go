@@ -0,0 +1,183 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shallowBunny/app/be/internal/bot"
+)
+
+// FestivalsHandler routes /api/lineup/:festival (and friends) to the bot of the festival,
+// festivals are identified by their Meta.Prefix
+type FestivalsHandler struct {
+	bots      map[string]*BotHandler
+	manifests map[string]*ManifestHandler
+	likes     map[string]*LikesHandler
+}
+
+func NewFestivalsHandler(bots []*bot.Bot) *FestivalsHandler {
+	f := &FestivalsHandler{
+		bots:      make(map[string]*BotHandler),
+		manifests: make(map[string]*ManifestHandler),
+		likes:     make(map[string]*LikesHandler),
+	}
+	for _, b := range bots {
+		prefix := b.GetConfig().Meta.Prefix
+		f.bots[prefix] = NewBotHandler(b)
+		f.manifests[prefix] = NewManifestHandler(b)
+		f.likes[prefix] = NewLikesHandler(b)
+	}
+	return f
+}
+
+func festivalNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{"error": "Unknown festival " + c.Param("festival")})
+}
+
+func (f *FestivalsHandler) GetLineUp(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.GetLineUp(c)
+}
+
+func (f *FestivalsHandler) GetManifest(c *gin.Context) {
+	h, ok := f.manifests[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.GetManifest(c)
+}
+
+func (f *FestivalsHandler) PostLikes(c *gin.Context) {
+	h, ok := f.likes[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.PostLikes(c)
+}
+
+func (f *FestivalsHandler) GetCalendar(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.GetCalendar(c)
+}
+
+func (f *FestivalsHandler) GetRoomCalendar(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.GetRoomCalendar(c)
+}
+
+func (f *FestivalsHandler) Stream(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.Stream(c)
+}
+
+func (f *FestivalsHandler) GetPushKey(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.GetPushKey(c)
+}
+
+func (f *FestivalsHandler) SubscribePush(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.SubscribePush(c)
+}
+
+func (f *FestivalsHandler) UnsubscribePush(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.UnsubscribePush(c)
+}
+
+func (f *FestivalsHandler) GetStats(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.GetStats(c)
+}
+
+// TokenAuthMiddleware checks the secrets.serverToken of the festival
+func (f *FestivalsHandler) TokenAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h, ok := f.bots[c.Param("festival")]
+		if !ok {
+			festivalNotFound(c)
+			c.Abort()
+			return
+		}
+		h.TokenAuthMiddleware()(c)
+	}
+}
+
+func (f *FestivalsHandler) UpdateLineUp(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.UpdateLineUp(c)
+}
+
+func (f *FestivalsHandler) GetMergeRequests(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.GetMergeRequests(c)
+}
+
+func (f *FestivalsHandler) GetMergeRequest(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.GetMergeRequest(c)
+}
+
+func (f *FestivalsHandler) DecideMergeRequest(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.DecideMergeRequest(c)
+}
+
+func (f *FestivalsHandler) Announce(c *gin.Context) {
+	h, ok := f.bots[c.Param("festival")]
+	if !ok {
+		festivalNotFound(c)
+		return
+	}
+	h.Announce(c)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func TestFestivals(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bots := []*bot.Bot{}
+	for _, prefix := range []string{"test", "other"} {
+		c, err := config.New("../../../configs/bot_test.yaml", false)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		c.Meta.Prefix = prefix
+		c.Meta.Title = "title " + prefix
+		c.ServerToken = testToken
+		if prefix == "test" {
+			c.ServerToken = "other token"
+		}
+		b := bot.New(DaoMem.New(), c)
+		go func() {
+			for range b.GetMessageChannel() {
+			}
+		}()
+		bots = append(bots, b)
+	}
+
+	f := NewFestivalsHandler(bots)
+	r := gin.New()
+	r.GET("/api/lineup/:festival", f.GetLineUp)
+	r.PUT("/api/lineup/:festival", f.TokenAuthMiddleware(), f.UpdateLineUp)
+	r.GET("/api/lineup/:festival/mergerequests", f.TokenAuthMiddleware(), f.GetMergeRequests)
+	r.GET("/api/lineup/:festival/mergerequests/:id", f.TokenAuthMiddleware(), f.GetMergeRequest)
+	r.POST("/api/lineup/:festival/mergerequests/:id/:action", f.TokenAuthMiddleware(), f.DecideMergeRequest)
+	r.GET("/api/lineup/:festival/manifest", f.GetManifest)
+	r.POST("/api/lineup/:festival/announce", f.TokenAuthMiddleware(), f.Announce)
+
+	for _, prefix := range []string{"test", "other"} {
+		w := request(r, http.MethodGet, "/api/lineup/"+prefix, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%v: unexpected status %v", prefix, w.Code)
+		}
+		var response Response
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if response.Meta.Prefix != prefix || response.Meta.Title != "title "+prefix || len(response.Sets) != 6 {
+			t.Fatalf("%v: expected the lineup of the festival, got %v", prefix, w.Body.String())
+		}
+	}
+
+	// a merge request with the links of the sets, checked with the token of the festival
+	link := []config.SetMeta{{Key: "soundcloud", Value: "https://soundcloud.com/dj"}}
+	lineup := config.Lineup{Sets: map[string][]config.Set{"🍵": {{Day: 2, Hour: 1, Duration: 60, Dj: "Linked", Meta: link}}}}
+	if w := request(r, http.MethodPut, "/api/lineup/test", lineup); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the token of the festival to be checked, got %v", w.Code)
+	}
+	if w := request(r, http.MethodPut, "/api/lineup/other", lineup); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v %v", w.Code, w.Body.String())
+	}
+	if len(bots[0].GetMergeRequests()) != 0 {
+		t.Fatalf("expected no merge request for the default festival")
+	}
+	mrs := bots[1].GetMergeRequests()
+	if len(mrs) != 1 || !reflect.DeepEqual(mrs[0].Changes[0].Meta, link) {
+		t.Fatalf("expected the merge request with the links, got %v", mrs)
+	}
+	path := fmt.Sprintf("/api/lineup/other/mergerequests/%d", mrs[0].ID)
+	if w := request(r, http.MethodGet, "/api/lineup/test/mergerequests", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the token of the festival to be checked, got %v", w.Code)
+	}
+	if w := request(r, http.MethodGet, path, nil); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v %v", w.Code, w.Body.String())
+	}
+	if w := request(r, http.MethodPost, path+"/accept", nil); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v %v", w.Code, w.Body.String())
+	}
+	found := false
+	for _, v := range bots[1].Sets() {
+		if v.Dj == "Linked" {
+			found = reflect.DeepEqual(v.Meta, link)
+		}
+	}
+	if !found {
+		t.Fatalf("expected the set with its links, got %v", bots[1].Sets())
+	}
+
+	if w := request(r, http.MethodPost, "/api/lineup/test/announce", AnnounceRequest{Message: "hello"}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the token of the festival to be checked, got %v", w.Code)
+	}
+	if w := request(r, http.MethodPost, "/api/lineup/other/announce", AnnounceRequest{Message: "hello"}); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v %v", w.Code, w.Body.String())
+	}
+
+	// the manifest follows the config reloaded
+	reloaded, err := config.New("../../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reloaded.Meta.Prefix = "other"
+	reloaded.Meta.MobileAppName = "reloaded"
+	if _, err := bots[1].Reload(reloaded); err != nil {
+		t.Fatalf(err.Error())
+	}
+	var manifest Manifest
+	w := request(r, http.MethodGet, "/api/lineup/other/manifest", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &manifest); err != nil || manifest.Name != "reloaded" {
+		t.Fatalf("expected the manifest of the reloaded config, got %v %v", w.Body.String(), err)
+	}
+
+	for _, path := range []string{"/api/lineup/unknown", "/api/lineup/unknown/mergerequests", "/api/lineup/unknown/manifest"} {
+		if w := request(r, http.MethodGet, path, nil); w.Code != http.StatusNotFound {
+			t.Fatalf("%v: expected %v, got %v", path, http.StatusNotFound, w.Code)
+		}
+	}
+}
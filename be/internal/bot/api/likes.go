@@ -0,0 +1,168 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+)
+
+const (
+	likesTokenSize = 16
+)
+
+var likesTokenRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Like mirrors the Like interface of the frontend (fe/src/lib/types.ts)
+type Like struct {
+	Dj                string           `json:"dj"`
+	Title             string           `json:"title"`
+	BeginningSchedule time.Time        `json:"beginningSchedule"`
+	Room              string           `json:"room"`
+	Started           time.Time        `json:"started"`
+	Meta              []config.SetMeta `json:"meta"`
+}
+
+// LikesRequest merges Likes into the likes stored for Token, Removed are the likes unliked
+// since the last post and Clear replaces the stored likes by Likes
+type LikesRequest struct {
+	Token   string `json:"token"`
+	Likes   []Like `json:"likes"`
+	Removed []Like `json:"removed"`
+	Clear   bool   `json:"clear"`
+}
+
+type LikesResponse struct {
+	Token string `json:"token"`
+	Likes []Like `json:"likes"`
+}
+
+// LikesHandler stores the likes with the dao of the bot, keyed by its current config
+type LikesHandler struct {
+	Bot *bot.Bot
+}
+
+func NewLikesHandler(bot *bot.Bot) *LikesHandler {
+	return &LikesHandler{Bot: bot}
+}
+
+func newLikesToken() (string, error) {
+	b := make([]byte, likesTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func likesKey(config *config.Config, token string) string {
+	return "likes-" + config.Meta.Prefix + "-" + token
+}
+
+func (h *LikesHandler) load(config *config.Config, token string) []Like {
+	likes := []Like{}
+	s, err := h.Bot.GetDao().Get(likesKey(config, token), config.Lineup.BeginningSchedule)
+	if err != nil {
+		log.Debug().Msgf("no likes for token %v: %v", token, err)
+		return likes
+	}
+	if err := json.Unmarshal([]byte(s), &likes); err != nil {
+		log.Error().Msg(err.Error())
+	}
+	return likes
+}
+
+func (h *LikesHandler) save(config *config.Config, token string, likes []Like) error {
+	bytes, err := json.Marshal(likes)
+	if err != nil {
+		return err
+	}
+	return h.Bot.GetDao().Save(likesKey(config, token), config.Lineup.BeginningSchedule, string(bytes))
+}
+
+// likeKey identifies a like, two devices liking the same set post the same key
+type likeKey struct {
+	dj      string
+	room    string
+	started int64
+}
+
+func (l Like) key() likeKey {
+	return likeKey{dj: l.Dj, room: l.Room, started: l.Started.Unix()}
+}
+
+// MergeLikes removes duplicates (same dj, room and start time), the first occurrence wins
+func MergeLikes(likes []Like) []Like {
+	seen := make(map[likeKey]bool)
+	res := []Like{}
+	for _, v := range likes {
+		k := v.key()
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if v.Meta == nil {
+			v.Meta = []config.SetMeta{}
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+// removeLikes returns likes without the ones of removed
+func removeLikes(likes []Like, removed []Like) []Like {
+	drop := make(map[likeKey]bool)
+	for _, v := range removed {
+		drop[v.key()] = true
+	}
+	res := []Like{}
+	for _, v := range likes {
+		if !drop[v.key()] {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// PostLikes merges the likes of a PWA user with the ones stored for the token and returns
+// them, so a reinstalled app (or another device using the same token) gets its favourites
+// back. An invalid token gets a new one.
+func (h *LikesHandler) PostLikes(c *gin.Context) {
+	var req LikesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	token := req.Token
+	if !likesTokenRegex.MatchString(token) {
+		var err error
+		token, err = newLikesToken()
+		if err != nil {
+			log.Error().Msg(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create token"})
+			return
+		}
+		log.Debug().Msgf("new likes token %v", token)
+	}
+
+	config := h.Bot.GetConfig()
+	stored := []Like{}
+	if !req.Clear {
+		stored = h.load(config, token)
+	}
+	likes := removeLikes(MergeLikes(append(stored, req.Likes...)), req.Removed)
+	if err := h.save(config, token, likes); err != nil {
+		log.Error().Msg(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save likes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, LikesResponse{Token: token, Likes: likes})
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func postLikes(t *testing.T, r *gin.Engine, req LikesRequest) LikesResponse {
+	t.Helper()
+	w := request(r, http.MethodPost, "/api/likes", req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v %v", w.Code, w.Body.String())
+	}
+	var res LikesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return res
+}
+
+func likedDjs(likes []Like) []string {
+	res := []string{}
+	for _, v := range likes {
+		res = append(res, v.Dj)
+	}
+	return res
+}
+
+func TestPostLikes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, err := config.New("../../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := time.Now()
+	c.Lineup.BeginningSchedule = time.Date(tt.Year()+1, 1, 1, 0, 0, 0, 0, tt.Location())
+	festival := bot.New(DaoMem.New(), c)
+	go func() {
+		for range festival.GetMessageChannel() {
+		}
+	}()
+	h := NewLikesHandler(festival)
+	r := gin.New()
+	r.POST("/api/likes", h.PostLikes)
+
+	start := c.Lineup.BeginningSchedule.Add(25 * time.Hour)
+	a := Like{Dj: "A", Room: "🍵", Started: start}
+	b := Like{Dj: "B", Room: "🍵", Started: start.Add(time.Hour)}
+	e := Like{Dj: "E", Room: "🔨", Started: start.Add(2 * time.Hour)}
+
+	// a new token is created
+	first := postLikes(t, r, LikesRequest{Likes: []Like{a, a}})
+	if !likesTokenRegex.MatchString(first.Token) || len(first.Likes) != 1 {
+		t.Fatalf("unexpected answer %+v", first)
+	}
+
+	// another device with likes of its own gets both
+	res := postLikes(t, r, LikesRequest{Token: first.Token, Likes: []Like{b}})
+	if got := likedDjs(res.Likes); len(got) != 2 || got[0] != "A" || got[1] != "B" {
+		t.Fatalf("expected the likes to be merged, got %v", got)
+	}
+
+	// unliking the last dj of a device removes it
+	res = postLikes(t, r, LikesRequest{Token: first.Token, Likes: []Like{}, Removed: []Like{a}})
+	if got := likedDjs(res.Likes); len(got) != 1 || got[0] != "B" {
+		t.Fatalf("expected A to be removed, got %v", got)
+	}
+	res = postLikes(t, r, LikesRequest{Token: first.Token})
+	if got := likedDjs(res.Likes); len(got) != 1 || got[0] != "B" {
+		t.Fatalf("expected the removal to be saved, got %v", got)
+	}
+
+	// clear replaces the stored likes
+	res = postLikes(t, r, LikesRequest{Token: first.Token, Likes: []Like{e}, Clear: true})
+	if got := likedDjs(res.Likes); len(got) != 1 || got[0] != "E" {
+		t.Fatalf("expected the likes to be cleared, got %v", got)
+	}
+	res = postLikes(t, r, LikesRequest{Token: first.Token, Clear: true})
+	if len(res.Likes) != 0 {
+		t.Fatalf("expected no likes, got %v", likedDjs(res.Likes))
+	}
+
+	// an invalid token gets a new one, without the likes of the others
+	res = postLikes(t, r, LikesRequest{Token: "../" + first.Token, Likes: []Like{b}})
+	if res.Token == first.Token || !likesTokenRegex.MatchString(res.Token) || len(res.Likes) != 1 {
+		t.Fatalf("unexpected answer for an invalid token %+v", res)
+	}
+	if w := request(r, http.MethodPost, "/api/likes", "not json"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid body to be refused, got %v", w.Code)
+	}
+}
@@ -4,21 +4,23 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	"github.com/shallowBunny/app/be/internal/bot"
 )
 
+// ManifestHandler serves the manifest of the current config of the bot, it changes on reload
 type ManifestHandler struct {
-	Config *config.Config
+	Bot *bot.Bot
 }
 
-func NewManifestHandler(config *config.Config) *ManifestHandler {
-	return &ManifestHandler{Config: config}
+func NewManifestHandler(bot *bot.Bot) *ManifestHandler {
+	return &ManifestHandler{Bot: bot}
 }
 
 func (h *ManifestHandler) GetManifest(c *gin.Context) {
+	config := h.Bot.GetConfig()
 	manifest := Manifest{
-		Name:            h.Config.Meta.MobileAppName,
-		ShortName:       h.Config.Meta.MobileAppName,
+		Name:            config.Meta.MobileAppName,
+		ShortName:       config.Meta.MobileAppName,
 		StartURL:        "/",
 		Display:         "standalone",
 		BackgroundColor: "#222123",
@@ -28,19 +30,19 @@ func (h *ManifestHandler) GetManifest(c *gin.Context) {
 		ThemeColor:      "#222123",
 		Icons: []Icon{
 			{
-				Src:     h.Config.Meta.Prefix + "-192x192.png",
+				Src:     config.Meta.Prefix + "-192x192.png",
 				Sizes:   "192x192",
 				Type:    "image/png",
 				Purpose: "any",
 			},
 			{
-				Src:     h.Config.Meta.Prefix + "-180x180.png",
+				Src:     config.Meta.Prefix + "-180x180.png",
 				Sizes:   "180x180",
 				Type:    "image/png",
 				Purpose: "maskable",
 			},
 			{
-				Src:     h.Config.Meta.Prefix + "-192x192.png",
+				Src:     config.Meta.Prefix + "-192x192.png",
 				Sizes:   "192x192",
 				Type:    "image/png",
 				Purpose: "maskable",
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp"
+	"github.com/shallowBunny/app/be/internal/bot/mergeRequests"
+	"github.com/shallowBunny/app/be/internal/utils"
+)
+
+const (
+	apiModerator = "api"
+)
+
+type MergeRequestResponse struct {
+	ID        int                `json:"id"`
+	User      string             `json:"user"`
+	Created   time.Time          `json:"created"`
+	Info      string             `json:"info"`
+	Status    string             `json:"status"`
+	DecidedBy string             `json:"decidedBy,omitempty"`
+	Decided   *time.Time         `json:"decided,omitempty"`
+	Diff      *lineUp.LineUpDiff `json:"diff,omitempty"` // only for pending merge requests
+}
+
+func (b *BotHandler) mergeRequestResponse(mr bot.MergeRequests) MergeRequestResponse {
+	res := MergeRequestResponse{
+		ID:        mr.ID,
+		User:      mr.User,
+		Created:   mr.Created,
+		Info:      mr.Info,
+		Status:    string(mr.Status),
+		DecidedBy: mr.DecidedBy,
+	}
+	if mr.Status == mergeRequests.StatusPending {
+		diff := b.Bot.MergeRequestDiff(mr)
+		res.Diff = &diff
+	} else {
+		decided := mr.Decided
+		res.Decided = &decided
+	}
+	return res
+}
+
+func (b *BotHandler) getMergeRequest(c *gin.Context) (bot.MergeRequests, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merge request id"})
+		return bot.MergeRequests{}, false
+	}
+	mr, ok := b.Bot.GetMergeRequest(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown merge request"})
+		return mr, false
+	}
+	return mr, true
+}
+
+func (b *BotHandler) GetMergeRequests(c *gin.Context) {
+	res := []MergeRequestResponse{}
+	for _, v := range b.Bot.GetMergeRequests() {
+		res = append(res, b.mergeRequestResponse(v))
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (b *BotHandler) GetMergeRequest(c *gin.Context) {
+	mr, ok := b.getMergeRequest(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, b.mergeRequestResponse(mr))
+}
+
+// DecideMergeRequest handles POST /api/mergerequests/:id/accept and /api/mergerequests/:id/refuse
+// (/api/lineup/:festival/mergerequests/... for the other festivals)
+func (b *BotHandler) DecideMergeRequest(c *gin.Context) {
+	mr, ok := b.getMergeRequest(c)
+	if !ok {
+		return
+	}
+	moderator := apiModerator + " " + utils.GetClientIPByRequest(c.Request)
+	var err error
+	switch c.Param("action") {
+	case "accept":
+		mr, err = b.Bot.AcceptMergeRequest(mr.ID, moderator, 0)
+	case "refuse":
+		mr, err = b.Bot.RefuseMergeRequest(mr.ID, moderator, 0)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown action " + c.Param("action")})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err := b.Bot.Save(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	b.Bot.SendModosMessage("merge request #" + strconv.Itoa(mr.ID) + " " + string(mr.Status) + " by " + moderator)
+	c.JSON(http.StatusOK, b.mergeRequestResponse(mr))
+}
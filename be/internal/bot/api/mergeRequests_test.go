@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func TestMergeRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, err := config.New("../../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := time.Now()
+	c.Lineup.BeginningSchedule = time.Date(tt.Year()+1, 1, 1, 0, 0, 0, 0, tt.Location())
+	c.ServerToken = testToken
+	b := bot.New(DaoMem.New(), c)
+	go func() {
+		for range b.GetMessageChannel() {
+		}
+	}()
+
+	h := NewBotHandler(b)
+	r := gin.New()
+	r.PUT("/api", h.TokenAuthMiddleware(), h.UpdateLineUp)
+	r.GET("/api/mergerequests", h.TokenAuthMiddleware(), h.GetMergeRequests)
+	r.GET("/api/mergerequests/:id", h.TokenAuthMiddleware(), h.GetMergeRequest)
+	r.POST("/api/mergerequests/:id/:action", h.TokenAuthMiddleware(), h.DecideMergeRequest)
+
+	for _, dj := range []string{"Accepted", "Refused"} {
+		lineup := config.Lineup{Sets: map[string][]config.Set{"🍵": {{Day: 2, Hour: 1, Duration: 60, Dj: dj}}}}
+		if w := request(r, http.MethodPut, "/api", lineup); w.Code != http.StatusOK {
+			t.Fatalf("unexpected status %v %v", w.Code, w.Body.String())
+		}
+	}
+
+	w := request(r, http.MethodGet, "/api/mergerequests", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v", w.Code)
+	}
+	var mrs []MergeRequestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &mrs); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(mrs) != 2 {
+		t.Fatalf("expected 2 merge requests, got %v", w.Body.String())
+	}
+	for i, dj := range []string{"Accepted", "Refused"} {
+		if mrs[i].Status != "pending" || mrs[i].Diff == nil || len(mrs[i].Diff.Added) != 1 || mrs[i].Diff.Added[0].Dj != dj {
+			t.Fatalf("expected the pending merge request adding %v, got %+v", dj, mrs[i])
+		}
+	}
+	accepted, refused := mrs[0].ID, mrs[1].ID
+
+	w = request(r, http.MethodGet, fmt.Sprintf("/api/mergerequests/%d", accepted), nil)
+	var mr MergeRequestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &mr); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("unexpected response %v %v", w.Code, w.Body.String())
+	}
+	if mr.ID != accepted || mr.User != "api" || mr.Diff == nil {
+		t.Fatalf("unexpected merge request %+v", mr)
+	}
+
+	for _, tc := range []struct {
+		id     int
+		action string
+		status string
+	}{
+		{accepted, "accept", "accepted"},
+		{refused, "refuse", "refused"},
+	} {
+		w := request(r, http.MethodPost, fmt.Sprintf("/api/mergerequests/%d/%v", tc.id, tc.action), nil)
+		var mr MergeRequestResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &mr); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%v: unexpected response %v %v", tc.action, w.Code, w.Body.String())
+		}
+		if mr.Status != tc.status || mr.Diff != nil || mr.Decided == nil || mr.DecidedBy == "" {
+			t.Fatalf("%v: unexpected merge request %+v", tc.action, mr)
+		}
+	}
+	found := map[string]bool{}
+	for _, v := range b.Sets() {
+		found[v.Dj] = true
+	}
+	if !found["Accepted"] || found["Refused"] {
+		t.Fatalf("expected only the accepted set in the lineup, got %v", b.Sets())
+	}
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{http.MethodGet, "/api/mergerequests/999", http.StatusNotFound},
+		{http.MethodGet, "/api/mergerequests/abc", http.StatusBadRequest},
+		{http.MethodPost, "/api/mergerequests/999/accept", http.StatusNotFound},
+		{http.MethodPost, fmt.Sprintf("/api/mergerequests/%d/unknown", accepted), http.StatusNotFound},
+		// already decided
+		{http.MethodPost, fmt.Sprintf("/api/mergerequests/%d/refuse", accepted), http.StatusConflict},
+		{http.MethodPost, fmt.Sprintf("/api/mergerequests/%d/accept", refused), http.StatusConflict},
+	} {
+		if w := request(r, tc.method, tc.path, nil); w.Code != tc.code {
+			t.Fatalf("%v %v: expected %v, got %v %v", tc.method, tc.path, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shallowBunny/app/be/internal/bot/webpush"
+)
+
+// GetPushKey returns the applicationServerKey of PushManager.subscribe
+func (b *BotHandler) GetPushKey(c *gin.Context) {
+	key, err := b.Bot.PushPublicKey()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"publicKey": key})
+}
+
+// SubscribePush receives the PushSubscription of a browser, with the rooms to be notified
+// for (every room when empty)
+func (b *BotHandler) SubscribePush(c *gin.Context) {
+	var sub webpush.Subscription
+	if err := c.ShouldBindJSON(&sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := b.Bot.SubscribePush(sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Subscribed"})
+}
+
+func (b *BotHandler) UnsubscribePush(c *gin.Context) {
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	removed, err := b.Bot.UnsubscribePush(req.Endpoint)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown subscription"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed"})
+}
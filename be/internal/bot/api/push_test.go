@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/bot/webpush/webpushtest"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func TestPush(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, err := config.New("../../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := time.Now()
+	c.Lineup.BeginningSchedule = time.Date(tt.Year()+1, 1, 1, 0, 0, 0, 0, tt.Location())
+	service := webpushtest.NewService()
+	defer service.Close()
+
+	routes := func(b *bot.Bot) *gin.Engine {
+		h := NewBotHandler(b)
+		r := gin.New()
+		r.GET("/api/push/key", h.GetPushKey)
+		r.POST("/api/push/subscribe", h.SubscribePush)
+		r.POST("/api/push/unsubscribe", h.UnsubscribePush)
+		return r
+	}
+
+	r := routes(bot.New(DaoMem.New(), c))
+	if w := request(r, http.MethodGet, "/api/push/key", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected web push disabled, got %v", w.Code)
+	}
+
+	c.WebPushSubject = "mailto:admin@example.com"
+	r = routes(bot.New(DaoMem.New(), c))
+	if w := request(r, http.MethodGet, "/api/push/key", nil); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v", w.Code)
+	}
+	sub := service.Subscribe("🍵")
+	if w := request(r, http.MethodPost, "/api/push/subscribe", sub); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v %v", w.Code, w.Body.String())
+	}
+	invalid := service.Subscribe()
+	invalid.Endpoint = "http://example.com"
+	if w := request(r, http.MethodPost, "/api/push/subscribe", invalid); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected an http endpoint to be refused, got %v", w.Code)
+	}
+	unsubscribe := map[string]string{"endpoint": sub.Endpoint}
+	if w := request(r, http.MethodPost, "/api/push/unsubscribe", unsubscribe); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v", w.Code)
+	}
+	if w := request(r, http.MethodPost, "/api/push/unsubscribe", unsubscribe); w.Code != http.StatusNotFound {
+		t.Fatalf("expected an unknown subscription, got %v", w.Code)
+	}
+}
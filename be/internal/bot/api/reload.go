@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReloadHandler reloads the config files of the festivals, see bot.Reload
+type ReloadHandler struct {
+	reload func() (string, error)
+}
+
+func NewReloadHandler(reload func() (string, error)) *ReloadHandler {
+	return &ReloadHandler{reload: reload}
+}
+
+func (h *ReloadHandler) Reload(c *gin.Context) {
+	res, err := h.reload()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "message": res})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": res})
+}
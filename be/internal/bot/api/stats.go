@@ -0,0 +1,13 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStats returns the analytics of the festival, the unique users by day and hour, the djs
+// and rooms searched and the commands used
+func (b *BotHandler) GetStats(c *gin.Context) {
+	c.JSON(http.StatusOK, b.Bot.Stats())
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/bot/analytics"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func TestStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, err := config.New("../../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := time.Now()
+	c.Lineup.BeginningSchedule = time.Date(tt.Year()+1, 1, 1, 0, 0, 0, 0, tt.Location())
+	c.ServerToken = testToken
+
+	h := NewBotHandler(bot.New(DaoMem.New(), c))
+	r := gin.New()
+	r.GET("/api", h.GetLineUp)
+	r.GET("/api/stats", h.TokenAuthMiddleware(), h.GetStats)
+
+	request(r, http.MethodGet, "/api", nil)
+	request(r, http.MethodGet, "/api", nil)
+	w := request(r, http.MethodGet, "/api/stats", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v", w.Code)
+	}
+	var report analytics.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if report.Users != 1 || len(report.Days) != 1 || report.Days[0].Channels[analytics.API].Uniques != 1 {
+		t.Fatalf("unexpected report %v", w.Body.String())
+	}
+
+	c.ServerToken = "other"
+	if w := request(r, http.MethodGet, "/api/stats", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the token to be checked, got %v", w.Code)
+	}
+}
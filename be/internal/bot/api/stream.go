@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot"
+)
+
+// streamHeartbeat is the delay between the keepalive comments, proxies close idle connections
+var streamHeartbeat = 15 * time.Second
+
+// Stream sends the lineup changes, the sets starting and the announcements as server-sent
+// events. The id of the lineup events is the version of the lineup, the other events have no
+// id so the Last-Event-ID sent by a reconnecting client is the version it has. A client with
+// another version gets a refetch event.
+func (b *BotHandler) Stream(c *gin.Context) {
+	events, unsubscribe, err := b.Bot.Subscribe()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // nginx
+	c.Status(http.StatusOK)
+	version := b.Bot.LineUpVersion()
+	if last := c.GetHeader("Last-Event-ID"); last != "" && last != strconv.Itoa(version) {
+		data, _ := json.Marshal(bot.StreamRefetchVersion{Version: version})
+		fmt.Fprintf(c.Writer, "retry: 5000\nid: %d\nevent: %s\ndata: %s\n\n", version, bot.StreamRefetch, data)
+	} else {
+		fmt.Fprintf(c.Writer, "retry: 5000\nid: %d\n\n", version)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return false
+			}
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				log.Error().Msg(err.Error())
+				return true
+			}
+			if e.Type == bot.StreamLineUp {
+				fmt.Fprintf(w, "id: %d\n", e.Version)
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
+
+type AnnounceRequest struct {
+	Message string `json:"message"`
+}
+
+// Announce sends an announcement to the stream subscribers
+func (b *BotHandler) Announce(c *gin.Context) {
+	var req AnnounceRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Message == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	n := b.Bot.Announce(req.Message)
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Announced to %d subscribers", n)})
+}
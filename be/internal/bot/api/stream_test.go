@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+// stream connects to the stream with the Last-Event-ID lastEventID, it returns a function
+// reading the next event (its lines), the keepalive comments are skipped
+func stream(t *testing.T, url, lastEventID string) (*http.Response, func() []string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	lines := bufio.NewScanner(resp.Body)
+	next := func() []string {
+		res := []string{}
+		for lines.Scan() {
+			if lines.Text() == "" {
+				if len(res) != 0 {
+					return res
+				}
+				continue
+			}
+			if !strings.HasPrefix(lines.Text(), ": keepalive") {
+				res = append(res, lines.Text())
+			}
+		}
+		return res
+	}
+	return resp, next
+}
+
+func TestStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, err := config.New("../../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := time.Now()
+	c.Lineup.BeginningSchedule = time.Date(tt.Year()+1, 1, 1, 0, 0, 0, 0, tt.Location())
+	c.ServerToken = testToken
+	b := bot.New(DaoMem.New(), c)
+	go func() {
+		for range b.GetMessageChannel() {
+		}
+	}()
+	streamHeartbeat = 10 * time.Millisecond
+
+	h := NewBotHandler(b)
+	r := gin.New()
+	r.GET("/api/stream", h.Stream)
+	r.POST("/api/announce", h.TokenAuthMiddleware(), h.Announce)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, next := stream(t, server.URL+"/api/stream", "")
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %v", resp.Header.Get("Content-Type"))
+	}
+	if got := next(); !reflect.DeepEqual(got, []string{"retry: 5000", "id: 1"}) {
+		t.Fatalf("unexpected first event %v", got)
+	}
+
+	// only the lineup events have the version as id
+	if w := request(r, http.MethodPost, "/api/announce", AnnounceRequest{Message: "hello"}); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v", w.Code)
+	}
+	if got := next(); !reflect.DeepEqual(got, []string{"event: announcement", `data: {"version":1,"message":"hello"}`}) {
+		t.Fatalf("unexpected announcement %v", got)
+	}
+	mr := bot.NewMergeRequest(c.Lineup.BeginningSchedule, []inputs.InputCommandResultSet{{Room: "🍵", Dj: "New", Day: 2, Hour: 1, Duration: 60}}, 0, "api", "")
+	if err := b.SubmitMergeRequest(mr); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := b.AcceptMergeRequest(mr.ID, "test", -123); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := next(); len(got) != 3 || got[0] != "id: 2" || got[1] != "event: lineup" {
+		t.Fatalf("unexpected lineup event %v", got)
+	}
+
+	// the stream ends with the server
+	b.CloseStreams()
+	next()
+
+	// a client reconnecting with another version refetches the lineup
+	for _, tc := range []struct {
+		lastEventID string
+		want        []string
+	}{
+		{"2", []string{"retry: 5000", "id: 2"}},
+		{"1", []string{"retry: 5000", "id: 2", "event: refetch", `data: {"version":2}`}},
+		{"unknown", []string{"retry: 5000", "id: 2", "event: refetch", `data: {"version":2}`}},
+	} {
+		resp, next := stream(t, server.URL+"/api/stream", tc.lastEventID)
+		if got := next(); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%v: expected %v, got %v", tc.lastEventID, tc.want, got)
+		}
+		resp.Body.Close()
+	}
+}
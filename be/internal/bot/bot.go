@@ -5,17 +5,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ottoDaffy/go-diff/diffmatchpatch"
+	"github.com/shallowBunny/app/be/internal/bot/analytics"
 	"github.com/shallowBunny/app/be/internal/bot/lineUp"
 	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/bot/mergeRequests"
 	"github.com/shallowBunny/app/be/internal/bot/users"
+	"github.com/shallowBunny/app/be/internal/bot/webpush"
+	"github.com/shallowBunny/app/be/internal/infrastructure/clock"
 	"github.com/shallowBunny/app/be/internal/infrastructure/config"
 	dao "github.com/shallowBunny/app/be/internal/infrastructure/repository"
 	"github.com/shallowBunny/app/be/internal/utils"
@@ -33,6 +39,9 @@ const (
 	MergedMessageAccepted     = "✅ Your merge request #%d has been accepted by %v, thanks!"
 	MergedMessageRefused      = "💔 Your merge request #%d has been refused by %v."
 	rebaseCommandErrorMessage = "No merge requests to rebase."
+	rebaseUnknownMessage      = "Merge request #%d is not pending."
+	rebaseChooseMessage       = "Pending merge requests, choose the one to review (or use /rebase <id> <id>... to review several at once):\n"
+	rebaseConflictMessage     = "⚠️ #%d and #%d both change %v\n"
 	stopNotificationsCommand  = "🔴"
 	stoppedNoticationsMessage = "You stopped Dj changes notifications"
 	startNotificationsCommand = "🟢"
@@ -41,27 +50,54 @@ const (
 	maxMnbRoomsForRoomButton  = 100
 	maxSize                   = 4096
 	noMotdMessage             = "No help available"
+	likeCommand               = "like"
+	unlikeCommand             = "unlike"
+	likesCommand              = "likes"
+	likedMessage              = "❤️ You liked %v, you will be notified %d minutes before the set starts"
+	likedSeveralMessage       = "Several DJs are matching <%v>, please be more precise:\n%v"
+	likeNotFoundMessage       = "No DJ matching <%v> 😔"
+	unlikedMessage            = "💔 You unliked %v"
+	noLikesMessage            = "You didn't like any DJ yet, use /like <dj> to get notified before the sets of your favourite DJs"
+	likesMessage              = "❤️ Your liked DJs (use /unlike <dj> to remove one):\n%v"
+	likedDjStartsMessage      = "❤️ %v starts in %d minutes in %v"
+	likedDjStartedMessage     = "❤️ %v started in %v"
+	icsCommand                = "ics"
+	icsMessage                = "📅 Add the lineup to your calendar:\n%v\n\nor only one room:\n%v"
+	noIcsMessage              = "No calendar available"
+	mrsCommand                = "mrs"
+	maxDecidedMergeRequests   = 10
 )
 
-var (
-	mergeRequestID = 0
-)
+var rebaseIdsRegex = regexp.MustCompile(`\d+`)
 
-type MergeRequests struct {
-	Changes           []inputs.InputCommandResultSet
-	UserId            int64
-	User              string
-	Created           time.Time
-	ID                int
-	Info              string
-	BeginningSchedule time.Time
-}
+type MergeRequests = mergeRequests.MergeRequest
 
+// Bot is shared by the telegram loop, the rest api and SendEvents: every exported method
+// using the lineups, users, merge requests or logs holds mu. Sets slices of a lineup are
+// never modified in place (AddSet and RemoveSet build new ones) so the result of Sets()
+// can be read after releasing the lock.
 type Bot struct {
+	mu                     sync.Mutex
+	outbox                 []Message      // messages queued while holding mu, sent by unlock
+	sending                sync.WaitGroup // unlocks sending their messages on channel, waited by Stop
 	dao                    dao.Dao
 	users                  users.Users
 	UsersLineUps           map[int64]*lineUp.LineUp // userId -> LineUp
-	UsersMergeRequest      []MergeRequests
+	mergeRequests          mergeRequests.MergeRequests
+	rebasing               map[int64][]int          // moderator userId -> merge requests being reviewed
+	keyboards              map[int64]wizardKeyboard // userId -> inline buttons of the current wizard step
+	keyboardSeq            int
+	queueStats             func() string     // state of the queue of the outgoing messages, shown by /log
+	dirtyUsers             map[int64]bool    // users whose lineup or input may have changed since the last save
+	dirtyRoot              bool              // the root lineup changed since the last save
+	savedHashes            map[string]uint64 // dao key -> hash of the value saved, to skip unchanged values
+	subscribers            map[chan StreamEvent]bool
+	lineUpVersion          int           // incremented each time the root lineup changes, sent in the stream events
+	pushKeys               *webpush.Keys // nil when web push is disabled
+	pushSubscriptions      webpush.Subscriptions
+	pushQueue              chan pushNotification
+	analytics              *analytics.Analytics // has its own lock
+	clock                  clock.Clock
 	RootLineUp             *lineUp.LineUp
 	admins                 []int
 	modos                  []int
@@ -80,26 +116,95 @@ const (
 
 type KeyboardType int
 
+// TransportIDBase is the first user id of the transports not having int64 ids (i.e. matrix
+// rooms), telegram ids are far below it
+const TransportIDBase int64 = 1 << 60
+
 type Message struct {
-	UserID    int64
-	Text      string
-	Buttons   []string
-	Html      bool
-	ImagePath string
+	UserID        int64
+	Text          string
+	Buttons       []string
+	Html          bool
+	ImagePath     string
+	InlineButtons [][]InlineButton // shown under the text by the transports supporting them
+	EditMessageID string           // set by the transport: message replaced by this one
+}
+
+// InlineButton is a button under a message, its Data is sent back to ProcessCallback
+type InlineButton struct {
+	Text string
+	Data string
 }
 
-func (b Bot) GetMessageChannel() chan Message {
+// wizardKeyboard is the last wizard step sent to a user, a callback is only valid for it
+type wizardKeyboard struct {
+	seq     int
+	buttons []string
+}
+
+func (b *Bot) GetMessageChannel() chan Message {
 	return b.channel
 }
 
-func (b Bot) StatsUsingUserIp(ip string) {
-	i, err := b.dao.SaveHset24Hours("stats-api-"+b.config.Meta.Prefix, ip)
-	if err != nil {
-		log.Info().Msgf("SaveHset24Hours: %v %v %v\n", ip, i, err)
+func (b *Bot) lock() {
+	b.mu.Lock()
+}
+
+// unlock releases the bot then sends the queued messages: sending on the channel while
+// holding the lock would deadlock with the telegram sender calling DeleteUser
+func (b *Bot) unlock() {
+	messages, channel := b.outbox, b.channel
+	b.outbox = nil
+	if channel == nil || len(messages) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	b.sending.Add(1)
+	b.mu.Unlock()
+	defer b.sending.Done()
+	for _, m := range messages {
+		channel <- m
 	}
 }
 
-func (b Bot) IsAdmin(user int64) bool {
+// Stop stops sending messages on the message channel, the messages of the bot are dropped
+// after. It returns once the messages queued before are sent, so the reader of the channel
+// must read it until Stop returns.
+func (b *Bot) Stop() {
+	b.mu.Lock()
+	b.channel = nil
+	b.mu.Unlock()
+	b.sending.Wait()
+}
+
+// SetQueueStats sets the function printing the state of the outgoing messages queue
+func (b *Bot) SetQueueStats(f func() string) {
+	b.lock()
+	defer b.unlock()
+	b.queueStats = f
+}
+
+func (b *Bot) GetSetsAndDurations() string {
+	b.lock()
+	defer b.unlock()
+	return b.RootLineUp.GetSetsAndDurations()
+}
+
+// Sets returns the sets of the root lineup
+func (b *Bot) Sets() []lineUp.Set {
+	b.lock()
+	defer b.unlock()
+	return b.RootLineUp.Sets
+}
+
+// FindRoom returns the index and the name of the room of the root lineup closest to source
+func (b *Bot) FindRoom(source string, distanceMaxRoom int) (int, string) {
+	b.lock()
+	defer b.unlock()
+	return b.RootLineUp.FindRoom(source, distanceMaxRoom)
+}
+
+func (b *Bot) IsAdmin(user int64) bool {
 	for _, v := range b.admins {
 		if v == int(user) {
 			return true
@@ -108,7 +213,7 @@ func (b Bot) IsAdmin(user int64) bool {
 	return false
 }
 
-func (b Bot) IsModo(user int64) bool {
+func (b *Bot) IsModo(user int64) bool {
 	for _, v := range b.modos {
 		if v == int(user) {
 			return true
@@ -117,20 +222,10 @@ func (b Bot) IsModo(user int64) bool {
 	return false
 }
 
-func (b Bot) Save() error {
-	bytes, err := json.Marshal(b)
-	if err != nil {
-		panic(err)
-	}
-	botString := string(bytes)
-	res, err := PrettyString(botString)
-	if err != nil {
-		log.Error().Msg(err.Error())
-	}
-	_ = res
-	//log.Trace().Msg(res)
-
-	return b.dao.SaveBot(b.config.Lineup.BeginningSchedule, botString)
+func (b *Bot) Save() error {
+	b.lock()
+	defer b.unlock()
+	return b.save()
 }
 
 func PrettyString(str string) (string, error) {
@@ -154,7 +249,13 @@ func ExtractEmoticons(input string) string {
 	return strings.Join(matches, "")
 }
 
+// New returns a bot on the time of the system in the timezone of the festival
 func New(dao dao.Dao, config *config.Config) *Bot {
+	return NewWithClock(dao, config, clock.In(config.Location))
+}
+
+// NewWithClock returns a bot whose lineups and notifications follow clock
+func NewWithClock(dao dao.Dao, config *config.Config, clock clock.Clock) *Bot {
 	var f *os.File
 	var err error
 	if config.CommandsHistoryLogFile != "" {
@@ -164,79 +265,69 @@ func New(dao dao.Dao, config *config.Config) *Bot {
 		}
 	}
 
-	bot := &Bot{}
+	bot := &Bot{
+		UsersLineUps: make(map[int64]*lineUp.LineUp),
+		dirtyUsers:   make(map[int64]bool),
+		savedHashes:  make(map[string]uint64),
+		dao:          dao,
+		clock:        clock,
+		// before the lineups, the bot saved by the previous versions has merge requests
+		mergeRequests: mergeRequests.New(dao, config.Lineup.BeginningSchedule),
+	}
 
-	gotBotFromDB := true
+	gotBotFromDB := false
 
 	if config.ReadSetsFromRedisOnRestart {
 		botString, err := dao.GetBot(config.Lineup.BeginningSchedule)
 		if err == nil {
-			res, err := PrettyString(botString)
-			if err != nil {
-				log.Error().Msg(err.Error())
-			}
-			_ = res
-
-			err = json.Unmarshal([]byte(botString), bot)
-			if err != nil {
-				log.Error().Msg(err.Error())
-				gotBotFromDB = false
-			}
 			log.Info().Msg("loading bot from redis")
-			emptyLineup := true
-			for _, v := range bot.UsersLineUps {
-				if len(v.Sets) != 0 {
-					emptyLineup = false
-				}
-				v.Init(config)
-			}
-			bot.RootLineUp.Init(config)
-			if len(bot.RootLineUp.Sets) != 0 {
-				emptyLineup = false
-			}
-			if emptyLineup {
+			gotBotFromDB = bot.load(config, botString)
+			if !gotBotFromDB {
 				log.Warn().Msg("empty lineups: using config")
-				gotBotFromDB = false
 			}
 		} else {
 			log.Warn().Msg("not found in redis: using config")
-			gotBotFromDB = false
 		}
 	} else {
 		log.Debug().Msg("input=false using config")
-		gotBotFromDB = false
 	}
 
 	if !gotBotFromDB {
-		bot = &Bot{
-			UsersLineUps: make(map[int64]*lineUp.LineUp),
-			RootLineUp:   lineUp.New(config),
-		}
-		gotBotFromDB = false
+		bot.UsersLineUps = make(map[int64]*lineUp.LineUp)
+		bot.RootLineUp = lineUp.New(config, clock)
+		bot.dirtyUsers = make(map[int64]bool)
+		bot.dirtyRoot = true
+		// the lineup of the config may differ from the one the app users got, the sets
+		// notified are kept
+		saved := bot.savedRootLineUp(config)
+		bot.lineUpVersion = saved.Version + 1
+		bot.RootLineUp.SetNotifiedSets(saved.Notified)
 		log.Info().Msg("loading bot from config")
 	}
+	if bot.lineUpVersion == 0 {
+		// saved by the previous versions
+		bot.lineUpVersion = 1
+	}
 
-	bot.dao = dao
 	bot.users = users.New(dao, config.Meta.Prefix, config.Lineup.BeginningSchedule)
+	bot.rebasing = make(map[int64][]int)
+	bot.keyboards = make(map[int64]wizardKeyboard)
+	bot.subscribers = make(map[chan StreamEvent]bool)
+	// callbacks of the keyboards sent before a restart must not match the new ones
+	bot.keyboardSeq = int(clock.Now().Unix())
 	bot.commandsHistoryLogFile = f
-	bot.config = config
 	bot.channel = make(chan Message)
-	bot.admins = config.Admins
-	bot.modos = config.Modos
-	bot.magicRoomButton = len(config.Lineup.Rooms) < maxMnbRoomsForRoomButton
-
-	for _, v := range config.Lineup.Rooms {
-		emo := ExtractEmoticons(v)
-		log.Trace().Msg(fmt.Sprintf("Rooms:%v -> <%v>", v, emo))
-		bot.roomsEmoticons = append(bot.roomsEmoticons, emo)
-	}
+	bot.setConfig(config)
+	bot.initPush()
+	bot.initAnalytics()
 
 	if bot.UsersLineUps == nil {
 		panic("nil user lineup")
 	}
 
-	if !gotBotFromDB {
-		err := bot.Save()
+	if bot.dirtyRoot {
+		// from the config or the bot saved in one value by the previous versions
+		err := bot.save()
 		if err != nil {
 			log.Error().Msg(err.Error())
 		}
@@ -253,18 +344,26 @@ func New(dao dao.Dao, config *config.Config) *Bot {
 		}
 	}
 
-	go bot.SendEvents()
-
 	return bot
 }
-func (b Bot) GetConfig() *config.Config {
+
+// GetConfig returns the current config, it is replaced by Reload and never modified
+func (b *Bot) GetConfig() *config.Config {
+	b.lock()
+	defer b.unlock()
 	return b.config
 }
 
+func (b *Bot) GetDao() dao.Dao {
+	return b.dao
+}
+
 // user = 0 pour les logs web
 func (b *Bot) Log(user int64, command, userString string) {
+	b.lock()
+	defer b.unlock()
 
-	logString := "\"" + command + "\", //" + time.Now().Format("Mon Jan 2 2006 15:04:05 MST") + " " + userString + " " + strconv.Itoa(int(user)) + "\n"
+	logString := "\"" + command + "\", //" + b.clock.Now().Format("Mon Jan 2 2006 15:04:05 MST") + " " + userString + " " + strconv.Itoa(int(user)) + "\n"
 
 	if user != 0 && b.commandsHistoryLogFile != nil {
 		if _, err := b.commandsHistoryLogFile.WriteString(logString); err != nil {
@@ -273,7 +372,7 @@ func (b *Bot) Log(user int64, command, userString string) {
 	}
 
 	if !b.IsAdmin(user) {
-		logString := time.Now().Format("Mon 15:04") + " " + userString
+		logString := b.clock.Now().Format("Mon 15:04") + " " + userString
 		if command != "" {
 			logString += " <" + command + ">"
 		}
@@ -287,7 +386,7 @@ func (b *Bot) Log(user int64, command, userString string) {
 		}
 		for _, u := range b.admins {
 			userId := int64(u)
-			lineup := b.GetLineUpForUser(userId)
+			lineup := b.getLineUpForUser(userId)
 			if lineup.IsUserInLogs(userId) {
 				b.sendMessage(userId, logString)
 			}
@@ -347,6 +446,9 @@ func splitMessages(messages []Message) []Message {
 					Buttons: msg.Buttons,
 					Html:    msg.Html,
 				}
+				if end == len(msg.Text) {
+					newMsg.InlineButtons = msg.InlineButtons
+				}
 				result = append(result, newMsg)
 				start = end
 			}
@@ -355,7 +457,13 @@ func splitMessages(messages []Message) []Message {
 	return result
 }
 
-func (b Bot) SendAdminsMessage(input string) {
+func (b *Bot) SendAdminsMessage(input string) {
+	b.lock()
+	defer b.unlock()
+	b.sendAdminsMessage(input)
+}
+
+func (b *Bot) sendAdminsMessage(input string) {
 	msg := "#admin " + input
 	for _, v := range b.admins {
 		b.sendMessage(int64(v), msg)
@@ -363,74 +471,218 @@ func (b Bot) SendAdminsMessage(input string) {
 	log.Info().Msg(msg)
 }
 
-func (b Bot) SendModosMessage(input string) {
+func (b *Bot) SendModosMessage(input string) {
+	b.lock()
+	defer b.unlock()
+	b.sendModosMessage(input, nil)
+}
+
+func (b *Bot) sendModosMessage(input string, inline [][]InlineButton) {
 	msg := "#modo " + input
 	for _, v := range b.modos {
-		b.sendMessage(int64(v), msg)
+		b.sendInlineMessage(int64(v), msg, inline)
 	}
 	log.Info().Msg(msg)
 	log.Info().Msg(fmt.Sprintf("send to %v", b.modos))
 
 }
 
-func (b Bot) sendMessage(userId int64, msg string) {
+// sendMessage queues a message, it is sent when the bot is unlocked
+func (b *Bot) sendMessage(userId int64, msg string) {
+	b.sendInlineMessage(userId, msg, nil)
+}
+
+func (b *Bot) sendInlineMessage(userId int64, msg string, inline [][]InlineButton) {
 	if b.channel != nil {
-		buttons := b.GetButtonsForUser(userId)
+		buttons := b.getButtonsForUser(userId)
 
 		messages := splitMessages([]Message{{UserID: userId,
-			Text:    msg,
-			Buttons: buttons}})
+			Text:          msg,
+			Buttons:       buttons,
+			InlineButtons: inline}})
 
-		for _, m := range messages {
-			b.channel <- m
-		}
+		b.outbox = append(b.outbox, messages...)
 	}
 }
 
-func (b *Bot) SendEvents() {
+// SendEvents notifies the users of the sets starting until quit is closed, it is started
+// by the reader of the message channel
+func (b *Bot) SendEvents(quit <-chan struct{}) {
 	maxUser := 0
 
 	for {
-		eventsText := b.RootLineUp.Events(time.Now())
-
-		users := b.users.UsersWithNotifications()
+		b.lock()
+		maxUser = b.sendEvents(b.clock.Now(), maxUser)
+		finished := b.config.Demo && b.RootLineUp.AllSetsFinished()
+		b.unlock()
+
+		select {
+		case <-quit:
+			return
+		case <-time.After(1 * time.Second):
+		}
 
-		newUsers, totalUsers, _, _ := b.users.UsersStats()
+		if finished {
+			panic("demo mode and all sets finished")
+		}
+	}
+}
 
-		if totalUsers > maxUser {
-			maxUser = totalUsers
-			b.SendAdminsMessage(fmt.Sprintf("New max active users: %d new users: %d", maxUser, newUsers))
+// sendEvents queues the notifications of the sets starting at now, it returns the max number of active users
+func (b *Bot) sendEvents(now time.Time, maxUser int) int {
+	started := b.RootLineUp.StartedEvents(now)
+	eventsText := lineUp.PrintEvents(started)
+	if len(started) != 0 {
+		b.publish(StreamStarted, StreamStartedSets{Version: b.lineUpVersion, Events: started})
+		b.queuePushEvents(started)
+	}
+	upcomingSets := b.RootLineUp.UpcomingSets(now, time.Duration(b.config.LikesNotificationMinutes)*time.Minute)
+
+	likes := b.users.UsersWithLikedDjs()
+	users := []int64{}
+	for _, v := range b.users.UsersWithNotifications() {
+		// users having liked djs are only notified for their djs
+		if _, ok := likes[v]; !ok {
+			users = append(users, v)
 		}
+	}
 
-		if eventsText != "" {
+	newUsers, totalUsers, _, _ := b.users.UsersStats()
 
-			log.Debug().Msg(fmt.Sprintf("sending %d events", len(users)))
-			for _, v := range users {
-				msgForUser := eventsText
-				if v > 0 { // SKIP pour les groups
-					log.Debug().Msg(fmt.Sprintf("sending event for %v", v))
-					b.sendMessage(v, msgForUser)
-				} else {
-					log.Debug().Msg(fmt.Sprintf("skipped sending event for %v", v))
+	if totalUsers > maxUser {
+		maxUser = totalUsers
+		b.sendAdminsMessage(fmt.Sprintf("New max active users: %d new users: %d", maxUser, newUsers))
+	}
+
+	if eventsText != "" {
+
+		log.Debug().Msg(fmt.Sprintf("sending %d events", len(users)))
+		for _, v := range users {
+			msgForUser := eventsText
+			if v > 0 { // SKIP pour les groups
+				log.Debug().Msg(fmt.Sprintf("sending event for %v", v))
+				b.sendMessage(v, msgForUser)
+			} else {
+				log.Debug().Msg(fmt.Sprintf("skipped sending event for %v", v))
+			}
+		}
+	}
+
+	if len(upcomingSets) != 0 {
+		// the sets notified are saved, a restart doesn't notify them again
+		b.dirtyRoot = true
+		if err := b.save(); err != nil {
+			log.Error().Msg(err.Error())
+		}
+		for userId, djs := range likes {
+			if userId <= 0 { // SKIP pour les groups
+				continue
+			}
+			for _, set := range upcomingSets {
+				for _, dj := range djs {
+					if set.Dj == dj {
+						log.Debug().Msg(fmt.Sprintf("sending liked dj %v for %v", dj, userId))
+						b.sendMessage(userId, likedDjMessage(set, now))
+					}
 				}
 			}
 		}
-		time.Sleep(1 * time.Second)
+	}
+	return maxUser
+}
 
-		if b.config.Demo {
-			if b.RootLineUp.AllSetsFinished() {
+func likedDjMessage(set lineUp.Set, now time.Time) string {
+	minutes := int(set.Start.Sub(now).Round(time.Minute).Minutes())
+	if minutes <= 0 {
+		return fmt.Sprintf(likedDjStartedMessage, set.Dj, set.Room)
+	}
+	return fmt.Sprintf(likedDjStartsMessage, set.Dj, minutes, set.Room)
+}
 
-				panic("demo mode and all sets finished")
+func (b *Bot) like(chatId int64, lineup *lineUp.LineUp, arg string) string {
+	if arg == "" || arg == likeCommand {
+		return b.printLikes(chatId)
+	}
+	djs := lineup.FindDJNames(arg)
+	for _, v := range djs {
+		if strings.EqualFold(v, arg) {
+			djs = []string{v}
+			break
+		}
+	}
+	switch len(djs) {
+	case 0:
+		return fmt.Sprintf(likeNotFoundMessage, arg)
+	case 1:
+		err := b.users.LikeDj(chatId, djs[0])
+		if err != nil {
+			log.Error().Msg(err.Error())
+		}
+		return fmt.Sprintf(likedMessage, djs[0], b.config.LikesNotificationMinutes)
+	default:
+		return fmt.Sprintf(likedSeveralMessage, arg, strings.Join(djs, "\n"))
+	}
+}
+
+func (b *Bot) unlike(chatId int64, lineup *lineUp.LineUp, arg string) string {
+	liked := b.users.LikedDjs(chatId)
+	if arg == "" || arg == unlikeCommand || len(liked) == 0 {
+		return b.printLikes(chatId)
+	}
+	candidates := []string{}
+	for _, v := range liked {
+		if strings.EqualFold(v, arg) {
+			candidates = []string{v}
+			break
+		}
+		for _, dj := range lineup.FindDJNames(arg) {
+			if dj == v {
+				candidates = append(candidates, v)
 			}
 		}
 	}
+	switch len(candidates) {
+	case 0:
+		return fmt.Sprintf(likeNotFoundMessage, arg)
+	case 1:
+		err := b.users.UnlikeDj(chatId, candidates[0])
+		if err != nil {
+			log.Error().Msg(err.Error())
+		}
+		return fmt.Sprintf(unlikedMessage, candidates[0])
+	default:
+		return fmt.Sprintf(likedSeveralMessage, arg, strings.Join(candidates, "\n"))
+	}
+}
+
+func (b *Bot) calendarUrl() string {
+	return b.config.ApiUrl + "/api/lineup/" + url.PathEscape(b.config.Meta.Prefix) + "/calendar"
+}
+
+func (b *Bot) printCalendarLinks() string {
+	if b.config.ApiUrl == "" {
+		return noIcsMessage
+	}
+	rooms := ""
+	for _, v := range b.config.Lineup.Rooms {
+		rooms += v + " " + b.calendarUrl() + "/" + url.PathEscape(v) + ".ics\n"
+	}
+	return fmt.Sprintf(icsMessage, b.calendarUrl()+".ics", rooms)
+}
+
+func (b *Bot) printLikes(chatId int64) string {
+	liked := b.users.LikedDjs(chatId)
+	if len(liked) == 0 {
+		return noLikesMessage
+	}
+	return fmt.Sprintf(likesMessage, strings.Join(liked, "\n"))
 }
 
 var nonAlphanumericRegex = regexp.MustCompile(`[^a-zA-Z0-9 ]+`)
 
 func (b *Bot) parseCommand(chatId int64, str string) (string, string) {
 
-	lineup := b.GetLineUpForUser(chatId)
+	lineup := b.getLineUpForUser(chatId)
 	command := str
 	arg := strings.ToLower(nonAlphanumericRegex.ReplaceAllString(str, ""))
 	if strings.Contains(str, " ") {
@@ -452,13 +704,16 @@ func (b *Bot) parseCommand(chatId int64, str string) (string, string) {
 }
 
 func (b *Bot) DeleteUser(chatId int64) error {
+	b.lock()
+	defer b.unlock()
 	return b.users.DeleteUser(chatId)
 }
 
-func (b *Bot) ShowRoom(chatId int64, lineup *lineUp.LineUp, index int) string {
+func (b *Bot) showRoom(chatId int64, lineup *lineUp.LineUp, index int) string {
 	if b.magicRoomButton {
 		b.users.UpdateMagicButtons(chatId, index, len(b.config.Lineup.Rooms))
 	}
+	b.analytics.Room(b.config.Lineup.Rooms[index])
 	return lineup.Print(b.config.Meta.RoomYouAreHereEmoticon, b.config.Lineup.Rooms[index])
 }
 
@@ -466,7 +721,7 @@ func (b *Bot) defaultCommand(orig string, lineup *lineUp.LineUp, chatId int64) s
 
 	for index, room := range b.roomsEmoticons {
 		if orig == room {
-			return b.ShowRoom(chatId, lineup, index)
+			return b.showRoom(chatId, lineup, index)
 		}
 	}
 
@@ -484,13 +739,16 @@ func (b *Bot) defaultCommand(orig string, lineup *lineUp.LineUp, chatId int64) s
 	}
 	index, room := lineup.FindRoom(orig, distance)
 	if room != "" {
-		return b.ShowRoom(chatId, lineup, index)
+		return b.showRoom(chatId, lineup, index)
 	} else {
-		return lineup.FindDJ(orig, time.Now())
+		for _, dj := range lineup.FindDJNames(orig) {
+			b.analytics.Dj(dj)
+		}
+		return lineup.FindDJ(orig, b.clock.Now())
 	}
 }
 
-func (b Bot) GetLineUpForUser(chatId int64) *lineUp.LineUp {
+func (b *Bot) getLineUpForUser(chatId int64) *lineUp.LineUp {
 	l, ok := b.UsersLineUps[chatId]
 	if ok {
 		log.Debug().Msg(fmt.Sprintf("using local lineup for user %v", chatId))
@@ -499,7 +757,13 @@ func (b Bot) GetLineUpForUser(chatId int64) *lineUp.LineUp {
 	return b.RootLineUp
 }
 
-func (b Bot) PrintLineupForCheckConfig() string {
+func (b *Bot) PrintLineupForCheckConfig() string {
+	b.lock()
+	defer b.unlock()
+	return b.printLineupForCheckConfig()
+}
+
+func (b *Bot) printLineupForCheckConfig() string {
 	res := "\n\nLineup in each room:\n"
 	for _, v := range b.config.Lineup.Rooms {
 		res += b.RootLineUp.PrintForMerge(v)
@@ -507,7 +771,7 @@ func (b Bot) PrintLineupForCheckConfig() string {
 	return res
 }
 
-func (b Bot) compareLineUps(lineupA, lineupB *lineUp.LineUp) (string, error) {
+func (b *Bot) compareLineUps(lineupA, lineupB *lineUp.LineUp) (string, error) {
 	log.Debug().Msg("*** compareLineUps")
 
 	dmp := diffmatchpatch.New()
@@ -546,36 +810,69 @@ func (b Bot) compareLineUps(lineupA, lineupB *lineUp.LineUp) (string, error) {
 	return res, err
 }
 
+// NewMergeRequest returns a merge request without ID, the ID and the creation time are given by CreateMergeRequest
 func NewMergeRequest(beginningSchedule time.Time, changes []inputs.InputCommandResultSet, chatId int64, user string, answer string) *MergeRequests {
 	mr := MergeRequests{
 		Changes:           changes,
 		UserId:            chatId,
 		User:              user,
-		Created:           time.Now(),
-		ID:                mergeRequestID,
 		Info:              answer,
 		BeginningSchedule: beginningSchedule,
 	}
-	mergeRequestID++
 	return &mr
 }
 
 func (b *Bot) ProcessCommand(chatId int64, text, user string) []Message {
+	b.lock()
+	defer b.unlock()
 	command, arg := b.parseCommand(chatId, text)
 	log.Debug().Msg(fmt.Sprintf("%v sent <%v> command <%v> arg <%v>", user, text, command, arg))
 	return b.runCommand(chatId, command, arg, text, user)
 }
 
-func (b *Bot) CreateMergeRequest(mr MergeRequests) {
-	b.UsersMergeRequest = append(b.UsersMergeRequest, mr)
+func (b *Bot) CreateMergeRequest(mr *MergeRequests) {
+	b.lock()
+	defer b.unlock()
+	b.createMergeRequest(mr)
+}
+
+// SubmitMergeRequest checks a merge request and creates it, all of it holding the lock so two
+// identical merge requests sent at the same time can't both pass the duplicate check
+func (b *Bot) SubmitMergeRequest(mr *MergeRequests) error {
+	b.lock()
+	defer b.unlock()
+	err := b.checForDuplicateMergeRequest(mr)
+	if err != nil {
+		return err
+	}
+	_, err = b.checkMergeRequest(mr)
+	if err != nil {
+		return err
+	}
+	b.createMergeRequest(mr)
+	return nil
+}
+
+func (b *Bot) createMergeRequest(mr *MergeRequests) {
+	mr.Created = b.clock.Now()
+	err := b.mergeRequests.Add(mr)
+	if err != nil {
+		log.Error().Msg(err.Error())
+	}
 	modoMsg := fmt.Sprintf("new merge request #%d from %v, use /rebase command to merge\n%v", mr.ID, mr.User, mr.Info)
 	log.Debug().Msg(fmt.Sprintf("new merge request from %v <%v>", mr.User, mr))
 	log.Debug().Msg(modoMsg)
-	b.SendModosMessage(modoMsg)
+	b.sendModosMessage(modoMsg, [][]InlineButton{{reviewButton(mr.ID)}})
 }
 
-func (b Bot) ChecForDuplicateMergeRequest(r *MergeRequests) error {
-	for _, mr := range b.UsersMergeRequest {
+func (b *Bot) ChecForDuplicateMergeRequest(r *MergeRequests) error {
+	b.lock()
+	defer b.unlock()
+	return b.checForDuplicateMergeRequest(r)
+}
+
+func (b *Bot) checForDuplicateMergeRequest(r *MergeRequests) error {
+	for _, mr := range b.mergeRequests.Pending() {
 		if len(mr.Changes) == len(r.Changes) {
 			foundDifference := false
 			for i := range mr.Changes {
@@ -592,16 +889,20 @@ func (b Bot) ChecForDuplicateMergeRequest(r *MergeRequests) error {
 	return nil
 }
 
-func (b Bot) CheckMergeRequest(r *MergeRequests) (string, error) {
+func (b *Bot) CheckMergeRequest(r *MergeRequests) (string, error) {
+	b.lock()
+	defer b.unlock()
+	return b.checkMergeRequest(r)
+}
+
+func (b *Bot) checkMergeRequest(r *MergeRequests) (string, error) {
 	var answer string
 	var err error
 
 	l := b.RootLineUp.DuplicateLineUp()
 	answer += fmt.Sprintf("Merge request %d from %v (submitted %v)\n\n", r.ID, r.User, r.Created.Format("Mon 15:04"))
 	for _, v := range r.Changes {
-		s := l.NewSet(v.Dj, v.Room, v.Day, v.Hour, v.Minute, v.Duration, nil)
-		log.Debug().Msg("added " + l.PrintSetOldFormat(s) + "\n")
-		log.Debug().Msg(l.AddSet(s))
+		log.Debug().Msg(l.ApplyChange(v))
 	}
 	compare, err := b.compareLineUps(b.RootLineUp, l)
 	answer += compare
@@ -609,6 +910,283 @@ func (b Bot) CheckMergeRequest(r *MergeRequests) (string, error) {
 	return answer, err
 }
 
+// describeChanges returns a line per change of a merge request, shown to the moderators
+func describeChanges(l *lineUp.LineUp, changes []inputs.InputCommandResultSet) string {
+	res := ""
+	for _, v := range changes {
+		s := l.NewSet(v.Dj, v.Room, v.Day, v.Hour, v.Minute, v.Duration, nil)
+		action := "add"
+		if v.Kind == inputs.ChangeRemove {
+			action = "remove"
+		}
+		res += fmt.Sprintf("%v %v in %v %v-%v\n", action, s.Dj, s.Room, s.Start.Format("Mon 15:04"), s.End.Format("15:04"))
+	}
+	return res
+}
+
+func printMergeRequest(mr MergeRequests) string {
+	res := fmt.Sprintf("#%d from %v (submitted %v, %d changes)", mr.ID, mr.User, mr.Created.Format("Mon 15:04"), len(mr.Changes))
+	if mr.Status != mergeRequests.StatusPending {
+		res += fmt.Sprintf(" %v by %v %v", mr.Status, mr.DecidedBy, mr.Decided.Format("Mon 15:04"))
+	}
+	return res + "\n"
+}
+
+// printMergeRequests returns the pending merge requests and the last decisions of the moderators
+func (b *Bot) printMergeRequests() string {
+	res := "Pending merge requests:\n"
+	pending := b.mergeRequests.Pending()
+	if len(pending) == 0 {
+		res += "none\n"
+	}
+	for _, v := range pending {
+		res += printMergeRequest(v)
+	}
+	decided := b.mergeRequests.Decided()
+	if len(decided) != 0 {
+		res += "\nLast decisions:\n"
+	}
+	for i, v := range decided {
+		if i == maxDecidedMergeRequests {
+			break
+		}
+		res += printMergeRequest(v)
+	}
+	return res
+}
+
+// AcceptMergeRequest applies the changes of a pending merge request on the root lineup
+func (b *Bot) AcceptMergeRequest(id int, user string, userId int64) (MergeRequests, error) {
+	b.lock()
+	defer b.unlock()
+	return b.acceptMergeRequest(id, user, userId)
+}
+
+func (b *Bot) acceptMergeRequest(id int, user string, userId int64) (MergeRequests, error) {
+	r, err := b.mergeRequests.Decide(id, mergeRequests.StatusAccepted, user, userId, b.clock.Now())
+	if err != nil {
+		return r, err
+	}
+	previous := b.RootLineUp.DuplicateLineUp()
+	for _, v := range r.Changes {
+		log.Debug().Msg(b.RootLineUp.ApplyChange(v))
+	}
+	b.dirtyRoot = true
+	b.publishLineUp(previous)
+	b.sendMessage(r.UserId, fmt.Sprintf(MergedMessageAccepted, r.ID, user))
+	return r, nil
+}
+
+func (b *Bot) RefuseMergeRequest(id int, user string, userId int64) (MergeRequests, error) {
+	b.lock()
+	defer b.unlock()
+	return b.refuseMergeRequest(id, user, userId)
+}
+
+func (b *Bot) refuseMergeRequest(id int, user string, userId int64) (MergeRequests, error) {
+	r, err := b.mergeRequests.Decide(id, mergeRequests.StatusRefused, user, userId, b.clock.Now())
+	if err != nil {
+		return r, err
+	}
+	b.sendMessage(r.UserId, fmt.Sprintf(MergedMessageRefused, r.ID, user))
+	return r, nil
+}
+
+func (b *Bot) GetMergeRequest(id int) (MergeRequests, bool) {
+	b.lock()
+	defer b.unlock()
+	return b.mergeRequests.Get(id)
+}
+
+// GetMergeRequests returns the pending merge requests followed by the decided ones
+func (b *Bot) GetMergeRequests() []MergeRequests {
+	b.lock()
+	defer b.unlock()
+	return append(b.mergeRequests.Pending(), b.mergeRequests.Decided()...)
+}
+
+// MergeRequestDiff returns the changes a merge request would make on the root lineup
+func (b *Bot) MergeRequestDiff(mr MergeRequests) lineUp.LineUpDiff {
+	b.lock()
+	defer b.unlock()
+	l := b.RootLineUp.DuplicateLineUp()
+	for _, v := range mr.Changes {
+		log.Debug().Msg(l.ApplyChange(v))
+	}
+	return lineUp.Diff(b.RootLineUp, l)
+}
+
+// parseMergeRequestIds returns the pending merge requests matching the ids in arg (i.e "/rebase 3 #5")
+func (b *Bot) parseMergeRequestIds(arg string) ([]MergeRequests, error) {
+	res := []MergeRequests{}
+	for _, v := range rebaseIdsRegex.FindAllString(arg, -1) {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		mr, ok := b.mergeRequests.Get(id)
+		if !ok || mr.Status != mergeRequests.StatusPending {
+			return nil, fmt.Errorf(rebaseUnknownMessage, id)
+		}
+		res = append(res, mr)
+	}
+	return res, nil
+}
+
+// mergeRequestsConflicts returns the sets of a and b colliding in the same room, a set removed
+// by both isn't a conflict
+func (b *Bot) mergeRequestsConflicts(mrA, mrB MergeRequests) string {
+	res := ""
+	for _, v := range mrA.Changes {
+		setA := b.RootLineUp.NewSet(v.Dj, v.Room, v.Day, v.Hour, v.Minute, v.Duration, nil)
+		for _, v2 := range mrB.Changes {
+			if v.Kind == inputs.ChangeRemove && v2.Kind == inputs.ChangeRemove {
+				// removing a set twice gives the same lineup
+				continue
+			}
+			setB := b.RootLineUp.NewSet(v2.Dj, v2.Room, v2.Day, v2.Hour, v2.Minute, v2.Duration, nil)
+			if setA.Collides(setB) {
+				res += fmt.Sprintf(rebaseConflictMessage, mrA.ID, mrB.ID, setA.Room+" "+printTimeWithDay(setA.Start)+" to "+setA.End.Format("15:04"))
+			}
+		}
+	}
+	return res
+}
+
+func printTimeWithDay(t time.Time) string {
+	return t.Format("Mon 15:04")
+}
+
+// printRebaseConflicts returns the conflicts between the reviewed merge requests and the other pending ones
+func (b *Bot) printRebaseConflicts(reviewed []MergeRequests) string {
+	res := ""
+	for _, mr := range reviewed {
+		for _, other := range b.mergeRequests.Pending() {
+			if other.ID == mr.ID {
+				continue
+			}
+			res += b.mergeRequestsConflicts(mr, other)
+		}
+	}
+	return res
+}
+
+func (b *Bot) rebase(chatId int64, lineup *lineUp.LineUp, arg, user string) (string, []string, bool) {
+	answer := ""
+	pending := b.mergeRequests.Pending()
+
+	if lineup.CurrentInputCommand(chatId) == "" {
+		if len(pending) == 0 {
+			return rebaseCommandErrorMessage, nil, false
+		}
+		selected, err := b.parseMergeRequestIds(arg)
+		if err != nil {
+			return err.Error(), nil, false
+		}
+		if len(selected) == 0 {
+			if len(pending) != 1 {
+				buttons := []string{}
+				answer = rebaseChooseMessage
+				for _, v := range pending {
+					answer += printMergeRequest(v)
+					buttons = append(buttons, fmt.Sprintf("/%v %d", inputs.RebaseCommand, v.ID))
+				}
+				return answer, buttons, false
+			}
+			selected = pending
+		}
+
+		l := b.RootLineUp.DuplicateLineUp()
+		for _, mr := range selected {
+			answer += fmt.Sprintf("Merge request %d from %v (submitted %v)\n\n", mr.ID, mr.User, mr.Created.Format("Mon 15:04"))
+			for _, v := range mr.Changes {
+				log.Debug().Msg(l.ApplyChange(v))
+			}
+		}
+		compare, err := b.compareLineUps(b.RootLineUp, l)
+		if err != nil {
+			log.Error().Msg(fmt.Sprintf("CheckMergeRequest %v", err.Error()))
+		}
+		answer += compare
+		answer += b.printRebaseConflicts(selected)
+
+		ids := []int{}
+		for _, mr := range selected {
+			ids = append(ids, mr.ID)
+		}
+		b.rebasing[chatId] = ids
+
+		newLineup, inputCommandResult := lineup.InputCommand(chatId, inputs.RebaseCommand)
+		if newLineup != lineup {
+			log.Error().Msg(fmt.Sprintf("new lineup on rebase command %d", chatId))
+		}
+		answer += inputCommandResult.Answer
+		return answer, inputCommandResult.Buttons, true
+	}
+
+	newLineup, inputCommandResult := lineup.InputCommand(chatId, arg)
+	if newLineup != lineup {
+		log.Error().Msg(fmt.Sprintf("new lineup on rebase command %d", chatId))
+	}
+	ids := b.rebasing[chatId]
+	if inputCommandResult.Answer == inputs.RebaseAcceptMessage || inputCommandResult.Answer == inputs.RebaseRefuseMessage {
+		delete(b.rebasing, chatId)
+	}
+	if len(ids) == 0 {
+		// the merge requests reviewed were lost (i.e restart), leave the rebase step
+		lineup.CancelInput(chatId)
+		return rebaseCommandErrorMessage, nil, false
+	}
+
+	decided := ""
+	accepted := []MergeRequests{}
+	for _, id := range ids {
+		switch inputCommandResult.Answer {
+		case inputs.RebaseAcceptMessage:
+			r, err := b.acceptMergeRequest(id, user, chatId)
+			if err != nil {
+				log.Error().Msg(err.Error())
+				decided += err.Error() + "\n"
+				continue
+			}
+			accepted = append(accepted, r)
+		case inputs.RebaseRefuseMessage:
+			_, err := b.refuseMergeRequest(id, user, chatId)
+			if err != nil {
+				log.Error().Msg(err.Error())
+				decided += err.Error() + "\n"
+				continue
+			}
+		default:
+			log.Debug().Msg(fmt.Sprintf("answer returned from inputCommand <%v>", inputCommandResult.Answer))
+		}
+	}
+
+	answer = decided + inputCommandResult.Answer
+	remaining := b.mergeRequests.Pending()
+	if len(remaining) == 0 {
+		answer += " (No more merge request pending)"
+	} else {
+		answer += fmt.Sprintf(" (Remaining merge requests: %d)", len(remaining))
+	}
+
+	// the pending merge requests colliding with the accepted ones are diffed again against the updated root lineup
+	for _, mr := range accepted {
+		for _, other := range remaining {
+			conflicts := b.mergeRequestsConflicts(mr, other)
+			if conflicts == "" {
+				continue
+			}
+			compare, err := b.checkMergeRequest(&other)
+			if err != nil {
+				compare += err.Error() + "\n"
+			}
+			answer += "\n\n" + conflicts + compare
+		}
+	}
+	return answer, inputCommandResult.Buttons, len(accepted) != 0
+}
+
 func (b *Bot) getMapImageMessage(chatId int64, always bool) (Message, error) {
 	res := Message{}
 	shown, err := b.users.MapImageShown(chatId)
@@ -640,7 +1218,11 @@ func (b *Bot) runCommand(chatId int64, command, arg, orig string, user string) [
 	answer := ""
 	var buttons []string
 	res := ""
-	lineUp := b.GetLineUpForUser(chatId)
+	lineUp := b.getLineUpForUser(chatId)
+	commandsTotal.Inc(b.config.Meta.Prefix, commandLabel(command))
+	b.visit(chatId, command)
+	// saved by the commands changing the lineups
+	b.setDirty(chatId)
 
 	if !b.users.DoesUserExists(chatId) {
 		log.Info().Msg("new user")
@@ -693,6 +1275,20 @@ func (b *Bot) runCommand(chatId int64, command, arg, orig string, user string) [
 			log.Error().Msg(err.Error())
 		}
 		answer = startedNoticationsMessage
+	case likeCommand:
+		answer = b.like(chatId, lineUp, strings.TrimSpace(arg))
+	case unlikeCommand:
+		answer = b.unlike(chatId, lineUp, strings.TrimSpace(arg))
+	case likesCommand:
+		answer = b.printLikes(chatId)
+	case icsCommand:
+		answer = b.printCalendarLinks()
+	case mrsCommand:
+		if b.IsModo(chatId) {
+			answer = b.printMergeRequests()
+		} else {
+			answer = b.defaultCommand(orig, lineUp, chatId)
+		}
 	case "p", "all":
 		res += lineUp.Print(b.config.Meta.RoomYouAreHereEmoticon, "")
 		answer = res
@@ -711,9 +1307,23 @@ func (b *Bot) runCommand(chatId int64, command, arg, orig string, user string) [
 		} else {
 			answer = b.defaultCommand(orig, lineUp, chatId)
 		}
+	case announceCommand:
+		if !b.IsAdmin(chatId) {
+			answer = b.defaultCommand(orig, lineUp, chatId)
+		} else if strings.TrimSpace(arg) == "" || arg == announceCommand {
+			answer = announceUsageMessage
+		} else {
+			answer = fmt.Sprintf(announcedMessage, b.announce(strings.TrimSpace(arg)))
+		}
+	case statsCommand:
+		if b.IsAdmin(chatId) {
+			answer = b.analytics.Report().Print()
+		} else {
+			answer = b.defaultCommand(orig, lineUp, chatId)
+		}
 	case "print":
 		if b.IsAdmin(chatId) {
-			answer = b.PrintLineupForCheckConfig()
+			answer = b.printLineupForCheckConfig()
 		} else {
 			answer = b.defaultCommand(orig, lineUp, chatId)
 		}
@@ -733,60 +1343,10 @@ func (b *Bot) runCommand(chatId int64, command, arg, orig string, user string) [
 		} else {
 			answer = b.defaultCommand(orig, lineUp, chatId)
 		}
-		// TODO checker ce qui se passe si 2 users se mettent en rebase en meme temps
 	case inputs.RebaseCommand:
 		if b.IsModo(chatId) {
-			if len(b.UsersMergeRequest) == 0 {
-				answer += rebaseCommandErrorMessage
-			} else {
-				switch lineUp.CurrentInputCommand(chatId) {
-				case "":
-
-					a, err := b.CheckMergeRequest(&b.UsersMergeRequest[0])
-					if err != nil {
-						log.Error().Msg(fmt.Sprintf("CheckMergeRequest %v", err.Error()))
-					}
-					answer += a
-					html = true
-					newLineup, inputCommandResult := lineUp.InputCommand(chatId, arg)
-					if newLineup != lineUp {
-						log.Error().Msg(fmt.Sprintf("new lineup on rebase command %d", chatId))
-					}
-					answer += inputCommandResult.Answer
-					buttons = inputCommandResult.Buttons
-				default:
-					newLineup, inputCommandResult := lineUp.InputCommand(chatId, arg)
-					if newLineup != lineUp {
-						log.Error().Msg(fmt.Sprintf("new lineup on rebase command %d", chatId))
-					}
-					switch inputCommandResult.Answer {
-					case inputs.RebaseAcceptMessage:
-						r := b.UsersMergeRequest[0]
-						for _, v := range r.Changes {
-							s := b.RootLineUp.NewSet(v.Dj, v.Room, v.Day, v.Hour, v.Minute, v.Duration, nil)
-							answer += "added " + b.RootLineUp.PrintSetOldFormat(s) + "\n"
-							answer += b.RootLineUp.AddSet(s)
-						}
-						b.UsersMergeRequest = b.UsersMergeRequest[1:]
-						b.sendMessage(r.UserId, fmt.Sprintf(MergedMessageAccepted, r.ID, user))
-					case inputs.RebaseRefuseMessage:
-						r := b.UsersMergeRequest[0]
-						b.UsersMergeRequest = b.UsersMergeRequest[1:]
-						b.sendMessage(r.UserId, fmt.Sprintf(MergedMessageRefused, r.ID, user))
-					default:
-						log.Error().Msg(fmt.Sprintf("unknown answer returned from inputCommand <%v>", inputCommandResult.Answer))
-					}
-					answer = inputCommandResult.Answer
-					if len(b.UsersMergeRequest) == 0 {
-						answer += " (No more merge request pending)"
-					} else {
-						answer += fmt.Sprintf(" (Remaining merge requests: %d)", len(b.UsersMergeRequest))
-					}
-					buttons = inputCommandResult.Buttons
-				}
-				b.Save()
-			}
-			//answer += fmt.Sprintf("%v", b.UsersMergeRequest)
+			answer, buttons, html = b.rebase(chatId, lineUp, arg, user)
+			b.save()
 		} else {
 			answer = b.defaultCommand(orig, lineUp, chatId)
 		}
@@ -817,11 +1377,13 @@ func (b *Bot) runCommand(chatId int64, command, arg, orig string, user string) [
 					lineUp = newLineup
 					b.UsersLineUps[chatId] = newLineup
 				}
+				answer = inputCommandResult.Answer
+				buttons = inputCommandResult.Buttons
 				switch inputCommandResult.Answer {
 				// reponse a merge
 				case inputs.MergeSubmitMessage:
-					mr := NewMergeRequest(b.config.Lineup.BeginningSchedule, newLineup.Changes, chatId, user, answer)
-					b.CreateMergeRequest(*mr)
+					mr := NewMergeRequest(b.config.Lineup.BeginningSchedule, newLineup.Changes, chatId, user, describeChanges(newLineup, newLineup.Changes))
+					b.createMergeRequest(mr)
 					delete(b.UsersLineUps, chatId)
 					lineUp = b.RootLineUp
 					answer += fmt.Sprintf(" (#%d)", mr.ID)
@@ -832,15 +1394,12 @@ func (b *Bot) runCommand(chatId int64, command, arg, orig string, user string) [
 				default:
 					log.Error().Msg(fmt.Sprintf("unknown answer returned from inputCommand <%v>", inputCommandResult.Answer))
 				}
-
-				answer = inputCommandResult.Answer
-				buttons = inputCommandResult.Buttons
 			}
-			b.Save()
+			b.save()
 		} else {
 			answer = b.defaultCommand(orig, lineUp, chatId)
 		}
-	case inputs.InputCommand:
+	case inputs.InputCommand, inputs.EditSetCommand, inputs.RemoveSetCommand:
 		if b.config.BotAllowInput || b.IsAdmin(chatId) {
 			newLineup, inputCommandResult := lineUp.InputCommand(chatId, arg)
 			if newLineup != lineUp {
@@ -850,7 +1409,7 @@ func (b *Bot) runCommand(chatId int64, command, arg, orig string, user string) [
 			}
 			answer = inputCommandResult.Answer
 			buttons = inputCommandResult.Buttons
-			b.Save()
+			b.save()
 		} else {
 			answer = b.defaultCommand(orig, lineUp, chatId)
 		}
@@ -867,9 +1426,12 @@ func (b *Bot) runCommand(chatId int64, command, arg, orig string, user string) [
 			}
 			answer += inputCommandResult.Answer
 			buttons = inputCommandResult.Buttons
-			b.Save()
+			b.save()
 			newUsers, totalUsers, deleted, notifications := b.users.UsersStats()
 			answer += fmt.Sprintf("TotalUsers: %d new:%d deleted:%d notifs:%d", totalUsers, newUsers, deleted, notifications)
+			if b.queueStats != nil {
+				answer += "\n" + b.queueStats()
+			}
 		} else {
 			answer = b.defaultCommand(orig, lineUp, chatId)
 		}
@@ -878,11 +1440,11 @@ func (b *Bot) runCommand(chatId int64, command, arg, orig string, user string) [
 	}
 
 	if adminMsg != "" {
-		b.SendAdminsMessage(adminMsg)
+		b.sendAdminsMessage(adminMsg)
 	}
 
 	if len(buttons) == 0 {
-		buttons = b.GetButtonsForUser(chatId)
+		buttons = b.getButtonsForUser(chatId)
 	}
 
 	if lineUp != b.RootLineUp && !lineUp.IsUserInputing(chatId) {
@@ -899,10 +1461,11 @@ func (b *Bot) runCommand(chatId int64, command, arg, orig string, user string) [
 
 	if answer != "" && answer != "\n" {
 		messages = append(messages, Message{
-			Text:    answer,
-			Buttons: buttons,
-			UserID:  chatId,
-			Html:    html,
+			Text:          answer,
+			Buttons:       buttons,
+			UserID:        chatId,
+			Html:          html,
+			InlineButtons: b.inlineButtons(chatId, lineUp, buttons),
 		})
 	} else {
 		log.Warn().Msg("skipped empty message")
@@ -918,8 +1481,8 @@ func (b *Bot) runCommand(chatId int64, command, arg, orig string, user string) [
 	return splitMessages(messages)
 }
 
-func (b Bot) GetButtonsForUser(chatId int64) []string {
-	lineUp := b.GetLineUpForUser(chatId)
+func (b *Bot) getButtonsForUser(chatId int64) []string {
+	lineUp := b.getLineUpForUser(chatId)
 	if lineUp.IsUserInputing(chatId) {
 		return nil
 	}
@@ -953,7 +1516,7 @@ func (b Bot) GetButtonsForUser(chatId int64) []string {
 	if lineUp != b.RootLineUp {
 		buttons = append(buttons, inputs.MergeCommand)
 	}
-	if b.IsModo(chatId) && len(b.UsersMergeRequest) != 0 {
+	if b.IsModo(chatId) && len(b.mergeRequests.Pending()) != 0 {
 		buttons = append(buttons, inputs.RebaseCommand)
 	}
 	if b.IsAdmin(chatId) {
@@ -963,9 +1526,11 @@ func (b Bot) GetButtonsForUser(chatId int64) []string {
 }
 
 func (b *Bot) GroupChange(chatId int64, userString, group string) {
+	b.lock()
+	defer b.unlock()
 	msg := fmt.Sprintf("%v userString:%v group:%v", chatId, userString, group)
 	if !b.users.DoesUserExists(chatId) {
-		b.SendAdminsMessage(msg)
+		b.sendAdminsMessage(msg)
 	} else {
 		log.Debug().Msg(msg)
 	}
@@ -2,13 +2,16 @@ package bot
 
 import (
 	"fmt"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/clock"
 	"github.com/shallowBunny/app/be/internal/infrastructure/config"
 	DaoDb "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoDb"
 	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
@@ -194,7 +197,7 @@ func TestInputMergeAndRebase(t *testing.T) {
 	}
 
 	// test the events on the user lineup
-	lu := bot.GetLineUpForUser(userID)
+	lu := bot.getLineUpForUser(userID)
 	if lu == bot.RootLineUp {
 		t.Fatalf("no new lineup created for user after input")
 	}
@@ -343,11 +346,11 @@ func TestInputMultipleMergeAndRebase(t *testing.T) {
 `
 
 	// dump the root lineUp
-	if bot.GetLineUpForUser(userID) != bot.GetLineUpForUser(adminID) {
+	if bot.getLineUpForUser(userID) != bot.getLineUpForUser(adminID) {
 		t.Fatalf("user and admin lineup are different")
 	}
 
-	got := bot.GetLineUpForUser(userID).Dump()
+	got := bot.getLineUpForUser(userID).Dump()
 	if !reflect.DeepEqual(dumpBotModified, got) {
 		t.Fatalf("expected: <%v>, got: <%v>", dumpBotModified, got)
 	}
@@ -461,3 +464,310 @@ func TestUpdateLineUp(t *testing.T) {
 	assert.JSONEq(t, expectedResponse, w.Body.String())
 }
 */
+
+func TestRebaseById(t *testing.T) {
+
+	config, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tt := timeTests
+	currentTime := time.Date(tt.Year(), tt.Month(), tt.Day(), 0, 0, 0, 0, tt.Location())
+	config.Lineup.BeginningSchedule = currentTime
+	currentTime = currentTime.Add(24 * time.Hour)
+	var userID1 int64 = 123
+	var userID2 int64 = 124
+
+	bot := New(DaoMem.New(), config)
+	bot.channel = nil
+
+	// two users submitting colliding sets
+	commands := []struct {
+		userID int64
+		text   string
+	}{
+		{userID1, inputs.InputCommand}, {userID1, "🍵"}, {userID1, currentTime.Format("Mon")}, {userID1, "2:30"}, {userID1, "DJ FART"}, {userID1, "90"}, {userID1, inputs.ValidateCommand},
+		{userID1, inputs.MergeCommand}, {userID1, inputs.MergeSubmitCommand},
+		{userID2, inputs.InputCommand}, {userID2, "🍵"}, {userID2, currentTime.Format("Mon")}, {userID2, "3:00"}, {userID2, "DJ PROUT"}, {userID2, "60"}, {userID2, inputs.ValidateCommand},
+		{userID2, inputs.MergeCommand}, {userID2, inputs.MergeSubmitCommand},
+	}
+	submitted := []string{}
+	for _, tc := range commands {
+		answer := bot.ProcessCommand(tc.userID, tc.text, "test")
+		if tc.text == inputs.MergeSubmitCommand && len(answer) != 0 {
+			submitted = append(submitted, answer[0].Text)
+		}
+	}
+	if len(bot.mergeRequests.Pending()) != 2 {
+		t.Fatalf("expected 2 pending merge requests, got %v", bot.mergeRequests.Pending())
+	}
+	// the submitters get the id, the moderators the changes
+	for i, dj := range []string{"DJ FART", "DJ PROUT"} {
+		if want := fmt.Sprintf("%v (#%d)", inputs.MergeSubmitMessage, i+1); len(submitted) <= i || submitted[i] != want {
+			t.Fatalf("expected <%v>, got %v", want, submitted)
+		}
+		mr, _ := bot.mergeRequests.Get(i + 1)
+		if !strings.HasPrefix(mr.Info, "add "+dj+" in 🍵 "+currentTime.Format("Mon")) {
+			t.Fatalf("expected the changes in the info, got <%v>", mr.Info)
+		}
+	}
+
+	// without id the moderator gets the list
+	answer := bot.ProcessCommand(adminID, inputs.RebaseCommand, "modo")
+	if len(answer) == 0 || !reflect.DeepEqual(answer[0].Buttons, []string{"/rebase 1", "/rebase 2"}) {
+		t.Fatalf("expected buttons for each merge request, got %v", answer)
+	}
+
+	// review the second one first
+	answer = bot.ProcessCommand(adminID, "/rebase 2", "modo")
+	if len(answer) == 0 || !strings.Contains(answer[0].Text, "⚠️ #2 and #1 both change 🍵") {
+		t.Fatalf("expected conflict warning, got %v", answer)
+	}
+	bot.ProcessCommand(adminID, inputs.RebaseAcceptCommand, "modo")
+
+	pending := bot.mergeRequests.Pending()
+	if len(pending) != 1 || pending[0].ID != 1 {
+		t.Fatalf("expected #1 still pending, got %v", pending)
+	}
+	mr, _ := bot.mergeRequests.Get(2)
+	if mr.DecidedBy != "modo" {
+		t.Fatalf("expected #2 decided by modo, got %v", mr)
+	}
+
+	// unknown or already decided merge request
+	answer = bot.ProcessCommand(adminID, "/rebase 2", "modo")
+	if len(answer) == 0 || answer[0].Text != fmt.Sprintf(rebaseUnknownMessage, 2) {
+		t.Fatalf("expected unknown merge request, got %v", answer)
+	}
+}
+
+func TestMergeRequestsConflicts(t *testing.T) {
+	config, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bot := New(DaoMem.New(), config)
+	bot.channel = nil
+
+	removed := inputs.InputCommandResultSet{Room: "🍵", Dj: "A", Day: 1, Hour: 1, Duration: 60, Kind: inputs.ChangeRemove}
+	added := inputs.InputCommandResultSet{Room: "🍵", Dj: "New", Day: 1, Hour: 1, Minute: 30, Duration: 60}
+	for _, tc := range []struct {
+		a, b     inputs.InputCommandResultSet
+		conflict bool
+	}{
+		{removed, removed, false},
+		{removed, added, true},
+		{added, removed, true},
+		{added, added, true},
+	} {
+		mrA := MergeRequests{ID: 1, Changes: []inputs.InputCommandResultSet{tc.a}}
+		mrB := MergeRequests{ID: 2, Changes: []inputs.InputCommandResultSet{tc.b}}
+		if conflicts := bot.mergeRequestsConflicts(mrA, mrB); (conflicts != "") != tc.conflict {
+			t.Fatalf("%v %v: expected conflict %v, got <%v>", tc.a, tc.b, tc.conflict, conflicts)
+		}
+	}
+}
+
+func TestEditAndRemoveSet(t *testing.T) {
+
+	c, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tt := timeTests
+	currentTime := time.Date(tt.Year(), tt.Month(), tt.Day(), 0, 0, 0, 0, tt.Location())
+	c.Lineup.BeginningSchedule = currentTime
+	currentTime = currentTime.Add(24 * time.Hour)
+	var userID int64 = 123
+	// the edited set keeps its links
+	c.Lineup.Sets["🍵"][2].Meta = []config.SetMeta{{Key: "soundcloud", Value: "https://soundcloud.com/c"}}
+
+	bot := New(DaoMem.New(), c)
+	bot.channel = nil
+
+	day := currentTime.Format("Mon")
+	inputCommands := []string{
+		inputs.RemoveSetCommand, "🍵", day + " 02:00 B", inputs.ValidateCommand,
+		inputs.EditSetCommand, "🍵", day + " 03:00 C", day, "03:00", "C2", "30", inputs.ValidateCommand,
+		inputs.MergeCommand, inputs.MergeSubmitCommand,
+	}
+	for _, tc := range inputCommands {
+		answer := bot.ProcessCommand(userID, tc, "test")
+		log.Debug().Msg(fmt.Sprintf("xx %v answer = %v", tc, answer))
+	}
+	for _, tc := range []string{inputs.RebaseCommand, inputs.RebaseAcceptCommand} {
+		bot.ProcessCommand(adminID, tc, "test")
+	}
+
+	want := `🔨:
+- '1 03:00 180 [] E'
+- '1 06:00 180 [] F'
+🍵:
+- '1 01:00 60 [] A'
+# hole: 02:00 to 03:00
+- '1 03:00 30 [{soundcloud https://soundcloud.com/c}] C2'
+# hole: 03:30 to 04:00
+- '1 04:00 60 [] D'
+`
+	got := bot.RootLineUp.Dump()
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected: <%v>, got: <%v>", want, got)
+	}
+}
+
+func TestStop(t *testing.T) {
+	config, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	config.Lineup.BeginningSchedule = timeTests
+	bot := New(DaoMem.New(), config)
+	messages := bot.GetMessageChannel()
+
+	bot.lock()
+	bot.sendAdminsMessage("quitting")
+	stopped := make(chan struct{})
+	go func() {
+		// waits for the message queued before
+		bot.Stop()
+		close(stopped)
+	}()
+	sent := make(chan struct{})
+	go func() {
+		bot.unlock()
+		close(sent)
+	}()
+	select {
+	case msg := <-messages:
+		if !strings.Contains(msg.Text, "quitting") {
+			t.Fatalf("expected the admin message, got %v", msg.Text)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the admin message")
+	}
+	<-sent
+	<-stopped
+
+	// nobody reads the channel anymore
+	bot.SendAdminsMessage("dropped")
+}
+
+func TestClock(t *testing.T) {
+	config, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	now := config.Lineup.BeginningSchedule.Add(25 * time.Hour)
+	bot := NewWithClock(DaoMem.New(), config, clock.NewFake(now))
+	bot.channel = nil
+
+	if bot.keyboardSeq != int(now.Unix()) {
+		t.Fatalf("expected the keyboards numbered from the clock, got %v", bot.keyboardSeq)
+	}
+	mr := NewMergeRequest(config.Lineup.BeginningSchedule, []inputs.InputCommandResultSet{{Room: "🍵", Dj: "New", Day: 2, Hour: 1, Duration: 60}}, 42, "test", "")
+	bot.CreateMergeRequest(mr)
+	if !mr.Created.Equal(now) {
+		t.Fatalf("expected the merge request created at %v, got %v", now, mr.Created)
+	}
+	decided, err := bot.RefuseMergeRequest(mr.ID, "modo", adminID)
+	if err != nil || !decided.Decided.Equal(now) {
+		t.Fatalf("expected the merge request decided at %v, got %v %v", now, decided.Decided, err)
+	}
+	bot.Log(42, "/now", "test")
+	if !strings.HasPrefix(bot.logs, now.Format("Mon 15:04")) {
+		t.Fatalf("expected the log at %v, got %v", now, bot.logs)
+	}
+}
+
+func TestTimeZones(t *testing.T) {
+	starts := []time.Time{}
+	for _, loc := range []*time.Location{time.FixedZone("Berlin", 2*3600), time.FixedZone("Lisbon", 3600)} {
+		config, err := config.New("../../configs/bot_test.yaml", false)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		config.Location = loc
+		b := config.Lineup.BeginningSchedule
+		config.Lineup.BeginningSchedule = time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, loc)
+		config.ReadSetsFromRedisOnRestart = true
+
+		dao := DaoMem.New()
+		bot := New(dao, config)
+		bot.channel = nil
+		if bot.clock.Now().Location() != loc {
+			t.Fatalf("expected the clock in %v, got %v", loc, bot.clock.Now().Location())
+		}
+		// restart, the sets saved only have the offset of the timezone
+		bot = New(dao, config)
+		bot.channel = nil
+		set := bot.Sets()[0]
+		for _, v := range bot.Sets() {
+			if v.Start.Before(set.Start) {
+				set = v
+			}
+		}
+		if set.Start.Location() != loc || set.Start.Hour() != 1 {
+			t.Fatalf("expected the first set at 01:00 in %v, got %v", loc, set.Start)
+		}
+		starts = append(starts, set.Start)
+	}
+	if starts[1].Sub(starts[0]) != time.Hour {
+		t.Fatalf("expected the festivals an hour apart, got %v", starts)
+	}
+}
+
+func TestLikesNotifications(t *testing.T) {
+	config, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	fake := clock.NewFake(config.Lineup.BeginningSchedule)
+	dao := DaoMem.New()
+	// drains the messages, the ones of sendEvents are read from the outbox
+	drain := func(b *Bot) {
+		go func() {
+			for range b.GetMessageChannel() {
+			}
+		}()
+	}
+	bot := NewWithClock(dao, config, fake)
+	drain(bot)
+	var withNotifications, withoutNotifications int64 = 1, 2
+	for _, v := range []int64{withNotifications, withoutNotifications} {
+		bot.ProcessCommand(v, "/now", "test")
+		if err := bot.users.LikeDj(v, "A"); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bot.ProcessCommand(withNotifications, startNotificationsCommand, "test")
+	first := bot.RootLineUp.FirstSetTime()
+
+	// sendEvents returns the liked djs notified
+	sendEvents := func(b *Bot) map[int64]string {
+		b.lock()
+		defer b.unlock()
+		b.outbox = nil
+		b.sendEvents(fake.Now(), math.MaxInt)
+		res := make(map[int64]string)
+		for _, m := range b.outbox {
+			if strings.HasPrefix(m.Text, "❤️") {
+				res[m.UserID] = m.Text
+			}
+		}
+		return res
+	}
+	fake.Set(first.Add(-time.Duration(config.LikesNotificationMinutes) * time.Minute))
+	if got := sendEvents(bot); len(got) != 1 || got[withNotifications] == "" {
+		t.Fatalf("expected only the user with the notifications on to be notified, got %v", got)
+	}
+
+	// restarted in the notification window
+	fake.Set(first.Add(-time.Minute))
+	restarted := NewWithClock(dao, config, fake)
+	drain(restarted)
+	if got := sendEvents(restarted); len(got) != 0 {
+		t.Fatalf("expected no notification again after a restart, got %v", got)
+	}
+}
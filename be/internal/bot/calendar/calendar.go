@@ -0,0 +1,118 @@
+package calendar
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/lineUp"
+)
+
+const (
+	productID    = "-//shallowBunny//lineup//EN"
+	dateFormat   = "20060102T150405"
+	maxLineOctet = 75
+)
+
+// escapeText escapes a TEXT value (RFC 5545 3.3.11)
+func escapeText(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, ";", "\\;")
+	s = strings.ReplaceAll(s, ",", "\\,")
+	s = strings.ReplaceAll(s, "\r\n", "\\n")
+	s = strings.ReplaceAll(s, "\n", "\\n")
+	return s
+}
+
+// foldLine splits lines longer than 75 octets (RFC 5545 3.1) without cutting an utf-8 character
+func foldLine(line string) string {
+	if len(line) <= maxLineOctet {
+		return line + "\r\n"
+	}
+	var res strings.Builder
+	size := 0
+	for _, r := range line {
+		l := len(string(r))
+		if size+l > maxLineOctet {
+			res.WriteString("\r\n ")
+			size = 1
+		}
+		res.WriteRune(r)
+		size += l
+	}
+	res.WriteString("\r\n")
+	return res.String()
+}
+
+// UID returns an identifier depending only on the festival, the room and the start time
+// of the set, so calendar apps update an event when the dj of a slot changes
+func UID(prefix string, s lineUp.Set) string {
+	h := sha1.New()
+	h.Write([]byte(s.Room + "|" + s.Start.UTC().Format(time.RFC3339)))
+	return fmt.Sprintf("%x@%v.shallowbunny", h.Sum(nil), prefix)
+}
+
+func description(s lineUp.Set) string {
+	res := s.Dj + " in " + s.Room
+	for _, v := range s.Meta {
+		res += "\n" + v.Key + ": " + v.Value
+	}
+	return res
+}
+
+// New returns the iCalendar (RFC 5545) of the sets, an empty room keeps all the sets.
+// Times are written in UTC (there is no VTIMEZONE to refer to), timeZone is only the
+// display hint of the calendar apps
+func New(sets []lineUp.Set, title, prefix, timeZone, room string, now time.Time) (string, error) {
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return "", err
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + productID,
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+	}
+	name := title
+	if room != "" {
+		name += " " + room
+	}
+	lines = append(lines, "X-WR-CALNAME:"+escapeText(name))
+	lines = append(lines, "X-WR-TIMEZONE:"+timeZone)
+
+	for _, s := range sets {
+		if s.Dj == lineUp.UnknownDJ {
+			continue
+		}
+		if room != "" && s.Room != room {
+			continue
+		}
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+UID(prefix, s),
+			"DTSTAMP:"+now.UTC().Format(dateFormat)+"Z",
+			"DTSTART:"+s.Start.UTC().Format(dateFormat)+"Z",
+			"DTEND:"+s.End.UTC().Format(dateFormat)+"Z",
+			"SUMMARY:"+escapeText(s.Dj),
+			"LOCATION:"+escapeText(s.Room),
+			"DESCRIPTION:"+escapeText(description(s)),
+		)
+		for _, v := range s.Meta {
+			if strings.HasPrefix(v.Value, "http://") || strings.HasPrefix(v.Value, "https://") {
+				lines = append(lines, "URL:"+v.Value)
+				break
+			}
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var res strings.Builder
+	for _, v := range lines {
+		res.WriteString(foldLine(v))
+	}
+	return res.String(), nil
+}
@@ -0,0 +1,60 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/lineUp"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+)
+
+func TestCalendar(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	start := time.Date(2024, 8, 16, 22, 30, 0, 0, loc)
+	sets := []lineUp.Set{
+		{Dj: "Robyn, Gebrüder; Teichmann", Room: "🍵", Start: start, End: start.Add(90 * time.Minute),
+			Meta: []config.SetMeta{{Key: "soundcloud", Value: "https://soundcloud.com/robyn"}}},
+		{Dj: lineUp.UnknownDJ, Room: "🍵", Start: start.Add(90 * time.Minute), End: start.Add(3 * time.Hour)},
+		{Dj: "E", Room: "🔨", Start: start, End: start.Add(time.Hour)},
+	}
+
+	got, err := New(sets, "test", "test", "Europe/Berlin", "🍵", time.Now())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART:20240816T203000Z\r\n",
+		"DTEND:20240816T220000Z\r\n",
+		"SUMMARY:Robyn\\, Gebrüder\\; Teichmann\r\n",
+		"URL:https://soundcloud.com/robyn\r\n",
+		"UID:" + UID("test", sets[0]) + "\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected <%v> in <%v>", want, got)
+		}
+	}
+	if strings.Contains(got, "TZID") {
+		t.Fatalf("expected no TZID without VTIMEZONE in <%v>", got)
+	}
+	if strings.Count(got, "BEGIN:VEVENT") != 1 {
+		t.Fatalf("expected only one event in <%v>", got)
+	}
+
+	moved := sets[0]
+	moved.Dj = "Somebody else"
+	if UID("test", moved) != UID("test", sets[0]) {
+		t.Fatalf("UID should not depend on the dj")
+	}
+
+	for _, v := range strings.Split(got, "\r\n") {
+		if len(v) > maxLineOctet {
+			t.Fatalf("line too long <%v>", v)
+		}
+	}
+}
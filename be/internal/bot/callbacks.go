@@ -0,0 +1,194 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+)
+
+// callback data of the inline buttons: "<kind>:<arg>:<arg>", at most 64 bytes for telegram
+const (
+	wizardCallback          = "w"  // w:<keyboard seq>:<button index>
+	mergeRequestCallback    = "mr" // mr:<action>:<ids separated by ->
+	reviewAction            = "review"
+	maxCallbackDataSize     = 64
+	maxInlineButtonsPerRow  = 4
+	maxInlineRowSize        = 32
+	outdatedKeyboardMessage = "This keyboard is outdated, please use the last message"
+	finishInputMessage      = "Please finish or cancel your current input first"
+	decidedMessage          = "Merge request #%d %v"
+)
+
+func reviewButton(id int) InlineButton {
+	return InlineButton{Text: fmt.Sprintf("🔎 review #%d", id), Data: fmt.Sprintf("%v:%v:%d", mergeRequestCallback, reviewAction, id)}
+}
+
+func joinIds(ids []int) string {
+	res := []string{}
+	for _, v := range ids {
+		res = append(res, strconv.Itoa(v))
+	}
+	return strings.Join(res, "-")
+}
+
+func parseIds(arg string) ([]int, error) {
+	res := []int{}
+	for _, v := range strings.Split(arg, "-") {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, id)
+	}
+	return res, nil
+}
+
+// inlineRows puts the short buttons side by side
+func inlineRows(buttons []InlineButton) [][]InlineButton {
+	rows := [][]InlineButton{}
+	row := []InlineButton{}
+	size := 0
+	for _, v := range buttons {
+		l := utf8.RuneCountInString(v.Text)
+		if len(row) != 0 && (len(row) == maxInlineButtonsPerRow || size+l > maxInlineRowSize) {
+			rows = append(rows, row)
+			row = []InlineButton{}
+			size = 0
+		}
+		row = append(row, v)
+		size += l
+	}
+	if len(row) != 0 {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// inlineButtons returns the buttons of a wizard step, of a merge request review or of the choice
+// of the merge request to review as inline buttons, nil for the other answers
+func (b *Bot) inlineButtons(chatId int64, lineup *lineUp.LineUp, buttons []string) [][]InlineButton {
+	if len(buttons) == 0 {
+		return nil
+	}
+	res := []InlineButton{}
+	switch lineup.CurrentInputCommand(chatId) {
+	case "":
+		// "/rebase <id>" buttons when several merge requests are pending
+		for _, v := range buttons {
+			id, err := strconv.Atoi(strings.TrimPrefix(v, "/"+inputs.RebaseCommand+" "))
+			if err != nil {
+				return nil
+			}
+			res = append(res, reviewButton(id))
+		}
+	case inputs.RebaseCommand:
+		// the ids are in the data so a click on an old review decides the right merge requests
+		ids := joinIds(b.rebasing[chatId])
+		for _, action := range []string{inputs.RebaseAcceptCommand, inputs.RebaseRefuseCommand} {
+			res = append(res, InlineButton{Text: action, Data: mergeRequestCallback + ":" + action + ":" + ids})
+		}
+	default:
+		b.keyboardSeq++
+		b.keyboards[chatId] = wizardKeyboard{seq: b.keyboardSeq, buttons: buttons}
+		for i, v := range buttons {
+			res = append(res, InlineButton{Text: v, Data: fmt.Sprintf("%v:%d:%d", wizardCallback, b.keyboardSeq, i)})
+		}
+	}
+	for _, v := range res {
+		if len(v.Data) > maxCallbackDataSize {
+			log.Warn().Msg(fmt.Sprintf("callback data too long <%v>", v.Data))
+			return nil
+		}
+	}
+	return inlineRows(res)
+}
+
+// ProcessCallback answers the click on an inline button, notice is shown to the user in a popup
+// (i.e. when the button belongs to an outdated step of a wizard)
+func (b *Bot) ProcessCallback(chatId int64, data, user string) ([]Message, string) {
+	b.lock()
+	defer b.unlock()
+	log.Debug().Msg(fmt.Sprintf("%v sent callback <%v>", user, data))
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 {
+		log.Warn().Msg(fmt.Sprintf("invalid callback <%v>", data))
+		return nil, outdatedKeyboardMessage
+	}
+	switch parts[0] {
+	case wizardCallback:
+		lineup := b.getLineUpForUser(chatId)
+		k, ok := b.keyboards[chatId]
+		index, err := strconv.Atoi(parts[2])
+		if !ok || strconv.Itoa(k.seq) != parts[1] || err != nil || index < 0 || index >= len(k.buttons) || !lineup.IsUserInputing(chatId) {
+			return nil, outdatedKeyboardMessage
+		}
+		delete(b.keyboards, chatId)
+		// same as typing the label of the button, without parseCommand having to guess
+		return b.runCommand(chatId, lineup.CurrentInputCommand(chatId), k.buttons[index], k.buttons[index], user), ""
+	case mergeRequestCallback:
+		if !b.IsModo(chatId) {
+			return nil, outdatedKeyboardMessage
+		}
+		ids, err := parseIds(parts[2])
+		if err != nil {
+			return nil, outdatedKeyboardMessage
+		}
+		return b.mergeRequestCallback(chatId, parts[1], ids, user)
+	}
+	log.Warn().Msg(fmt.Sprintf("unknown callback <%v>", data))
+	return nil, outdatedKeyboardMessage
+}
+
+// mergeRequestCallback reviews or decides the merge requests ids. Deciding the merge requests
+// being reviewed by the moderator goes through the rebase step, other ones (i.e. from an older
+// review) are decided directly.
+func (b *Bot) mergeRequestCallback(chatId int64, action string, ids []int, user string) ([]Message, string) {
+	lineup := b.getLineUpForUser(chatId)
+	current := lineup.CurrentInputCommand(chatId)
+	switch action {
+	case reviewAction:
+		if current == inputs.RebaseCommand {
+			lineup.CancelInput(chatId)
+			delete(b.rebasing, chatId)
+		} else if current != "" {
+			return nil, finishInputMessage
+		}
+		return b.runCommand(chatId, inputs.RebaseCommand, " "+strings.ReplaceAll(joinIds(ids), "-", " "), "", user), ""
+	case inputs.RebaseAcceptCommand, inputs.RebaseRefuseCommand:
+		if current == inputs.RebaseCommand && reflect.DeepEqual(b.rebasing[chatId], ids) {
+			return b.runCommand(chatId, inputs.RebaseCommand, action, action, user), ""
+		}
+	default:
+		return nil, outdatedKeyboardMessage
+	}
+
+	decide := b.acceptMergeRequest
+	if action == inputs.RebaseRefuseCommand {
+		decide = b.refuseMergeRequest
+	}
+	answer := ""
+	for _, id := range ids {
+		// the second of two moderators deciding at once gets "already accepted by..."
+		r, err := decide(id, user, chatId)
+		if err != nil {
+			log.Error().Msg(err.Error())
+			answer += err.Error() + "\n"
+			continue
+		}
+		answer += fmt.Sprintf(decidedMessage, id, r.Status) + "\n"
+	}
+	if err := b.save(); err != nil {
+		log.Error().Msg(err.Error())
+	}
+	return splitMessages([]Message{{
+		UserID:  chatId,
+		Text:    answer,
+		Buttons: b.getButtonsForUser(chatId),
+	}}), ""
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+// lastMessage returns the last answer (the map image comes first)
+func lastMessage(t *testing.T, answer []Message) Message {
+	t.Helper()
+	if len(answer) == 0 {
+		t.Fatalf("no answer")
+	}
+	return answer[len(answer)-1]
+}
+
+func inlineData(t *testing.T, msg Message, text string) string {
+	t.Helper()
+	for _, row := range msg.InlineButtons {
+		for _, v := range row {
+			if v.Text == text {
+				return v.Data
+			}
+		}
+	}
+	t.Fatalf("no inline button <%v> in %v", text, msg)
+	return ""
+}
+
+func TestInlineCallbacks(t *testing.T) {
+	c, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := timeTests
+	currentTime := time.Date(tt.Year(), tt.Month(), tt.Day(), 0, 0, 0, 0, tt.Location())
+	c.Lineup.BeginningSchedule = currentTime
+	currentTime = currentTime.Add(24 * time.Hour)
+	var userID int64 = 123
+	var modo2 int64 = -124
+	c.Modos = append(c.Modos, int(modo2))
+
+	bot := New(DaoMem.New(), c)
+	bot.channel = make(chan Message, 100)
+
+	// the wizard is answered by clicking
+	msg := lastMessage(t, bot.ProcessCommand(userID, inputs.InputCommand, "test"))
+	roomData := inlineData(t, msg, "🍵")
+	answer, notice := bot.ProcessCallback(userID, roomData, "test")
+	msg = lastMessage(t, answer)
+	if notice != "" || msg.Text != "Which day?" {
+		t.Fatalf("unexpected answer %v %v", notice, answer)
+	}
+	dayData := inlineData(t, msg, currentTime.Format("Mon"))
+
+	// a click on an older step is refused
+	answer, notice = bot.ProcessCallback(userID, roomData, "test")
+	if notice != outdatedKeyboardMessage || len(answer) != 0 {
+		t.Fatalf("expected outdated keyboard, got %v %v", notice, answer)
+	}
+
+	bot.ProcessCallback(userID, dayData, "test")
+	bot.ProcessCommand(userID, "2:30", "test")
+	msg = lastMessage(t, bot.ProcessCommand(userID, "DJ FART", "test"))
+	answer, _ = bot.ProcessCallback(userID, inlineData(t, msg, inputs.Duration90), "test")
+	answer, _ = bot.ProcessCallback(userID, inlineData(t, lastMessage(t, answer), inputs.ValidateCommand), "test")
+	if msg = lastMessage(t, answer); msg.InlineButtons != nil {
+		t.Fatalf("unexpected inline buttons at the end of the wizard %v", msg)
+	}
+	msg = lastMessage(t, bot.ProcessCommand(userID, inputs.MergeCommand, "test"))
+	bot.ProcessCallback(userID, inlineData(t, msg, inputs.MergeSubmitCommand), "test")
+
+	// the moderators are notified with a review button
+	reviewData := ""
+	for len(bot.channel) != 0 {
+		m := <-bot.channel
+		if m.UserID == adminID && m.InlineButtons != nil {
+			reviewData = inlineData(t, m, "🔎 review #1")
+		}
+	}
+	if reviewData == "" {
+		t.Fatalf("no review button sent to the moderators")
+	}
+
+	// both moderators review #1 and accept it at the same time
+	acceptData := []string{}
+	for _, modo := range []int64{adminID, modo2} {
+		answer, _ = bot.ProcessCallback(modo, reviewData, "modo")
+		acceptData = append(acceptData, inlineData(t, lastMessage(t, answer), inputs.RebaseAcceptCommand))
+	}
+	if acceptData[0] != "mr:accept:1" {
+		t.Fatalf("expected the id in the callback data, got %v", acceptData[0])
+	}
+	answer, _ = bot.ProcessCallback(adminID, acceptData[0], "modo1")
+	if msg = lastMessage(t, answer); !strings.HasPrefix(msg.Text, inputs.RebaseAcceptMessage) {
+		t.Fatalf("unexpected answer %v", msg)
+	}
+	answer, _ = bot.ProcessCallback(modo2, acceptData[1], "modo2")
+	if msg = lastMessage(t, answer); !strings.Contains(msg.Text, "merge request #1 already accepted by modo1") {
+		t.Fatalf("unexpected answer %v", msg)
+	}
+	mr, _ := bot.mergeRequests.Get(1)
+	if mr.DecidedBy != "modo1" {
+		t.Fatalf("expected #1 decided by modo1, got %v", mr)
+	}
+
+	// a user can't decide merge requests
+	if _, notice = bot.ProcessCallback(userID, acceptData[0], "test"); notice != outdatedKeyboardMessage {
+		t.Fatalf("expected a refused callback, got %v", notice)
+	}
+}
@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+)
+
+const maxInlineResults = 20
+
+// InlineResult is a card answering an inline query, Text is posted in the chat when it is chosen
+type InlineResult struct {
+	ID          string
+	Title       string
+	Description string
+	Text        string
+}
+
+func (b *Bot) inlineResult(id, title, text string) InlineResult {
+	return InlineResult{
+		ID:          id,
+		Title:       title,
+		Description: text,
+		Text:        b.config.Meta.Title + "\n" + text,
+	}
+}
+
+// InlineQuery answers "@bot <query>" typed in any chat: the current status of the room matching
+// query and the sets of the DJs matching it, every room and the whole status for an empty query
+func (b *Bot) InlineQuery(query string) []InlineResult {
+	b.lock()
+	defer b.unlock()
+	l := b.RootLineUp
+	query = strings.TrimSpace(query)
+	res := []InlineResult{}
+
+	if query == "" {
+		res = append(res, b.inlineResult("now", "Now", l.PrintCurrent()))
+		for i, room := range b.config.Lineup.Rooms {
+			if line := l.PrintCurrentRoom(room); line != "" {
+				res = append(res, b.inlineResult(fmt.Sprintf("room-%d", i), room, line))
+			}
+		}
+		return res
+	}
+
+	if index, room := l.FindRoom(query, distanceMaxRoom); room != "" {
+		if line := l.PrintCurrentRoom(room); line != "" {
+			res = append(res, b.inlineResult(fmt.Sprintf("room-%d", index), room, line))
+		}
+	}
+	for i, line := range l.FindDJSets(query, b.clock.Now()) {
+		if len(res) == maxInlineResults {
+			break
+		}
+		line = strings.TrimSpace(line)
+		res = append(res, b.inlineResult(fmt.Sprintf("dj-%d", i), line, line))
+	}
+	return res
+}
@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func TestInlineQuery(t *testing.T) {
+	c, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	now := time.Now()
+	c.Lineup.BeginningSchedule = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	c.Lineup.Rooms = []string{"🌳 Garten", "🔨 Hammahalle"}
+	c.Lineup.Sets = map[string][]config.Set{
+		"🌳 Garten":     {{Day: 0, Hour: now.Hour(), Duration: 120, Dj: "Robin Schulz"}},
+		"🔨 Hammahalle": {{Day: 2, Hour: 22, Duration: 120, Dj: "Ellen Allien"}},
+	}
+	bot := New(DaoMem.New(), c)
+	bot.channel = nil
+
+	res := bot.InlineQuery("")
+	if len(res) != 3 || res[0].ID != "now" || !strings.Contains(res[1].Text, "✅ Robin Schulz") || !strings.Contains(res[2].Text, "Ellen Allien") {
+		t.Fatalf("unexpected results for an empty query %v", res)
+	}
+
+	res = bot.InlineQuery("garten")
+	if len(res) == 0 || res[0].Title != "🌳 Garten" || !strings.HasPrefix(res[0].Text, c.Meta.Title+"\n🌳 Garten ✅ Robin Schulz") {
+		t.Fatalf("unexpected results for a room %v", res)
+	}
+
+	res = bot.InlineQuery("ellen")
+	if len(res) != 1 || !strings.Contains(res[0].Text, "✅ Ellen Allien is playing") || !strings.Contains(res[0].Text, "in 🔨 Hammahalle") {
+		t.Fatalf("unexpected results for a dj %v", res)
+	}
+
+	if res = bot.InlineQuery("zzzzzz"); len(res) != 0 {
+		t.Fatalf("expected no result, got %v", res)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
 )
 
 const (
@@ -21,6 +22,9 @@ const (
 	MergeStep
 	RebaseStep
 	logStep
+	ChoosingRoomForSet
+	ChoosingSet
+	ValidateRemove
 	closed      = "closed"
 	unknown     = "?"
 	Duration60  = "1h"
@@ -51,6 +55,7 @@ type State struct {
 	Room              string
 	Inputs            []InputCommandResultSet
 	WhichInputCommand string
+	Orig              InputCommandResultSet // set being edited or removed
 }
 
 type Inputs struct {
@@ -78,6 +83,11 @@ func (i Inputs) IsUserInLogs(chatID int64) bool {
 	return i.CurrentInputCommand(chatID) == LogCommand
 }
 
+const (
+	ChangeAdd    = ""
+	ChangeRemove = "remove"
+)
+
 type InputCommandResultSet struct {
 	Room     string
 	Dj       string
@@ -85,6 +95,8 @@ type InputCommandResultSet struct {
 	Hour     int
 	Minute   int
 	Duration int
+	Kind     string           // ChangeAdd or ChangeRemove
+	Meta     []config.SetMeta `json:",omitempty"` // links of the set, i.e. imported with it
 }
 
 type InputCommandResult struct {
@@ -118,6 +130,12 @@ Delete to delete all your changes`
 	MergeEditMessage   = "Cancelled merge request, you can keep editing your changes"
 	logMessage         = "Starting log streaming."
 	RebaseCommand      = "rebase"
+	EditSetCommand     = "editset"
+	RemoveSetCommand   = "removeset"
+	whichSetMessage    = "Which set?"
+	invalidSet         = "Invalid input, please click a button to choose the set"
+	noSetInRoom        = "No set in this room, please choose another room"
+	removeSetMessage   = "\n\nClick the validate button to remove this set\n" + cancelButton + " to cancel"
 	cancelButton       = "🔴"
 	stopLoggingMessage = "Stopped log streaming."
 )
@@ -151,9 +169,19 @@ var (
 
 	RebaseMessage = "\nAccept or refuse this MR"
 	rebaseButtons = []string{RebaseAcceptCommand, RebaseRefuseCommand}
+	removeButtons = []string{ValidateCommand, cancelCommand}
 	emptyButtons  = []string{}
 )
 
+// dayLabel returns the day of a set of the lineup, the days out of the input days (i.e. a set
+// before the BeginningSchedule) get their index so two sets can't have the same button
+func (i *Inputs) dayLabel(day int) string {
+	if day < 0 || day >= len(i.Days) {
+		return fmt.Sprintf("day %d", day)
+	}
+	return i.Days[day]
+}
+
 func (i *Inputs) printSet(Room string, Day int, Hour int, Min int, Hour2 int, Min2 int, Dj string) string {
 	DayString := i.Days[Day%len(i.Days)]
 
@@ -162,8 +190,27 @@ func (i *Inputs) printSet(Room string, Day int, Hour int, Min int, Hour2 int, Mi
 	return fmt.Sprintf("%v %v %.2d:%.2d to %.2d:%.2d %v", Room, DayString, Hour, Min, Hour2, Min2, Dj)
 }
 
+func (i *Inputs) printSetButton(s InputCommandResultSet) string {
+	return fmt.Sprintf("%v %.2d:%.2d %v", i.dayLabel(s.Day), s.Hour, s.Minute, s.Dj)
+}
+
+func (i *Inputs) setsButtons(room string, sets []InputCommandResultSet) []string {
+	buttons := []string{}
+	for _, v := range sets {
+		if v.Room == room {
+			buttons = append(buttons, i.printSetButton(v))
+		}
+	}
+	return buttons
+}
+
 // msgText , buttons, removeKeyboard, msgAdMin
 func (i *Inputs) InputCommand(chatID int64, commandOrArg string) InputCommandResult {
+	return i.InputCommandWithSets(chatID, commandOrArg, nil)
+}
+
+// InputCommandWithSets is InputCommand with the sets of the lineup, used by the edit and remove commands
+func (i *Inputs) InputCommandWithSets(chatID int64, commandOrArg string, sets []InputCommandResultSet) InputCommandResult {
 
 	v, ok := i.States[chatID]
 	if !ok {
@@ -203,6 +250,13 @@ func (i *Inputs) InputCommand(chatID int64, commandOrArg string) InputCommandRes
 				WhichInputCommand: RebaseCommand,
 			}
 			return InputCommandResult{RebaseMessage, rebaseButtons, nil}
+		case EditSetCommand, RemoveSetCommand:
+			i.States[chatID] = &State{Step: ChoosingRoomForSet,
+				Min:               -1,
+				Hour:              -1,
+				WhichInputCommand: commandOrArg,
+			}
+			return InputCommandResult{whichRoomMessage, i.WhichRoomButtons, nil}
 		default:
 			log.Error().Msg(fmt.Sprintf("InputCommand: %d <%v>", chatID, commandOrArg))
 			return InputCommandResult{internalErrorMessage, nil, nil}
@@ -229,6 +283,67 @@ func (i *Inputs) InputCommand(chatID int64, commandOrArg string) InputCommandRes
 		i.States[chatID].Step = ChoosingDay
 		i.States[chatID].Room = commandOrArg
 		return InputCommandResult{whichDay, i.WhichDaysButtons, nil}
+	case ChoosingRoomForSet:
+
+		if commandOrArg == cancelButton {
+			i.emptyState(chatID)
+			return InputCommandResult{cancelledMessage, nil, nil}
+		}
+
+		foundRoom := false
+		for _, v := range i.Rooms {
+			if v == commandOrArg {
+				foundRoom = true
+			}
+		}
+		if !foundRoom {
+			return InputCommandResult{invalidRoom, i.WhichRoomButtons, nil}
+		}
+		buttons := i.setsButtons(commandOrArg, sets)
+		if len(buttons) == 0 {
+			return InputCommandResult{noSetInRoom, i.WhichRoomButtons, nil}
+		}
+		i.States[chatID].Step = ChoosingSet
+		i.States[chatID].Room = commandOrArg
+		return InputCommandResult{whichSetMessage, append(buttons, cancelButton), nil}
+	case ChoosingSet:
+
+		if commandOrArg == cancelButton {
+			i.emptyState(chatID)
+			return InputCommandResult{cancelledMessage, nil, nil}
+		}
+
+		room := i.States[chatID].Room
+		for _, v := range sets {
+			if v.Room != room || i.printSetButton(v) != commandOrArg {
+				continue
+			}
+			i.States[chatID].Orig = v
+			if i.States[chatID].WhichInputCommand == RemoveSetCommand {
+				i.States[chatID].Step = ValidateRemove
+				return InputCommandResult{room + " " + commandOrArg + removeSetMessage, removeButtons, nil}
+			}
+			i.States[chatID].Day = v.Day
+			i.States[chatID].Hour = v.Hour
+			i.States[chatID].Min = v.Minute
+			i.States[chatID].Dj = v.Dj
+			i.States[chatID].Step = ChoosingDay
+			return InputCommandResult{whichDay, i.WhichDaysButtons, nil}
+		}
+		return InputCommandResult{invalidSet, append(i.setsButtons(room, sets), cancelButton), nil}
+	case ValidateRemove:
+		switch commandOrArg {
+		case ValidateCommand:
+			set := i.States[chatID].Orig
+			set.Kind = ChangeRemove
+			i.emptyState(chatID)
+			return InputCommandResult{validatedMessage, nil, []InputCommandResultSet{set}}
+		case cancelCommand:
+			i.emptyState(chatID)
+			return InputCommandResult{cancelledMessage, nil, nil}
+		default:
+			return InputCommandResult{validateErrorMessage, removeButtons, nil}
+		}
 	case ChoosingDay:
 
 		if commandOrArg == cancelButton {
@@ -378,16 +493,13 @@ func (i *Inputs) InputCommand(chatID int64, commandOrArg string) InputCommandRes
 	case Validate:
 		switch commandOrArg {
 		case ValidateCommand:
-			set := InputCommandResultSet{
-				Room:     i.States[chatID].Room,
-				Dj:       i.States[chatID].Dj,
-				Day:      i.States[chatID].Day,
-				Hour:     i.States[chatID].Hour,
-				Minute:   i.States[chatID].Min,
-				Duration: i.States[chatID].Duration,
-			}
-			i.States[chatID].Inputs = append(i.States[chatID].Inputs, set)
+			i.States[chatID].Inputs = append(i.States[chatID].Inputs, i.enteredSet(chatID))
 			res := i.States[chatID].Inputs
+			if i.States[chatID].WhichInputCommand == EditSetCommand {
+				removed := i.States[chatID].Orig
+				removed.Kind = ChangeRemove
+				res = append([]InputCommandResultSet{removed}, res...)
+			}
 			i.emptyState(chatID)
 			return InputCommandResult{validatedMessage, nil, res}
 		case cancelCommand:
@@ -397,15 +509,7 @@ func (i *Inputs) InputCommand(chatID int64, commandOrArg string) InputCommandRes
 			i.States[chatID].Step = ChoosingRoom
 			return InputCommandResult{whichRoomMessage, i.WhichRoomButtons, nil}
 		case ContinueCommand:
-			set := InputCommandResultSet{
-				Room:     i.States[chatID].Room,
-				Dj:       i.States[chatID].Dj,
-				Day:      i.States[chatID].Day,
-				Hour:     i.States[chatID].Hour,
-				Minute:   i.States[chatID].Min,
-				Duration: i.States[chatID].Duration,
-			}
-			i.States[chatID].Inputs = append(i.States[chatID].Inputs, set)
+			i.States[chatID].Inputs = append(i.States[chatID].Inputs, i.enteredSet(chatID))
 			i.States[chatID].Dj = ""
 			i.States[chatID].Min += i.States[chatID].Duration % 60
 			if i.States[chatID].Min > 59 {
@@ -432,6 +536,30 @@ func (i *Inputs) InputCommand(chatID int64, commandOrArg string) InputCommandRes
 
 }
 
+// enteredSet returns the set entered by the user, an edited set keeps the links of the original one
+func (i *Inputs) enteredSet(chatID int64) InputCommandResultSet {
+	state := i.States[chatID]
+	set := InputCommandResultSet{
+		Room:     state.Room,
+		Dj:       state.Dj,
+		Day:      state.Day,
+		Hour:     state.Hour,
+		Minute:   state.Min,
+		Duration: state.Duration,
+	}
+	if state.WhichInputCommand == EditSetCommand && len(state.Inputs) == 0 {
+		set.Meta = state.Orig.Meta
+	}
+	return set
+}
+
+// Cancel leaves the current input command of the user
+func (i *Inputs) Cancel(chatID int64) {
+	if i.IsUserInputing(chatID) {
+		i.emptyState(chatID)
+	}
+}
+
 func (i *Inputs) emptyState(chatID int64) {
 	_, ok := i.States[chatID]
 	if ok {
@@ -273,3 +273,17 @@ func TestRandomInputWithContinue(t *testing.T) {
 	}
 
 }
+
+func TestSetsButtons(t *testing.T) {
+	i := New(days, rooms)
+	sets := []InputCommandResultSet{
+		{Room: "B", Day: -1, Hour: 23, Dj: "Before"},
+		{Room: "B", Day: 0, Hour: 22, Dj: "DJ"},
+		{Room: "B", Day: 7, Hour: 22, Dj: "DJ"},
+		{Room: "A", Day: 1, Hour: 22, Dj: "Other room"},
+	}
+	want := []string{"day -1 23:00 Before", "Fri 22:00 DJ", "day 7 22:00 DJ"}
+	if got := i.setsButtons("B", sets); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+}
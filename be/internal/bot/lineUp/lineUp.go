@@ -2,6 +2,7 @@ package lineUp
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"unicode"
 
 	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/clock"
 	"github.com/shallowBunny/app/be/internal/infrastructure/config"
 	"github.com/shallowBunny/app/be/internal/utils"
 	"github.com/texttheater/golang-levenshtein/levenshtein"
@@ -25,10 +27,27 @@ type Set struct {
 	Meta  []config.SetMeta `json:"meta"`
 }
 
+// Collides returns true if both sets are overlapping in the same room
+func (s Set) Collides(o Set) bool {
+	return s.End.After(o.Start) && s.Start.Before(o.End) && s.Room == o.Room
+}
+
+type ModifiedSet struct {
+	Before Set `json:"before"`
+	After  Set `json:"after"`
+}
+
+type LineUpDiff struct {
+	Added    []Set         `json:"added"`
+	Removed  []Set         `json:"removed"`
+	Modified []ModifiedSet `json:"modified"`
+}
+
+// Event is the start of a set
 type Event struct {
-	time     time.Time
-	dj       string
-	room     string
+	Time     time.Time `json:"time"`
+	Dj       string    `json:"dj"`
+	Room     string    `json:"room"`
 	priority int
 }
 
@@ -41,11 +60,14 @@ func printTimeWithDay(t time.Time) string {
 }
 
 type LineUp struct {
-	Sets    []Set
-	events  []Event
-	Inputs  inputs.Inputs
-	Changes []inputs.InputCommandResultSet
-	config  *config.Config
+	Sets     []Set
+	events   []Event
+	upcoming []Set
+	Inputs   inputs.Inputs
+	Changes  []inputs.InputCommandResultSet
+	config   *config.Config
+	clock    clock.Clock
+	notified map[string]bool // sets already returned by UpcomingSets, by setKey
 }
 
 const (
@@ -65,16 +87,63 @@ const (
 
 func (l LineUp) DuplicateLineUp() *LineUp {
 	new := &LineUp{
-		Sets:    l.Sets,
-		events:  l.events,
-		Inputs:  l.Inputs,
-		Changes: l.Changes,
-		config:  l.config,
+		Sets:     l.Sets,
+		events:   l.events,
+		upcoming: l.upcoming,
+		Inputs:   l.Inputs,
+		Changes:  l.Changes,
+		config:   l.config,
+		clock:    l.clock,
+		notified: make(map[string]bool),
+	}
+	for k, v := range l.notified {
+		new.notified[k] = v
 	}
 	return new
 }
 
-func New(config *config.Config) *LineUp {
+// setKey identifies a set for notified, a set moved or given to another dj is notified again
+func setKey(s Set) string {
+	return s.Room + "|" + strconv.FormatInt(s.Start.Unix(), 10) + "|" + s.Dj
+}
+
+// NotifiedSets returns the sets already returned by UpcomingSets, saved with the lineup
+func (l *LineUp) NotifiedSets() []string {
+	res := []string{}
+	for k := range l.notified {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// SetNotifiedSets restores the sets returned by UpcomingSets before a restart
+func (l *LineUp) SetNotifiedSets(keys []string) {
+	l.notified = make(map[string]bool)
+	for _, v := range keys {
+		l.notified[v] = true
+	}
+	l.computeEvents()
+}
+
+// KeepNotified keeps the sets notified by previous, i.e. when a reload replaces the lineup
+func (l *LineUp) KeepNotified(previous *LineUp) {
+	if previous.notified != nil {
+		l.notified = previous.notified
+	}
+	l.computeEvents()
+}
+
+// now returns the time of the clock given to New or Init
+func (l LineUp) now() time.Time {
+	return l.clock.Now()
+}
+
+// New returns the lineup of the config, its events follow clock (clock.Real for the system time)
+func New(config *config.Config, clock clock.Clock) *LineUp {
+	if clock == nil {
+		panic("nil clock")
+	}
 	days := []string{}
 
 	for i := 0; i < config.NbDaysForInput; i++ {
@@ -83,11 +152,13 @@ func New(config *config.Config) *LineUp {
 	}
 
 	lineUp := &LineUp{
-		Sets:    []Set{},
-		events:  []Event{},
-		Inputs:  inputs.New(days, config.Lineup.Rooms),
-		Changes: []inputs.InputCommandResultSet{},
-		config:  config,
+		Sets:     []Set{},
+		events:   []Event{},
+		Inputs:   inputs.New(days, config.Lineup.Rooms),
+		Changes:  []inputs.InputCommandResultSet{},
+		config:   config,
+		clock:    clock,
+		notified: make(map[string]bool),
 	}
 
 	for _, room := range config.Lineup.Rooms {
@@ -168,20 +239,18 @@ func (l LineUp) GetSetsAndDurations() string {
 	return result.String()
 }
 
+// Events returns the text of the events started at t, each event is returned only once
 func (l *LineUp) Events(t time.Time) string {
+	return PrintEvents(l.StartedEvents(t))
+}
 
+// StartedEvents returns the events started at t, each event is returned only once
+func (l *LineUp) StartedEvents(t time.Time) []Event {
 	updatedEvents := []Event{}
-	res := ""
-
-	started := false
+	res := []Event{}
 	for _, v := range l.events {
-		if !v.time.After(t) {
-			if !started {
-				started = true
-				res += v.dj + " started in " + v.room + "\n"
-			} else {
-				res += v.dj + " in " + v.room + "\n"
-			}
+		if !v.Time.After(t) {
+			res = append(res, v)
 		} else {
 			updatedEvents = append(updatedEvents, v)
 		}
@@ -190,23 +259,55 @@ func (l *LineUp) Events(t time.Time) string {
 	return res
 }
 
+func PrintEvents(events []Event) string {
+	res := ""
+	for i, v := range events {
+		if i == 0 {
+			res += v.Dj + " started in " + v.Room + "\n"
+		} else {
+			res += v.Dj + " in " + v.Room + "\n"
+		}
+	}
+	return res
+}
+
+// UpcomingSets returns the sets starting before t+lead, each set is returned only once, even
+// after the sets of the lineup changed
+func (l *LineUp) UpcomingSets(t time.Time, lead time.Duration) []Set {
+	if l.notified == nil {
+		l.notified = make(map[string]bool)
+	}
+	res := []Set{}
+	updated := []Set{}
+	for _, v := range l.upcoming {
+		if !v.Start.After(t.Add(lead)) {
+			res = append(res, v)
+			l.notified[setKey(v)] = true
+		} else {
+			updated = append(updated, v)
+		}
+	}
+	l.upcoming = updated
+	return res
+}
+
 func (l LineUp) DumpEvents() string {
 	res := ""
 	var lastTime time.Time
 
 	events := l.events
 	sort.Slice(events, func(i, j int) bool {
-		return events[i].time.Before(events[j].time)
+		return events[i].Time.Before(events[j].Time)
 	})
 
 	for _, v := range events {
-		if !v.time.Equal(lastTime) {
-			res += "\n" + v.time.Format(time.Layout) + "\n"
-			res += v.dj + " started in " + v.room + "\n"
+		if !v.Time.Equal(lastTime) {
+			res += "\n" + v.Time.Format(time.Layout) + "\n"
+			res += v.Dj + " started in " + v.Room + "\n"
 		} else {
-			res += v.dj + " in " + v.room + "\n"
+			res += v.Dj + " in " + v.Room + "\n"
 		}
-		lastTime = v.time
+		lastTime = v.Time
 	}
 	return res
 }
@@ -219,6 +320,10 @@ func (l LineUp) IsUserInLogs(chatID int64) bool {
 	return l.Inputs.IsUserInLogs(chatID)
 }
 
+func (l LineUp) CancelInput(chatID int64) {
+	l.Inputs.Cancel(chatID)
+}
+
 func (l LineUp) CurrentInputCommand(chatID int64) string {
 	return l.Inputs.CurrentInputCommand(chatID)
 }
@@ -232,7 +337,7 @@ type InputCommandResult struct {
 
 func (l *LineUp) InputCommand(chatID int64, commandOrArg string) (*LineUp, InputCommandResult) {
 
-	r := l.Inputs.InputCommand(chatID, commandOrArg)
+	r := l.Inputs.InputCommandWithSets(chatID, commandOrArg, l.InputSets())
 
 	answerModo := ""
 	var newLineup *LineUp = l
@@ -248,9 +353,7 @@ func (l *LineUp) InputCommand(chatID int64, commandOrArg string) (*LineUp, Input
 		log.Debug().Msg(fmt.Sprintf("List of changes for user %v <%v> in detached lineup", chatID, newLineup.Changes))
 
 		for _, v := range r.Sets {
-			s := newLineup.NewSet(v.Dj, v.Room, v.Day, v.Hour, v.Minute, v.Duration, nil)
-			answerModo += "added " + newLineup.PrintSetOldFormat(s) + "\n"
-			answerModo += newLineup.AddSet(s)
+			answerModo += newLineup.ApplyChange(v)
 		}
 	}
 	res := InputCommandResult{
@@ -262,6 +365,63 @@ func (l *LineUp) InputCommand(chatID int64, commandOrArg string) (*LineUp, Input
 	return newLineup, res
 }
 
+// dayIndex returns the number of days between the BeginningSchedule and t (the day argument of NewSet)
+func (l LineUp) dayIndex(t time.Time) int {
+	b := l.config.Lineup.BeginningSchedule
+	t = t.In(b.Location())
+	d0 := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, b.Location())
+	d1 := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, b.Location())
+	return int(math.Round(d1.Sub(d0).Hours() / 24))
+}
+
+// InputSets returns the known sets of the lineup, as used by the inputs edit and remove commands
+func (l LineUp) InputSets() []inputs.InputCommandResultSet {
+	res := []inputs.InputCommandResultSet{}
+	for _, v := range l.Sets {
+		if v.Dj == UnknownDJ {
+			continue
+		}
+		res = append(res, inputs.InputCommandResultSet{
+			Room:     v.Room,
+			Dj:       v.Dj,
+			Day:      l.dayIndex(v.Start),
+			Hour:     v.Start.Hour(),
+			Minute:   v.Start.Minute(),
+			Duration: int(v.End.Sub(v.Start).Minutes()),
+			Meta:     v.Meta,
+		})
+	}
+	return res
+}
+
+// ApplyChange adds or removes the set of an input
+func (l *LineUp) ApplyChange(v inputs.InputCommandResultSet) string {
+	s := l.NewSet(v.Dj, v.Room, v.Day, v.Hour, v.Minute, v.Duration, v.Meta)
+	if v.Kind == inputs.ChangeRemove {
+		return l.RemoveSet(s)
+	}
+	return "added " + l.PrintSetOldFormat(s) + "\n" + l.AddSet(s)
+}
+
+// RemoveSet removes the set starting at the same time in the same room
+func (l *LineUp) RemoveSet(s Set) string {
+	resSet := []Set{}
+	msg := ""
+	for _, v := range l.Sets {
+		if v.Room == s.Room && v.Start.Equal(s.Start) {
+			msg += "removed " + l.PrintSetOldFormat(v) + "\n"
+			continue
+		}
+		resSet = append(resSet, v)
+	}
+	if msg == "" {
+		return fmt.Sprintf("Skipped removing <%v> because not found in <%v>\n", l.PrintSetOldFormat(s), s.Room)
+	}
+	l.Sets = resSet
+	l.computeEvents()
+	return msg
+}
+
 func (l *LineUp) NewSet(djName string, room string, day int, hour int, min int, duration int, meta []config.SetMeta) Set {
 	t := l.config.Lineup.BeginningSchedule
 	// Start by setting the base date and time
@@ -324,16 +484,11 @@ func (l *LineUp) FindRoom(source string, distanceMaxRoom int) (int, string) {
 	return indexRoom, room
 }
 
-func (l *LineUp) FindDJ(i string, when time.Time) string {
-
-	if len(filterNonASCIIAndSpaces(i)) <= minSizeDJSearch {
-		return minSizeDJSearchText + searchedMessage3
-	}
-
+// matchDJs returns the sets with a dj matching one of the words of i, using the smallest
+// levenshtein distance giving a result. A set is returned once per matching word of i.
+func (l *LineUp) matchDJs(i string) []Set {
 	targets := strings.Fields(i)
-	founds := make(map[string]bool)
-	res := ""
-	found := false
+	res := []Set{}
 	for distance := 1; distance < 4; distance++ {
 		for _, vv := range targets {
 			target := strings.ToUpper(filterNonASCIIAndSpaces(vv))
@@ -362,45 +517,84 @@ func (l *LineUp) FindDJ(i string, when time.Time) string {
 					log.Trace().Msg(fmt.Sprintf("source: %v target: %v  l: %v", source, target, l))
 					log.Trace().Msg(fmt.Sprintf("s: %v t: %v  res: %v", s, t, d))
 
-					lastWasTrue := false
 					if d < distance {
-						foundThat := ""
-						if vv.End.After(when) {
-							foundThat += "✅ "
-							foundThat += vv.Dj
-							foundThat += " is playing "
-							found = true
-							lastWasTrue = true
-						} else {
-							found = true
-							foundThat += "🚫 "
-							foundThat += vv.Dj
-							foundThat += " was playing "
-						}
-						foundThat += vv.Start.Format("Monday") + " at " + printTime(vv.Start) + " in " + vv.Room + "\n"
-						_, ok := founds[foundThat]
-						if !ok {
-							if lastWasTrue {
-								res += foundThat
-							} else {
-								res = foundThat + res
-							}
-							founds[foundThat] = true
-						}
+						res = append(res, vv)
 						break
 					}
 				}
 			}
 		}
-		if found {
+		if len(res) != 0 {
 			break
 		}
 	}
-	if !found {
+	return res
+}
+
+// FindDJNames returns the names of the DJs matching i (same fuzzy matching as FindDJ)
+func (l *LineUp) FindDJNames(i string) []string {
+	res := []string{}
+	if len(filterNonASCIIAndSpaces(i)) <= minSizeDJSearch {
+		return res
+	}
+	founds := make(map[string]bool)
+	for _, v := range l.matchDJs(i) {
+		if !founds[v.Dj] {
+			founds[v.Dj] = true
+			res = append(res, v.Dj)
+		}
+	}
+	return res
+}
+
+func (l *LineUp) FindDJ(i string, when time.Time) string {
+
+	if len(filterNonASCIIAndSpaces(i)) <= minSizeDJSearch {
+		return minSizeDJSearchText + searchedMessage3
+	}
+
+	found := l.FindDJSets(i, when)
+	if len(found) == 0 {
 		return searchedMessage1 + i + searchedMessage2 + searchedMessageNotFound + searchedMessage3
 	}
 
-	return searchedMessage1 + i + searchedMessage2 + res + searchedMessage3
+	return searchedMessage1 + i + searchedMessage2 + strings.Join(found, "") + searchedMessage3
+}
+
+// FindDJSets returns a line per set of the DJs matching i, the past sets first
+func (l *LineUp) FindDJSets(i string, when time.Time) []string {
+	if len(filterNonASCIIAndSpaces(i)) <= minSizeDJSearch {
+		return nil
+	}
+
+	founds := make(map[string]bool)
+	past := []string{}
+	res := []string{}
+	for _, vv := range l.matchDJs(i) {
+		lastWasTrue := false
+		foundThat := ""
+		if vv.End.After(when) {
+			foundThat += "✅ "
+			foundThat += vv.Dj
+			foundThat += " is playing "
+			lastWasTrue = true
+		} else {
+			foundThat += "🚫 "
+			foundThat += vv.Dj
+			foundThat += " was playing "
+		}
+		foundThat += vv.Start.Format("Monday") + " at " + printTime(vv.Start) + " in " + vv.Room + "\n"
+		_, ok := founds[foundThat]
+		if !ok {
+			if lastWasTrue {
+				res = append(res, foundThat)
+			} else {
+				past = append([]string{foundThat}, past...)
+			}
+			founds[foundThat] = true
+		}
+	}
+	return append(past, res...)
 }
 
 func (l *LineUp) AddSet(s Set) string {
@@ -423,7 +617,7 @@ func (l *LineUp) AddSet(s Set) string {
 	for _, v := range l.Sets {
 		skip := false
 
-		if v.End.After(s.Start) && v.Start.Before(s.End) && v.Room == s.Room {
+		if v.Collides(s) {
 			skip = true
 		}
 
@@ -462,13 +656,30 @@ func (l *LineUp) AddSet(s Set) string {
 	l.computeEvents()
 	return msg
 }
-func (l *LineUp) Init(config *config.Config) {
+func (l *LineUp) Init(config *config.Config, clock clock.Clock) {
+	if clock == nil {
+		panic("nil clock")
+	}
 	l.config = config
+	l.clock = clock
+	// the saved sets only keep the offset of the timezone of the festival
+	loc := config.Lineup.BeginningSchedule.Location()
+	sets := make([]Set, len(l.Sets))
+	for i, v := range l.Sets {
+		v.Start = v.Start.In(loc)
+		v.End = v.End.In(loc)
+		sets[i] = v
+	}
+	l.Sets = sets
+	if l.notified == nil {
+		l.notified = make(map[string]bool)
+	}
 	l.computeEvents()
 }
 
 func (l *LineUp) computeEvents() {
 	events := []Event{}
+	upcoming := []Set{}
 	for _, v := range l.Sets {
 		priority := 0
 		for i, v2 := range l.config.Lineup.Rooms {
@@ -477,14 +688,18 @@ func (l *LineUp) computeEvents() {
 				break
 			}
 		}
-		if v.Start.After(time.Now()) {
-			events = append(events, Event{time: v.Start, dj: v.Dj, room: v.Room, priority: priority})
+		if v.Start.After(l.now()) {
+			events = append(events, Event{Time: v.Start, Dj: v.Dj, Room: v.Room, priority: priority})
+			if !l.notified[setKey(v)] {
+				upcoming = append(upcoming, v)
+			}
 		}
 	}
 	sort.Slice(events, func(i, j int) bool {
 		return events[i].priority > events[j].priority
 	})
 	l.events = events
+	l.upcoming = upcoming
 }
 
 // SameDay function checks if two dates are on the same day
@@ -598,6 +813,41 @@ func (l LineUp) printRoom(sets []Set, oldData bool, oldLineupMessage string, cur
 	return res
 }
 
+// Diff returns the sets added, removed or modified (same room and start) between a and b
+func Diff(a, b *LineUp) LineUpDiff {
+	type setKey struct {
+		room  string
+		start int64
+	}
+	res := LineUpDiff{Added: []Set{}, Removed: []Set{}, Modified: []ModifiedSet{}}
+	before := make(map[setKey]Set)
+	for _, v := range a.Sets {
+		if v.Dj != UnknownDJ {
+			before[setKey{v.Room, v.Start.Unix()}] = v
+		}
+	}
+	after := make(map[setKey]bool)
+	for _, v := range b.Sets {
+		if v.Dj == UnknownDJ {
+			continue
+		}
+		k := setKey{v.Room, v.Start.Unix()}
+		after[k] = true
+		old, ok := before[k]
+		if !ok {
+			res.Added = append(res.Added, v)
+		} else if old.Dj != v.Dj || !old.End.Equal(v.End) {
+			res.Modified = append(res.Modified, ModifiedSet{Before: old, After: v})
+		}
+	}
+	for _, v := range a.Sets {
+		if v.Dj != UnknownDJ && !after[setKey{v.Room, v.Start.Unix()}] {
+			res.Removed = append(res.Removed, v)
+		}
+	}
+	return res
+}
+
 func (l LineUp) PrintForMerge(filterNomSalle string) string {
 	s := []Set{}
 	for _, v := range l.Sets {
@@ -633,7 +883,7 @@ func (l LineUp) PrintForMerge(filterNomSalle string) string {
 }
 
 func (l LineUp) AllSetsFinished() bool {
-	current := time.Now()
+	current := l.now()
 	for _, v := range l.Sets {
 		if v.End.After(current) {
 			return false
@@ -653,7 +903,7 @@ func (l LineUp) FirstSetTime() time.Time {
 }
 
 func (l LineUp) IsPartyGoingOnNow() bool {
-	now := time.Now()
+	now := l.now()
 	for _, v := range l.Sets {
 		if v.Start.Before(now) && v.End.After(now) {
 			return true
@@ -672,7 +922,7 @@ func (l LineUp) AreThereSomeUnknownDjs() bool {
 }
 
 func (l LineUp) Print(youAreHere string, filterNomSalle string) string {
-	current := time.Now()
+	current := l.now()
 	s := []Set{}
 	var oldData bool = true
 	var oldLineupMessage = "\n" + l.config.BotOldLineupMessage
@@ -807,6 +1057,16 @@ func (l LineUp) PrintCurrent() string {
 	return l.PrintCurrentForTime(nil)
 }
 
+// PrintCurrentRoom returns the line of room in PrintCurrent
+func (l LineUp) PrintCurrentRoom(room string) string {
+	for _, v := range strings.Split(l.PrintCurrent(), "\n") {
+		if strings.HasPrefix(v, room+" ") {
+			return v
+		}
+	}
+	return ""
+}
+
 func (l LineUp) calculatePause(closingTime time.Time, room string) *time.Duration {
 	for _, v := range l.Sets {
 		if v.Room == room {
@@ -828,7 +1088,7 @@ func (l LineUp) PrintCurrentForTime(when *string) string {
 	foundCurrent := false
 	nextFound := false
 	//isLast := true
-	current := time.Now()
+	current := l.now()
 	var currentClosingTime time.Time
 
 	if when != nil {
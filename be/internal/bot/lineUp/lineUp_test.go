@@ -7,6 +7,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/clock"
 	"github.com/shallowBunny/app/be/internal/infrastructure/config"
 )
 
@@ -52,7 +53,7 @@ func TestLineUpInput(t *testing.T) {
 		BotAllowInput:  true,
 		NowSkipClosed:  false,
 	} //
-	lu := New(config)
+	lu := New(config, clock.Real)
 
 	got := lu.Dump()
 	want := `roomA:
@@ -182,7 +183,7 @@ func TestFindRoom(t *testing.T) {
 		NowSkipClosed:  false,
 	}
 
-	lu := New(config)
+	lu := New(config, clock.Real)
 
 	inputTest := []test{
 		{input: "Tanzwuste", want: roomTanz},
@@ -221,7 +222,7 @@ func TestFindDJ(t *testing.T) {
 		NowSkipClosed:  false,
 	}
 
-	lu := New(config)
+	lu := New(config, clock.Real)
 
 	day := time.Now().Add(time.Hour * 24 * 3).Format("Monday")
 
@@ -238,3 +239,136 @@ func TestFindDJ(t *testing.T) {
 		}
 	}
 }
+
+func TestUpcomingSets(t *testing.T) {
+	startTime := time.Now().Add(time.Hour)
+	startTime = time.Date(startTime.Year(), startTime.Month(), startTime.Day(), 0, 0, 0, 0, startTime.Location())
+
+	config := &config.Config{
+		Lineup: config.Lineup{
+			BeginningSchedule: startTime,
+			Rooms:             rooms,
+			Sets: map[string][]config.Set{
+				"roomA": []config.Set{
+					config.Set{Day: 3, Hour: 18, Minute: 00, Duration: 60, Dj: "Robyn Schulkowsky"},
+					config.Set{Day: 3, Hour: 19, Minute: 00, Duration: 60, Dj: "Pierre"},
+				},
+			},
+		},
+		NbDaysForInput: 3,
+	}
+
+	lu := New(config, clock.Real)
+	first := startTime.AddDate(0, 0, 3).Add(18 * time.Hour)
+
+	got := lu.UpcomingSets(first.Add(-16*time.Minute), 15*time.Minute)
+	if len(got) != 0 {
+		t.Fatalf("expected no set, got: %v", got)
+	}
+	got = lu.UpcomingSets(first.Add(-15*time.Minute), 15*time.Minute)
+	if len(got) != 1 || got[0].Dj != "Robyn Schulkowsky" {
+		t.Fatalf("expected Robyn Schulkowsky, got: %v", got)
+	}
+	got = lu.UpcomingSets(first, 15*time.Minute)
+	if len(got) != 0 {
+		t.Fatalf("expected set to be returned only once, got: %v", got)
+	}
+
+	// the set notified isn't returned again after a change of the lineup
+	lu.AddSet(lu.NewSet("Techno", roomTurm, 3, 18, 10, 60, nil))
+	got = lu.UpcomingSets(first, 15*time.Minute)
+	if len(got) != 1 || got[0].Dj != "Techno" {
+		t.Fatalf("expected Techno only, got: %v", got)
+	}
+	reloaded := New(config, clock.Real)
+	reloaded.KeepNotified(lu)
+	got = reloaded.UpcomingSets(first, 15*time.Minute)
+	if len(got) != 0 {
+		t.Fatalf("expected no set after a reload, got: %v", got)
+	}
+	// restarted from the saved sets, a duplicate doesn't share them
+	restarted := New(config, clock.Real)
+	restarted.SetNotifiedSets(lu.NotifiedSets())
+	if got = restarted.UpcomingSets(first, 15*time.Minute); len(got) != 0 {
+		t.Fatalf("expected no set after a restart, got: %v", got)
+	}
+	duplicate := lu.DuplicateLineUp()
+	duplicate.AddSet(duplicate.NewSet("Copy", roomTurm, 3, 18, 5, 60, nil))
+	duplicate.UpcomingSets(first, 15*time.Minute)
+	if len(duplicate.NotifiedSets()) != len(lu.NotifiedSets())+1 {
+		t.Fatalf("expected the duplicate to notify its own sets, got: %v %v", duplicate.NotifiedSets(), lu.NotifiedSets())
+	}
+
+	names := lu.FindDJNames("robin")
+	if !reflect.DeepEqual(names, []string{"Robyn Schulkowsky"}) {
+		t.Fatalf("expected Robyn Schulkowsky, got: %v", names)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	startTime := time.Now().Add(time.Hour)
+
+	config := &config.Config{
+		Lineup: config.Lineup{
+			BeginningSchedule: startTime,
+			Rooms:             rooms,
+			Sets: map[string][]config.Set{
+				"roomA": []config.Set{
+					config.Set{Day: 1, Hour: 18, Minute: 00, Duration: 60, Dj: "A"},
+					config.Set{Day: 1, Hour: 19, Minute: 00, Duration: 60, Dj: "B"},
+					config.Set{Day: 1, Hour: 20, Minute: 00, Duration: 60, Dj: "C"},
+				},
+			},
+		},
+		NbDaysForInput: 3,
+	}
+
+	a := New(config, clock.Real)
+	b := a.DuplicateLineUp()
+	b.ApplyChange(inputs.InputCommandResultSet{Room: roomA, Dj: "B", Day: 1, Hour: 19, Duration: 60, Kind: inputs.ChangeRemove})
+	b.ApplyChange(inputs.InputCommandResultSet{Room: roomA, Dj: "C2", Day: 1, Hour: 20, Duration: 90})
+	b.ApplyChange(inputs.InputCommandResultSet{Room: roomA, Dj: "D", Day: 1, Hour: 22, Duration: 60})
+
+	diff := Diff(a, b)
+	if len(diff.Removed) != 1 || diff.Removed[0].Dj != "B" {
+		t.Fatalf("expected B removed, got %v", diff.Removed)
+	}
+	if len(diff.Modified) != 1 || diff.Modified[0].Before.Dj != "C" || diff.Modified[0].After.Dj != "C2" {
+		t.Fatalf("expected C modified, got %v", diff.Modified)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Dj != "D" {
+		t.Fatalf("expected D added, got %v", diff.Added)
+	}
+	if len(a.Sets) != 3 {
+		t.Fatalf("changes should not modify the original lineup, got %v", a.Sets)
+	}
+}
+
+func TestClock(t *testing.T) {
+	startTime := time.Date(2024, 8, 15, 0, 0, 0, 0, time.UTC)
+	config := &config.Config{
+		Lineup: config.Lineup{
+			BeginningSchedule: startTime,
+			Rooms:             []string{roomA},
+			Sets: map[string][]config.Set{
+				roomA: {
+					config.Set{Day: 0, Hour: 23, Minute: 0, Duration: 60, Dj: dj},
+				},
+			},
+		},
+		NbDaysForInput: 1,
+	}
+	fake := clock.NewFake(startTime)
+	lu := New(config, fake)
+	if lu.IsPartyGoingOnNow() || lu.AllSetsFinished() {
+		t.Fatalf("expected the set to be upcoming")
+	}
+	fake.Set(startTime.Add(23*time.Hour + 30*time.Minute))
+	if !lu.IsPartyGoingOnNow() || len(lu.StartedEvents(fake.Now())) != 1 {
+		t.Fatalf("expected the set to be going on")
+	}
+	fake.Add(time.Hour)
+	if !lu.AllSetsFinished() || !lu.DuplicateLineUp().AllSetsFinished() {
+		t.Fatalf("expected the set to be finished")
+	}
+}
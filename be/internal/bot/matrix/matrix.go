@@ -0,0 +1,338 @@
+package matrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot/transport"
+	dao "github.com/shallowBunny/app/be/internal/infrastructure/repository"
+)
+
+// client-server api of a matrix homeserver, each room the bot is in is a chat with a user
+
+const (
+	daoKey             = "matrixRooms"
+	defaultSyncTimeout = 30 * time.Second
+	retryDelay         = 5 * time.Second
+)
+
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// Error is an error answered by the homeserver
+type Error struct {
+	Status       int    `json:"-"`
+	ErrCode      string `json:"errcode"`
+	Message      string `json:"error"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("matrix: %d %v %v", e.Status, e.ErrCode, e.Message)
+}
+
+type event struct {
+	Type    string `json:"type"`
+	Sender  string `json:"sender"`
+	EventID string `json:"event_id"`
+	Content struct {
+		MsgType string `json:"msgtype"`
+		Body    string `json:"body"`
+	} `json:"content"`
+}
+
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []event `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]json.RawMessage `json:"invite"`
+	} `json:"rooms"`
+}
+
+type Matrix struct {
+	homeserver  string
+	userID      string
+	accessToken string
+	client      *http.Client
+	dao         dao.Dao
+	startTime   time.Time
+	syncTimeout time.Duration
+
+	mu    sync.Mutex
+	rooms map[int64]string // user id -> room id
+	txnID int64
+}
+
+func New(homeserver, userID, accessToken string, dao dao.Dao, startTime time.Time) *Matrix {
+	m := &Matrix{
+		homeserver:  strings.TrimSuffix(homeserver, "/"),
+		userID:      userID,
+		accessToken: accessToken,
+		client:      &http.Client{Timeout: defaultSyncTimeout + 30*time.Second},
+		dao:         dao,
+		startTime:   startTime,
+		syncTimeout: defaultSyncTimeout,
+		rooms:       make(map[int64]string),
+		txnID:       time.Now().UnixNano(),
+	}
+	s, err := dao.Get(daoKey, startTime)
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			log.Warn().Msg("empty dao.matrixRooms")
+		} else {
+			log.Error().Msg(err.Error())
+		}
+		return m
+	}
+	rooms := []string{}
+	if err := json.Unmarshal([]byte(s), &rooms); err != nil {
+		log.Error().Msg(err.Error())
+		return m
+	}
+	for _, v := range rooms {
+		m.rooms[m.id(v)] = v
+	}
+	return m
+}
+
+func (m *Matrix) id(roomID string) int64 {
+	return transport.HashID(m.Name(), roomID)
+}
+
+// userIDForRoom returns the user id of a room, new rooms are persisted so notifications can
+// be sent to them after a restart
+func (m *Matrix) userIDForRoom(roomID string) int64 {
+	id := m.id(roomID)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.rooms[id]; ok {
+		return id
+	}
+	m.rooms[id] = roomID
+	rooms := []string{}
+	for _, v := range m.rooms {
+		rooms = append(rooms, v)
+	}
+	bytes, err := json.Marshal(rooms)
+	if err != nil {
+		panic(err)
+	}
+	if err := m.dao.Save(daoKey, m.startTime, string(bytes)); err != nil {
+		log.Error().Msg(err.Error())
+	}
+	return id
+}
+
+func (m *Matrix) room(userID int64) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room, ok := m.rooms[userID]
+	return room, ok
+}
+
+func (m *Matrix) nextTxnID() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.txnID++
+	return strconv.FormatInt(m.txnID, 10)
+}
+
+func (m *Matrix) do(method, path string, query url.Values, body io.Reader, contentType string, res interface{}) error {
+	u := m.homeserver + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.accessToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := &Error{Status: resp.StatusCode}
+		_ = json.Unmarshal(data, e)
+		return e
+	}
+	if res != nil {
+		return json.Unmarshal(data, res)
+	}
+	return nil
+}
+
+func (m *Matrix) doJSON(method, path string, body interface{}, res interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return m.do(method, path, nil, bytes.NewReader(data), "application/json", res)
+}
+
+func (m *Matrix) Name() string {
+	return "matrix"
+}
+
+func (m *Matrix) Owns(userID int64) bool {
+	_, ok := m.room(userID)
+	return ok
+}
+
+// IsBlocked returns true when the bot isn't allowed in the room anymore (the user left it)
+func (m *Matrix) IsBlocked(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Status == http.StatusForbidden
+}
+
+// Retry retries the rate limited sends after the delay asked and the server or network errors
+func (m *Matrix) Retry(err error) (bool, time.Duration) {
+	var e *Error
+	if errors.As(err, &e) {
+		if e.Status == http.StatusTooManyRequests {
+			return true, time.Duration(e.RetryAfterMs) * time.Millisecond
+		}
+		return e.Status >= http.StatusInternalServerError, 0
+	}
+	return true, 0
+}
+
+func (m *Matrix) sendEvent(userID int64, content map[string]interface{}) error {
+	room, ok := m.room(userID)
+	if !ok {
+		return fmt.Errorf("matrix: unknown user %d", userID)
+	}
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(room) + "/send/m.room.message/" + m.nextTxnID()
+	return m.doJSON(http.MethodPut, path, content, nil)
+}
+
+// SendText sends a text, matrix having no keyboards the buttons are listed at the end of it
+func (m *Matrix) SendText(userID int64, text string, html bool, buttons []string, replyTo string) error {
+	body := text
+	formatted := strings.ReplaceAll(text, "\n", "<br>")
+	if len(buttons) != 0 {
+		body += "\n\n" + strings.Join(buttons, " · ")
+		formatted += "<br><br>" + strings.Join(buttons, " · ")
+	}
+	content := map[string]interface{}{
+		"msgtype": "m.text",
+		"body":    body,
+	}
+	if html {
+		content["body"] = htmlTagRegex.ReplaceAllString(body, "")
+		content["format"] = "org.matrix.custom.html"
+		content["formatted_body"] = formatted
+	}
+	if replyTo != "" {
+		content["m.relates_to"] = map[string]interface{}{
+			"m.in_reply_to": map[string]string{"event_id": replyTo},
+		}
+	}
+	return m.sendEvent(userID, content)
+}
+
+func (m *Matrix) SendImage(userID int64, path string, caption string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	var upload struct {
+		ContentURI string `json:"content_uri"`
+	}
+	query := url.Values{"filename": {filepath.Base(path)}}
+	if err := m.do(http.MethodPost, "/_matrix/media/v3/upload", query, bytes.NewReader(data), contentType, &upload); err != nil {
+		return err
+	}
+	body := caption
+	if body == "" {
+		body = filepath.Base(path)
+	}
+	return m.sendEvent(userID, map[string]interface{}{
+		"msgtype": "m.image",
+		"body":    htmlTagRegex.ReplaceAllString(body, ""),
+		"url":     upload.ContentURI,
+		"info":    map[string]interface{}{"mimetype": contentType, "size": len(data)},
+	})
+}
+
+// Receive long polls /sync, joins the rooms the bot is invited in and handles the text
+// messages of the joined rooms. The history returned by the first sync is skipped.
+func (m *Matrix) Receive(quit <-chan struct{}, handle func(transport.Update)) {
+	since := ""
+	for {
+		select {
+		case <-quit:
+			log.Info().Msg("Shutting down Matrix listener gracefully")
+			return
+		default:
+		}
+
+		query := url.Values{"timeout": {strconv.FormatInt(m.syncTimeout.Milliseconds(), 10)}}
+		if since != "" {
+			query.Set("since", since)
+		}
+		var res syncResponse
+		if err := m.do(http.MethodGet, "/_matrix/client/v3/sync", query, nil, "", &res); err != nil {
+			log.Error().Msg(fmt.Sprintf("matrix sync: %v", err))
+			select {
+			case <-quit:
+				return
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+
+		for room := range res.Rooms.Invite {
+			log.Info().Msg("matrix: joining " + room)
+			if err := m.doJSON(http.MethodPost, "/_matrix/client/v3/join/"+url.PathEscape(room), struct{}{}, nil); err != nil {
+				log.Error().Msg(err.Error())
+			}
+		}
+
+		if since != "" {
+			for room, v := range res.Rooms.Join {
+				for _, e := range v.Timeline.Events {
+					if e.Type != "m.room.message" || e.Content.MsgType != "m.text" || e.Sender == m.userID {
+						continue
+					}
+					handle(transport.Update{
+						UserID:    m.userIDForRoom(room),
+						UserName:  e.Sender,
+						Text:      e.Content.Body,
+						MessageID: e.EventID,
+					})
+				}
+			}
+		}
+		since = res.NextBatch
+	}
+}
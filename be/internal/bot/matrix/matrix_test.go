@@ -0,0 +1,146 @@
+package matrix
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/bot/transport"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+const (
+	botUser   = "@bunny:fake"
+	testToken = "secret"
+)
+
+type sent struct {
+	room    string
+	content map[string]interface{}
+}
+
+// fakeHomeserver answers /sync with a scripted list of batches and records what the bot sends
+type fakeHomeserver struct {
+	mu      sync.Mutex
+	batches []string
+	joined  []string
+	sent    chan sent
+}
+
+func message(room, sender, id, body string) string {
+	return `"` + room + `":{"timeline":{"events":[{"type":"m.room.message","sender":"` + sender + `","event_id":"` + id + `","content":{"msgtype":"m.text","body":"` + body + `"}}]}}`
+}
+
+func (f *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"errcode":"M_UNKNOWN_TOKEN","error":"bad token"}`))
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.URL.Path == "/_matrix/client/v3/sync":
+		// next_batch is the index of the next batch to return
+		next, _ := strconv.Atoi(r.URL.Query().Get("since"))
+		if next >= len(f.batches) {
+			f.mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			f.mu.Lock()
+			w.Write([]byte(`{"next_batch":"` + strconv.Itoa(next) + `"}`))
+			return
+		}
+		w.Write([]byte(`{"next_batch":"` + strconv.Itoa(next+1) + `","rooms":` + f.batches[next] + `}`))
+	case strings.HasPrefix(r.URL.Path, "/_matrix/client/v3/join/"):
+		f.joined = append(f.joined, strings.TrimPrefix(r.URL.Path, "/_matrix/client/v3/join/"))
+		w.Write([]byte(`{}`))
+	case strings.HasPrefix(r.URL.Path, "/_matrix/client/v3/rooms/") && r.Method == http.MethodPut:
+		room := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/_matrix/client/v3/rooms/"), "/", 2)[0]
+		if room == "!left:fake" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errcode":"M_FORBIDDEN","error":"not in room"}`))
+			return
+		}
+		var content map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&content)
+		f.sent <- sent{room: room, content: content}
+		w.Write([]byte(`{"event_id":"$sent"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestMatrixTransport(t *testing.T) {
+	c, err := config.New("../../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := time.Now()
+	c.Lineup.BeginningSchedule = time.Date(tt.Year()+1, 1, 1, 0, 0, 0, 0, tt.Location())
+
+	fake := &fakeHomeserver{
+		batches: []string{
+			// first sync: history is skipped
+			`{"join":{` + message("!old:fake", "@alice:fake", "$old", "now") + `}}`,
+			`{"invite":{"!new:fake":{}},"join":{` + message("!dm:fake", "@alice:fake", "$1", "now") + `,` + message("!mine:fake", botUser, "$2", "now") + `}}`,
+		},
+		sent: make(chan sent, 10),
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	b := bot.New(DaoMem.New(), c)
+	m := New(server.URL, botUser, testToken, DaoMem.New(), c.Lineup.BeginningSchedule)
+	m.syncTimeout = 10 * time.Millisecond
+	quit := make(chan struct{})
+	defer close(quit)
+	transport.Run(b, []transport.Transport{m}, quit)
+
+	select {
+	case s := <-fake.sent:
+		if s.room != "!dm:fake" {
+			t.Errorf("expected an answer in !dm:fake, got %v", s.room)
+		}
+		relates, _ := s.content["m.relates_to"].(map[string]interface{})
+		reply, _ := relates["m.in_reply_to"].(map[string]interface{})
+		if reply["event_id"] != "$1" {
+			t.Errorf("expected a reply to $1, got %v", s.content)
+		}
+		if s.content["body"] == "" {
+			t.Errorf("empty answer %v", s.content)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no answer from the bot")
+	}
+	select {
+	case s := <-fake.sent:
+		t.Errorf("unexpected message %v", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	fake.mu.Lock()
+	if len(fake.joined) != 1 || fake.joined[0] != "!new:fake" {
+		t.Errorf("expected to join !new:fake, got %v", fake.joined)
+	}
+	fake.mu.Unlock()
+
+	id := transport.HashID("matrix", "!dm:fake")
+	if !m.Owns(id) || m.Owns(transport.HashID("matrix", "!old:fake")) || m.Owns(123) {
+		t.Errorf("unexpected owned users")
+	}
+
+	// a user who left the room is reported as blocked
+	left := m.userIDForRoom("!left:fake")
+	err = m.SendText(left, "hello", false, nil, "")
+	if !m.IsBlocked(err) || m.IsBlocked(errors.New("timeout")) {
+		t.Errorf("expected blocked error, got %v", err)
+	}
+}
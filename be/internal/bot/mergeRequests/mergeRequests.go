@@ -0,0 +1,181 @@
+package mergeRequests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	dao "github.com/shallowBunny/app/be/internal/infrastructure/repository"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusAccepted  Status = "accepted"
+	StatusRefused   Status = "refused"
+	daoKey                 = "mergeRequests"
+	mergeRequestKey        = "mergeRequest-%d"
+)
+
+type MergeRequest struct {
+	Changes           []inputs.InputCommandResultSet
+	UserId            int64
+	User              string
+	Created           time.Time
+	ID                int
+	Info              string
+	BeginningSchedule time.Time
+	Status            Status
+	DecidedBy         string
+	DecidedByUserId   int64
+	Decided           time.Time
+}
+
+// stored is what is persisted through the dao under daoKey, each merge request is saved apart
+// under mergeRequestKey. MergeRequests is only set by the versions saving every merge request
+// under daoKey.
+type stored struct {
+	LastID        int
+	MergeRequests []*MergeRequest `json:",omitempty"`
+}
+
+type MergeRequests struct {
+	lastID        int
+	mergeRequests []*MergeRequest
+	dao           dao.Dao
+	startTime     time.Time
+}
+
+func New(dao dao.Dao, startTime time.Time) MergeRequests {
+	res := MergeRequests{
+		mergeRequests: []*MergeRequest{},
+		dao:           dao,
+		startTime:     startTime,
+	}
+	s, err := dao.Get(daoKey, startTime)
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			log.Warn().Msg("empty dao.MergeRequests")
+		} else {
+			log.Error().Msg(err.Error())
+		}
+		return res
+	}
+	var st stored
+	err = json.Unmarshal([]byte(s), &st)
+	if err != nil {
+		log.Error().Msg(err.Error())
+		return res
+	}
+	res.lastID = st.LastID
+	if st.MergeRequests != nil {
+		res.mergeRequests = st.MergeRequests
+		log.Info().Msg(fmt.Sprintf("saving %d merge requests apart", len(res.mergeRequests)))
+		for _, v := range res.mergeRequests {
+			if err := res.saveMergeRequest(v); err != nil {
+				log.Error().Msg(err.Error())
+			}
+		}
+		if err := res.save(); err != nil {
+			log.Error().Msg(err.Error())
+		}
+		return res
+	}
+	for id := 1; id <= res.lastID; id++ {
+		s, err := dao.Get(fmt.Sprintf(mergeRequestKey, id), startTime)
+		if err != nil {
+			log.Error().Msg(fmt.Sprintf("merge request #%d: %v", id, err))
+			continue
+		}
+		mr := &MergeRequest{}
+		if err := json.Unmarshal([]byte(s), mr); err != nil {
+			log.Error().Msg(err.Error())
+			continue
+		}
+		res.mergeRequests = append(res.mergeRequests, mr)
+	}
+	return res
+}
+
+func (m *MergeRequests) save() error {
+	bytes, err := json.Marshal(stored{LastID: m.lastID})
+	if err != nil {
+		panic(err)
+	}
+	return m.dao.Save(daoKey, m.startTime, string(bytes))
+}
+
+func (m *MergeRequests) saveMergeRequest(mr *MergeRequest) error {
+	bytes, err := json.Marshal(mr)
+	if err != nil {
+		panic(err)
+	}
+	return m.dao.Save(fmt.Sprintf(mergeRequestKey, mr.ID), m.startTime, string(bytes))
+}
+
+// Add stores a new pending merge request and gives it the next ID
+func (m *MergeRequests) Add(mr *MergeRequest) error {
+	m.lastID++
+	mr.ID = m.lastID
+	mr.Status = StatusPending
+	stored := *mr
+	m.mergeRequests = append(m.mergeRequests, &stored)
+	// saved before the last id, a merge request is never overwritten after a restart
+	if err := m.saveMergeRequest(&stored); err != nil {
+		return err
+	}
+	return m.save()
+}
+
+// Pending returns the pending merge requests, oldest first
+func (m MergeRequests) Pending() []MergeRequest {
+	res := []MergeRequest{}
+	for _, v := range m.mergeRequests {
+		if v.Status == StatusPending {
+			res = append(res, *v)
+		}
+	}
+	return res
+}
+
+// Decided returns the accepted or refused merge requests, last decided first
+func (m MergeRequests) Decided() []MergeRequest {
+	res := []MergeRequest{}
+	for i := len(m.mergeRequests) - 1; i >= 0; i-- {
+		if m.mergeRequests[i].Status != StatusPending {
+			res = append(res, *m.mergeRequests[i])
+		}
+	}
+	return res
+}
+
+func (m MergeRequests) Get(id int) (MergeRequest, bool) {
+	for _, v := range m.mergeRequests {
+		if v.ID == id {
+			return *v, true
+		}
+	}
+	return MergeRequest{}, false
+}
+
+// Decide accepts or refuses a pending merge request and records who did it and when
+func (m *MergeRequests) Decide(id int, status Status, by string, byUserId int64, at time.Time) (MergeRequest, error) {
+	for _, v := range m.mergeRequests {
+		if v.ID != id {
+			continue
+		}
+		if v.Status != StatusPending {
+			return *v, fmt.Errorf("merge request #%d already %v by %v", id, v.Status, v.DecidedBy)
+		}
+		v.Status = status
+		v.DecidedBy = by
+		v.DecidedByUserId = byUserId
+		v.Decided = at
+		return *v, m.saveMergeRequest(v)
+	}
+	return MergeRequest{}, errors.New("unknown merge request")
+}
@@ -0,0 +1,91 @@
+package mergeRequests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+// daoTest keeps what is saved so a restart can be simulated
+type daoTest struct {
+	*DaoMem.DaoMem
+	values map[string]string
+}
+
+func (d daoTest) Save(key string, startTime time.Time, value string) error {
+	d.values[key+startTime.String()] = value
+	return nil
+}
+
+func (d daoTest) Get(key string, startTime time.Time) (string, error) {
+	v, ok := d.values[key+startTime.String()]
+	if !ok {
+		return "", errors.New("redis: nil")
+	}
+	return v, nil
+}
+
+func TestMergeRequestsRestart(t *testing.T) {
+	dao := daoTest{DaoMem.New(), make(map[string]string)}
+	startTime := time.Now()
+
+	m := New(dao, startTime)
+	mr1 := &MergeRequest{User: "a"}
+	mr2 := &MergeRequest{User: "b"}
+	if err := m.Add(mr1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := m.Add(mr2); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if mr1.ID != 1 || mr2.ID != 2 {
+		t.Fatalf("expected IDs 1 and 2, got %d and %d", mr1.ID, mr2.ID)
+	}
+	if _, err := m.Decide(mr1.ID, StatusAccepted, "modo", 42, time.Now()); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := m.Decide(mr1.ID, StatusRefused, "modo2", 43, time.Now()); err == nil {
+		t.Fatalf("expected an error when deciding twice")
+	}
+
+	// restart
+	m = New(dao, startTime)
+	pending := m.Pending()
+	if len(pending) != 1 || pending[0].ID != 2 {
+		t.Fatalf("expected pending #2, got %v", pending)
+	}
+	decided := m.Decided()
+	if len(decided) != 1 || decided[0].DecidedBy != "modo" || decided[0].Status != StatusAccepted || decided[0].Decided.IsZero() {
+		t.Fatalf("expected #1 accepted by modo, got %v", decided)
+	}
+	mr3 := &MergeRequest{User: "c"}
+	if err := m.Add(mr3); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if mr3.ID != 3 {
+		t.Fatalf("expected ID 3 after restart, got %d", mr3.ID)
+	}
+}
+
+func TestMergeRequestsLegacy(t *testing.T) {
+	dao := DaoMem.New()
+	startTime := time.Now()
+	// every merge request in one value, as saved by the previous versions
+	dao.Save(daoKey, startTime, `{"LastID":2,"MergeRequests":[{"ID":1,"User":"a","Status":"accepted"},{"ID":2,"User":"b","Status":"pending"}]}`)
+
+	for i := 0; i < 2; i++ {
+		// loaded from the legacy value, then from the values saved apart
+		m := New(dao, startTime)
+		if pending := m.Pending(); len(pending) != 1 || pending[0].User != "b" {
+			t.Fatalf("%d: expected pending #2, got %v", i, pending)
+		}
+		if decided := m.Decided(); len(decided) != 1 || decided[0].User != "a" {
+			t.Fatalf("%d: expected #1 accepted, got %v", i, decided)
+		}
+	}
+	if s, _ := dao.Get(daoKey, startTime); s != `{"LastID":2}` {
+		t.Fatalf("expected only the last id in %v, got %v", daoKey, s)
+	}
+}
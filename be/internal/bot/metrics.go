@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/metrics"
+)
+
+var commandsTotal = metrics.NewCounter("shallowbunny_bot_commands_total", "Commands processed by the bot, the unknown ones (rooms, djs searched...) are counted as other.", "festival", "command")
+
+// knownCommands are the commands of runCommand, other texts would be unbounded labels
+var knownCommands = map[string]bool{
+	"start": true, strings.ToLower(helpCommand): true, "stop": true, stopNotificationsCommand: true,
+	startNotificationsCommand: true, likeCommand: true, unlikeCommand: true, likesCommand: true,
+	icsCommand: true, mrsCommand: true, "p": true, "all": true, "now": true, "t": true, "events": true,
+	"print": true, "dump": true, "hole": true, announceCommand: true, statsCommand: true, inputs.RebaseCommand: true,
+	inputs.MergeCommand: true, inputs.InputCommand: true, inputs.EditSetCommand: true,
+	inputs.RemoveSetCommand: true, inputs.LogCommand: true,
+}
+
+func commandLabel(command string) string {
+	if knownCommands[command] {
+		return command
+	}
+	return "other"
+}
+
+// ActivityStats are the gauges of a festival exposed on /metrics
+type ActivityStats struct {
+	PendingMergeRequests int
+	Inputs               int // wizards in progress
+	NotifiedUsers        int
+	StreamSubscribers    int
+}
+
+func (b *Bot) ActivityStats() ActivityStats {
+	b.lock()
+	defer b.unlock()
+	return ActivityStats{
+		PendingMergeRequests: len(b.mergeRequests.Pending()),
+		Inputs:               len(b.RootLineUp.Inputs.States),
+		NotifiedUsers:        len(b.users.UsersWithNotifications()),
+		StreamSubscribers:    len(b.subscribers),
+	}
+}
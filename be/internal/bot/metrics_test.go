@@ -0,0 +1,33 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func TestMetrics(t *testing.T) {
+	c, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := timeTests
+	c.Lineup.BeginningSchedule = time.Date(tt.Year(), tt.Month(), tt.Day(), 0, 0, 0, 0, tt.Location())
+	bot := New(DaoMem.New(), c)
+	bot.channel = nil
+
+	now, other, input := commandsTotal.Value("test", "now"), commandsTotal.Value("test", "other"), commandsTotal.Value("test", inputs.InputCommand)
+	bot.ProcessCommand(123, "/now", "test")
+	bot.ProcessCommand(123, "DJ FART", "test")
+	bot.ProcessCommand(123, inputs.InputCommand, "test")
+	bot.ProcessCommand(123, "🍵", "test")
+	if commandsTotal.Value("test", "now") != now+1 || commandsTotal.Value("test", "other") != other+1 || commandsTotal.Value("test", inputs.InputCommand) != input+2 {
+		t.Fatalf("unexpected commands counted")
+	}
+	if s := bot.ActivityStats(); s.Inputs != 1 || s.PendingMergeRequests != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
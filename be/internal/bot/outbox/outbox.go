@@ -0,0 +1,363 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot"
+	dao "github.com/shallowBunny/app/be/internal/infrastructure/repository"
+)
+
+const (
+	daoKey = "outbox"
+	// telegram: about one message per second per chat with short bursts, 30 per second overall
+	chatRate     = 1.0
+	chatBurst    = 3.0
+	globalRate   = 25.0
+	globalBurst  = 30.0
+	maxAttempts  = 8
+	minBackoff   = time.Second
+	maxBackoff   = 5 * time.Minute
+	maxDead      = 100
+	saveInterval = time.Second
+	idleWait     = time.Minute
+)
+
+type Item struct {
+	ID        int64
+	Message   bot.Message
+	ReplyTo   string
+	Answer    bool // answer to a user, sent before the notifications
+	Created   time.Time
+	NotBefore time.Time
+	Attempts  int
+	LastError string
+}
+
+// stored is what is persisted through the dao
+type stored struct {
+	LastID int64
+	Items  []*Item
+	Dead   []*Item
+}
+
+// bucket is a token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) refill(now time.Time, rate, burst float64) {
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+}
+
+// wait returns how long to wait for a token
+func (b *bucket) wait(now time.Time, rate, burst float64) time.Duration {
+	b.refill(now, rate, burst)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+func (b *bucket) take(now time.Time, rate, burst float64) {
+	b.refill(now, rate, burst)
+	b.tokens--
+}
+
+type Stats struct {
+	Sent      int
+	Retried   int
+	Dead      int
+	Blocked   int
+	LastError string
+}
+
+// Outbox is the queue of the messages waiting to be sent, persisted through the dao so a restart
+// doesn't lose them. Messages of a chat are sent in order, within per chat and global rate limits.
+type Outbox struct {
+	mu          sync.Mutex
+	dao         dao.Dao
+	startTime   time.Time
+	lastID      int64
+	items       []*Item
+	dead        []*Item
+	chats       map[int64]*bucket
+	global      bucket
+	pausedUntil time.Time // set by a rate limited error
+	inFlight    map[int64]bool
+	dirty       bool
+	lastSave    time.Time
+	stats       Stats
+	wake        chan struct{} // closed and replaced by Push to wake up the senders
+}
+
+func New(dao dao.Dao, startTime time.Time) *Outbox {
+	o := &Outbox{
+		dao:       dao,
+		startTime: startTime,
+		items:     []*Item{},
+		dead:      []*Item{},
+		chats:     make(map[int64]*bucket),
+		inFlight:  make(map[int64]bool),
+		wake:      make(chan struct{}),
+	}
+	s, err := dao.Get(daoKey, startTime)
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			log.Warn().Msg("empty dao.outbox")
+		} else {
+			log.Error().Msg(err.Error())
+		}
+		return o
+	}
+	var st stored
+	if err := json.Unmarshal([]byte(s), &st); err != nil {
+		log.Error().Msg(err.Error())
+		return o
+	}
+	o.lastID = st.LastID
+	if st.Items != nil {
+		o.items = st.Items
+	}
+	if st.Dead != nil {
+		o.dead = st.Dead
+	}
+	if len(o.items) != 0 {
+		log.Info().Msg(fmt.Sprintf("outbox: %d messages to send after restart", len(o.items)))
+	}
+	return o
+}
+
+func (o *Outbox) save() {
+	bytes, err := json.Marshal(stored{LastID: o.lastID, Items: o.items, Dead: o.dead})
+	if err != nil {
+		panic(err)
+	}
+	// a failed save is retried after saveInterval
+	o.lastSave = time.Now()
+	if err := o.dao.Save(daoKey, o.startTime, string(bytes)); err != nil {
+		log.Error().Msg(err.Error())
+		return
+	}
+	o.dirty = false
+}
+
+// saveLater saves at most once per saveInterval: a restart may send a message twice but not lose it
+func (o *Outbox) saveLater() {
+	o.dirty = true
+	if time.Since(o.lastSave) >= saveInterval {
+		o.save()
+	}
+}
+
+// Flush saves the pending changes
+func (o *Outbox) Flush() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.dirty {
+		o.save()
+	}
+}
+
+// Push queues messages, saved within saveInterval
+func (o *Outbox) Push(replyTo string, answer bool, messages ...bot.Message) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	for i, m := range messages {
+		o.lastID++
+		item := &Item{ID: o.lastID, Message: m, Answer: answer, Created: now}
+		if i == 0 {
+			item.ReplyTo = replyTo
+		}
+		o.items = append(o.items, item)
+	}
+	o.saveLater()
+	close(o.wake)
+	o.wake = make(chan struct{})
+}
+
+// Next returns the next message to send, or how long to wait for one unless wake is closed
+// before by a new message. The returned item is in flight until Done, Retry or Fail is called.
+func (o *Outbox) Next(now time.Time) (item *Item, wait time.Duration, wake <-chan struct{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.dirty && now.Sub(o.lastSave) >= saveInterval {
+		o.save()
+	}
+	if now.Before(o.pausedUntil) {
+		return nil, o.pausedUntil.Sub(now), o.wake
+	}
+	if w := o.global.wait(now, globalRate, globalBurst); w != 0 {
+		return nil, w, o.wake
+	}
+	wait = idleWait
+	var next *Item
+	seen := make(map[int64]bool)
+	for _, v := range o.items {
+		chat := v.Message.UserID
+		if seen[chat] {
+			// the older message of the chat goes first
+			continue
+		}
+		seen[chat] = true
+		if o.inFlight[chat] {
+			continue
+		}
+		if v.NotBefore.After(now) {
+			wait = min(wait, v.NotBefore.Sub(now))
+			continue
+		}
+		if o.chats[chat] == nil {
+			o.chats[chat] = &bucket{}
+		}
+		if w := o.chats[chat].wait(now, chatRate, chatBurst); w != 0 {
+			wait = min(wait, w)
+			continue
+		}
+		if next == nil || (v.Answer && !next.Answer) {
+			next = v
+		}
+	}
+	if next == nil {
+		return nil, wait, o.wake
+	}
+	o.inFlight[next.Message.UserID] = true
+	o.chats[next.Message.UserID].take(now, chatRate, chatBurst)
+	o.global.take(now, globalRate, globalBurst)
+	return next, 0, o.wake
+}
+
+func (o *Outbox) remove(item *Item) {
+	delete(o.inFlight, item.Message.UserID)
+	for i, v := range o.items {
+		if v.ID == item.ID {
+			o.items = append(o.items[:i:i], o.items[i+1:]...)
+			return
+		}
+	}
+}
+
+// Done removes a sent message
+func (o *Outbox) Done(item *Item) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.remove(item)
+	o.stats.Sent++
+	o.saveLater()
+}
+
+// Retry sends the message again later, after the delay asked by the chat network (after != 0,
+// the whole outbox pauses) or an exponential backoff. It is dead-lettered after maxAttempts.
+func (o *Outbox) Retry(item *Item, err error, after time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.inFlight, item.Message.UserID)
+	item.Attempts++
+	item.LastError = err.Error()
+	o.stats.LastError = err.Error()
+	if item.Attempts >= maxAttempts {
+		o.deadLetter(item)
+		return
+	}
+	now := time.Now()
+	if after != 0 {
+		o.pausedUntil = now.Add(after)
+		item.NotBefore = now.Add(after)
+	} else {
+		backoff := minBackoff << (item.Attempts - 1)
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		item.NotBefore = now.Add(backoff)
+	}
+	o.stats.Retried++
+	o.saveLater()
+}
+
+// Fail drops a message that can't be sent, blocked is true when the user blocked the bot
+func (o *Outbox) Fail(item *Item, err error, blocked bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	item.LastError = err.Error()
+	o.stats.LastError = err.Error()
+	if blocked {
+		// the user is deleted, the other messages to them would fail the same way
+		o.stats.Blocked++
+		items := []*Item{}
+		for _, v := range o.items {
+			if v.Message.UserID != item.Message.UserID {
+				items = append(items, v)
+			}
+		}
+		o.items = items
+		delete(o.inFlight, item.Message.UserID)
+		o.saveLater()
+		return
+	}
+	o.deadLetter(item)
+}
+
+func (o *Outbox) deadLetter(item *Item) {
+	log.Error().Msg(fmt.Sprintf("outbox: giving up message %d to %d after %d attempts: %v", item.ID, item.Message.UserID, item.Attempts, item.LastError))
+	o.remove(item)
+	o.dead = append(o.dead, item)
+	if len(o.dead) > maxDead {
+		o.dead = o.dead[len(o.dead)-maxDead:]
+	}
+	o.stats.Dead++
+	o.save()
+}
+
+// Len returns the number of messages waiting
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.items)
+}
+
+// Dead returns the last messages given up
+func (o *Outbox) Dead() []Item {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	res := []Item{}
+	for _, v := range o.dead {
+		res = append(res, *v)
+	}
+	return res
+}
+
+func (o *Outbox) Stats() Stats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.stats
+}
+
+// String returns the queue depth and the failures since the start, shown by /log
+func (o *Outbox) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	res := fmt.Sprintf("Outbox: queued:%d sent:%d retried:%d dead:%d blocked:%d", len(o.items), o.stats.Sent, o.stats.Retried, o.stats.Dead, o.stats.Blocked)
+	if len(o.items) != 0 {
+		res += fmt.Sprintf(" oldest:%v", time.Since(o.items[0].Created).Round(time.Second))
+	}
+	if time.Now().Before(o.pausedUntil) {
+		res += fmt.Sprintf(" paused:%v", time.Until(o.pausedUntil).Round(time.Second))
+	}
+	if o.stats.LastError != "" {
+		res += "\nlast error: " + o.stats.LastError
+	}
+	return res
+}
@@ -0,0 +1,102 @@
+package outbox
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func messages(userID int64, texts ...string) []bot.Message {
+	res := []bot.Message{}
+	for _, v := range texts {
+		res = append(res, bot.Message{UserID: userID, Text: v})
+	}
+	return res
+}
+
+func TestOrderAndRateLimit(t *testing.T) {
+	o := New(DaoMem.New(), time.Now())
+	o.Push("", false, messages(1, "a", "b", "c", "d")...)
+	o.Push("", false, messages(2, "x")...)
+	o.Push("42", true, messages(3, "answer")...)
+
+	now := time.Now()
+	sent := []string{}
+	for {
+		item, wait, _ := o.Next(now)
+		if item == nil {
+			if wait <= 0 || wait > time.Second {
+				t.Fatalf("unexpected wait %v", wait)
+			}
+			break
+		}
+		sent = append(sent, item.Message.Text)
+		o.Done(item)
+	}
+	// the answer first, then the burst of chat 1 in order
+	if strings.Join(sent, ",") != "answer,a,b,c,x" {
+		t.Fatalf("unexpected messages sent %v", sent)
+	}
+	// one message in flight per chat
+	item, _, _ := o.Next(now.Add(time.Second))
+	if other, _, _ := o.Next(now.Add(2 * time.Second)); other != nil {
+		t.Fatalf("two messages of the same chat in flight %v", other)
+	}
+	if item == nil || item.Message.Text != "d" {
+		t.Fatalf("expected d a second later, got %v", item)
+	}
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	o := New(DaoMem.New(), time.Now())
+	o.Push("", false, messages(1, "a")...)
+
+	item, _, _ := o.Next(time.Now())
+	o.Retry(item, errors.New("Too Many Requests"), 30*time.Second)
+	if item, wait, _ := o.Next(time.Now()); item != nil || wait < 29*time.Second {
+		t.Fatalf("expected the outbox to be paused, got %v %v", item, wait)
+	}
+
+	for i := 1; i < maxAttempts; i++ {
+		item, _, _ = o.Next(time.Now().Add(time.Duration(i) * time.Hour))
+		if item == nil {
+			t.Fatalf("expected a retry at attempt %d", i)
+		}
+		o.Retry(item, errors.New("Bad Gateway"), 0)
+	}
+	if o.Len() != 0 || len(o.Dead()) != 1 || o.Dead()[0].Attempts != maxAttempts {
+		t.Fatalf("expected the message to be dead-lettered, got %v %v", o.Len(), o.Dead())
+	}
+	stats := o.Stats()
+	if stats.Dead != 1 || stats.Retried != maxAttempts-1 || stats.LastError != "Bad Gateway" {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestBlockedAndRestart(t *testing.T) {
+	d := DaoMem.New()
+	startTime := time.Now()
+	o := New(d, startTime)
+	o.Push("", false, messages(1, "a", "b")...)
+	o.Push("", false, messages(2, "x", "y")...)
+
+	item, _, _ := o.Next(time.Now())
+	o.Fail(item, errors.New("Forbidden: bot was blocked by the user"), true)
+	if o.Len() != 2 || o.Stats().Blocked != 1 {
+		t.Fatalf("expected the messages of the blocked user to be dropped, got %v", o.Len())
+	}
+	item, _, _ = o.Next(time.Now())
+	o.Done(item)
+	o.Flush()
+
+	// the message not sent yet is sent after a restart
+	o = New(d, startTime)
+	item, _, _ = o.Next(time.Now())
+	if o.Len() != 1 || item == nil || item.Message.Text != "y" {
+		t.Fatalf("expected y after restart, got %v", item)
+	}
+}
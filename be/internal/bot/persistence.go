@@ -0,0 +1,261 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+)
+
+// the root lineup is saved with SaveBot, the detached lineups and the inputs in progress
+// are saved apart by user
+const (
+	lineUpsKey = "lineups"   // lineUpsIndex
+	lineUpKey  = "lineup-%d" // detached lineup of a user
+	inputKey   = "input-%d"  // input in progress of a user
+)
+
+// savedLineUp is what is saved of a lineup, the rest comes from the config
+type savedLineUp struct {
+	Sets     []lineUp.Set
+	Changes  []inputs.InputCommandResultSet
+	Version  int      `json:",omitempty"` // lineUpVersion of the root lineup
+	Notified []string `json:",omitempty"` // sets of the root lineup whose likes were notified
+}
+
+// lineUpsIndex lists the users having a detached lineup or an input saved
+type lineUpsIndex struct {
+	LineUps []int64
+	Inputs  []int64
+}
+
+// legacyBot is the whole bot, saved with SaveBot by the previous versions
+type legacyBot struct {
+	UsersLineUps      map[int64]*lineUp.LineUp
+	UsersMergeRequest []MergeRequests // pending, without ids
+	RootLineUp        *lineUp.LineUp
+}
+
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// setDirty saves the lineup and the input of a user on the next save
+func (b *Bot) setDirty(chatId int64) {
+	b.dirtyUsers[chatId] = true
+}
+
+// saveValue saves v under key unless it didn't change since it was saved or loaded
+func (b *Bot) saveValue(key string, v any) error {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	s := string(bytes)
+	h := hash(s)
+	if saved, ok := b.savedHashes[key]; ok && saved == h {
+		return nil
+	}
+	if key == "" {
+		err = b.dao.SaveBot(b.config.Lineup.BeginningSchedule, s)
+	} else {
+		err = b.dao.Save(key, b.config.Lineup.BeginningSchedule, s)
+	}
+	if err != nil {
+		return err
+	}
+	b.savedHashes[key] = h
+	return nil
+}
+
+// save saves the root lineup if it changed and the lineups and inputs of the dirty users
+func (b *Bot) save() error {
+	var res error
+	keep := func(err error) {
+		if err != nil && res == nil {
+			res = err
+		}
+	}
+	if b.dirtyRoot {
+		keep(b.saveValue("", savedLineUp{Sets: b.RootLineUp.Sets, Changes: b.RootLineUp.Changes, Version: b.lineUpVersion, Notified: b.RootLineUp.NotifiedSets()}))
+	}
+	for chatId := range b.dirtyUsers {
+		if l, ok := b.UsersLineUps[chatId]; ok {
+			keep(b.saveValue(fmt.Sprintf(lineUpKey, chatId), savedLineUp{Sets: l.Sets, Changes: l.Changes}))
+		}
+		if state, ok := b.getLineUpForUser(chatId).Inputs.States[chatId]; ok {
+			keep(b.saveValue(fmt.Sprintf(inputKey, chatId), state))
+		}
+	}
+	// the lineups and inputs are saved before the index pointing to them
+	keep(b.saveValue(lineUpsKey, b.lineUpsIndex()))
+	if res == nil {
+		b.dirtyRoot = false
+		b.dirtyUsers = make(map[int64]bool)
+	}
+	return res
+}
+
+// savedRootLineUp returns the root lineup saved, empty when unknown
+func (b *Bot) savedRootLineUp(config *config.Config) savedLineUp {
+	var root savedLineUp
+	s, err := b.dao.GetBot(config.Lineup.BeginningSchedule)
+	if err != nil {
+		return root
+	}
+	if err := json.Unmarshal([]byte(s), &root); err != nil {
+		return savedLineUp{}
+	}
+	return root
+}
+
+func (b *Bot) lineUpsIndex() lineUpsIndex {
+	res := lineUpsIndex{LineUps: []int64{}, Inputs: []int64{}}
+	for k := range b.UsersLineUps {
+		res.LineUps = append(res.LineUps, k)
+	}
+	for k := range b.RootLineUp.Inputs.States {
+		res.Inputs = append(res.Inputs, k)
+	}
+	sort.Slice(res.LineUps, func(i, j int) bool { return res.LineUps[i] < res.LineUps[j] })
+	sort.Slice(res.Inputs, func(i, j int) bool { return res.Inputs[i] < res.Inputs[j] })
+	return res
+}
+
+// load reassembles the lineups from the root lineup saved with SaveBot and the values saved
+// apart, or from the whole bot saved by the previous versions. It returns false when every
+// lineup is empty.
+func (b *Bot) load(config *config.Config, botString string) bool {
+	var legacy legacyBot
+	if err := json.Unmarshal([]byte(botString), &legacy); err != nil {
+		log.Error().Msg(err.Error())
+		return false
+	}
+	if legacy.RootLineUp != nil {
+		log.Info().Msg("loading the bot saved in one value")
+		b.loadLegacy(config, legacy)
+	} else if err := b.loadLineUps(config, botString); err != nil {
+		log.Error().Msg(err.Error())
+		return false
+	}
+	if len(b.RootLineUp.Sets) != 0 {
+		return true
+	}
+	for _, v := range b.UsersLineUps {
+		if len(v.Sets) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// loadLegacy uses the bot saved in one value, it is saved apart on the next save
+func (b *Bot) loadLegacy(config *config.Config, legacy legacyBot) {
+	b.RootLineUp = legacy.RootLineUp
+	b.RootLineUp.Init(config, b.clock)
+	if legacy.UsersLineUps != nil {
+		b.UsersLineUps = legacy.UsersLineUps
+	}
+	// each lineup had its copy of the input states, the one of the lineup used by the user wins
+	states := make(map[int64]*inputs.State)
+	for k, v := range b.RootLineUp.Inputs.States {
+		if _, ok := b.UsersLineUps[k]; !ok {
+			states[k] = v
+		}
+	}
+	for k, v := range b.UsersLineUps {
+		v.Init(config, b.clock)
+		if state, ok := v.Inputs.States[k]; ok {
+			states[k] = state
+		}
+	}
+	b.RootLineUp.Inputs.States = states
+	for k, v := range b.UsersLineUps {
+		v.Inputs.States = states
+		b.setDirty(k)
+	}
+	for k := range states {
+		b.setDirty(k)
+	}
+	if len(legacy.UsersMergeRequest) != 0 {
+		log.Info().Msg(fmt.Sprintf("importing %d merge requests", len(legacy.UsersMergeRequest)))
+	}
+	for _, v := range legacy.UsersMergeRequest {
+		// numbered after the merge requests saved apart, saved before the root lineup
+		mr := v
+		if err := b.mergeRequests.Add(&mr); err != nil {
+			log.Error().Msg(err.Error())
+		}
+	}
+	b.dirtyRoot = true
+}
+
+func (b *Bot) loadLineUps(config *config.Config, botString string) error {
+	var root savedLineUp
+	if err := json.Unmarshal([]byte(botString), &root); err != nil {
+		return err
+	}
+	b.savedHashes[""] = hash(botString)
+	b.lineUpVersion = root.Version
+	b.RootLineUp = lineUp.New(config, b.clock)
+	b.RootLineUp.Sets = root.Sets
+	b.RootLineUp.Changes = root.Changes
+	b.RootLineUp.Init(config, b.clock)
+	b.RootLineUp.SetNotifiedSets(root.Notified)
+
+	s, err := b.dao.Get(lineUpsKey, config.Lineup.BeginningSchedule)
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			return nil
+		}
+		return err
+	}
+	b.savedHashes[lineUpsKey] = hash(s)
+	var index lineUpsIndex
+	if err := json.Unmarshal([]byte(s), &index); err != nil {
+		return err
+	}
+	for _, chatId := range index.Inputs {
+		key := fmt.Sprintf(inputKey, chatId)
+		s, err := b.dao.Get(key, config.Lineup.BeginningSchedule)
+		if err != nil {
+			log.Error().Msg(fmt.Sprintf("%v: %v", key, err))
+			continue
+		}
+		state := &inputs.State{}
+		if err := json.Unmarshal([]byte(s), state); err != nil {
+			log.Error().Msg(err.Error())
+			continue
+		}
+		b.savedHashes[key] = hash(s)
+		b.RootLineUp.Inputs.States[chatId] = state
+	}
+	for _, chatId := range index.LineUps {
+		key := fmt.Sprintf(lineUpKey, chatId)
+		s, err := b.dao.Get(key, config.Lineup.BeginningSchedule)
+		if err != nil {
+			log.Error().Msg(fmt.Sprintf("%v: %v", key, err))
+			continue
+		}
+		var saved savedLineUp
+		if err := json.Unmarshal([]byte(s), &saved); err != nil {
+			log.Error().Msg(err.Error())
+			continue
+		}
+		b.savedHashes[key] = hash(s)
+		// shares the input states of the root lineup, as after InputCommand
+		l := b.RootLineUp.DuplicateLineUp()
+		l.Sets = saved.Sets
+		l.Changes = saved.Changes
+		l.Init(config, b.clock)
+		b.UsersLineUps[chatId] = l
+	}
+	return nil
+}
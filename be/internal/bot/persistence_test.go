@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/bot/mergeRequests"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+// countingDao counts the values written
+type countingDao struct {
+	*DaoMem.DaoMem
+	saved []string
+}
+
+func (d *countingDao) Save(key string, startTime time.Time, value string) error {
+	d.saved = append(d.saved, key)
+	return d.DaoMem.Save(key, startTime, value)
+}
+
+func (d *countingDao) SaveBot(startTime time.Time, bot string) error {
+	d.saved = append(d.saved, "bot")
+	return d.DaoMem.SaveBot(startTime, bot)
+}
+
+// sameJSON compares values read from the dao, their times are not in the same location
+func sameJSON(a, b any) bool {
+	aa, _ := json.Marshal(a)
+	bb, _ := json.Marshal(b)
+	return string(aa) == string(bb)
+}
+
+func TestIncrementalPersistence(t *testing.T) {
+	c, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := timeTests
+	currentTime := time.Date(tt.Year(), tt.Month(), tt.Day(), 0, 0, 0, 0, tt.Location())
+	c.Lineup.BeginningSchedule = currentTime
+	c.ReadSetsFromRedisOnRestart = true
+	currentTime = currentTime.Add(24 * time.Hour)
+	var userID int64 = 123
+	var userID2 int64 = 124
+
+	dao := &countingDao{DaoMem: DaoMem.New()}
+	bot := New(dao, c)
+	bot.channel = nil
+
+	// a detached lineup for userID, an input in progress for userID2
+	for _, tc := range []string{inputs.InputCommand, "🍵", currentTime.Format("Mon"), "2:30", "DJ FART", "90", inputs.ValidateCommand} {
+		bot.ProcessCommand(userID, tc, "test")
+	}
+	for _, tc := range []string{inputs.InputCommand, "🔨", currentTime.Format("Mon")} {
+		bot.ProcessCommand(userID2, tc, "test2")
+	}
+
+	// a command not changing anything writes nothing
+	dao.saved = nil
+	bot.ProcessCommand(userID, inputs.LogCommand, "test")
+	bot.ProcessCommand(userID, inputs.LogCommand, "test")
+	dao.saved = nil
+	bot.ProcessCommand(userID2, "🍵", "test2")
+	bot.Save()
+	if len(dao.saved) != 0 {
+		t.Fatalf("expected nothing saved, got %v", dao.saved)
+	}
+	// an input step only writes the input of the user
+	bot.ProcessCommand(userID2, "3:00", "test2")
+	if !reflect.DeepEqual(dao.saved, []string{"input-124"}) {
+		t.Fatalf("expected the input of the user saved, got %v", dao.saved)
+	}
+
+	// restart
+	bot2 := New(dao, c)
+	bot2.channel = nil
+	if len(bot2.UsersLineUps) != 1 || !sameJSON(bot2.UsersLineUps[userID].Sets, bot.UsersLineUps[userID].Sets) {
+		t.Fatalf("expected the detached lineup of the user after restart")
+	}
+	if !sameJSON(bot2.RootLineUp.Sets, bot.RootLineUp.Sets) {
+		t.Fatalf("expected the root lineup after restart")
+	}
+	if bot2.UsersLineUps[userID].Inputs.States[userID2] != bot2.RootLineUp.Inputs.States[userID2] {
+		t.Fatalf("expected the input states to be shared by the lineups")
+	}
+	// the input continues where it was
+	bot2.ProcessCommand(userID2, "DJ BUNNY", "test2")
+	bot2.ProcessCommand(userID2, "60", "test2")
+	bot2.ProcessCommand(userID2, inputs.ValidateCommand, "test2")
+	if l := bot2.UsersLineUps[userID2]; l == nil || len(l.Changes) != 1 || l.Changes[0].Dj != "DJ BUNNY" {
+		t.Fatalf("expected the input of user2 to be validated after restart, got %v", l)
+	}
+}
+
+func TestLegacyPersistence(t *testing.T) {
+	c, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := timeTests
+	currentTime := time.Date(tt.Year(), tt.Month(), tt.Day(), 0, 0, 0, 0, tt.Location())
+	c.Lineup.BeginningSchedule = currentTime
+	c.ReadSetsFromRedisOnRestart = true
+	currentTime = currentTime.Add(24 * time.Hour)
+	var userID int64 = 123
+
+	dao := DaoMem.New()
+	bot := New(dao, c)
+	bot.channel = nil
+	for _, tc := range []string{inputs.InputCommand, "🍵", currentTime.Format("Mon"), "2:30", "DJ FART", "90", inputs.ValidateCommand} {
+		bot.ProcessCommand(userID, tc, "test")
+	}
+
+	// the whole bot, as saved by the previous versions
+	legacyMr := MergeRequests{Changes: bot.UsersLineUps[userID].Changes, UserId: userID, User: "test", Created: currentTime}
+	bytes, err := json.Marshal(legacyBot{UsersLineUps: bot.UsersLineUps, UsersMergeRequest: []MergeRequests{legacyMr}, RootLineUp: bot.RootLineUp})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	dao = DaoMem.New()
+	dao.SaveBot(c.Lineup.BeginningSchedule, string(bytes))
+	// a merge request saved apart before the upgrade keeps its id
+	saved := mergeRequests.New(dao, c.Lineup.BeginningSchedule)
+	saved.Add(&MergeRequests{UserId: userID, User: "test", Created: currentTime})
+
+	for i := 0; i < 2; i++ {
+		// loaded from the legacy value, then from the values saved apart
+		bot2 := New(dao, c)
+		bot2.channel = nil
+		if len(bot2.UsersLineUps) != 1 || !reflect.DeepEqual(bot2.UsersLineUps[userID].Changes, bot.UsersLineUps[userID].Changes) {
+			t.Fatalf("%d: expected the detached lineup of the user", i)
+		}
+		if _, err := dao.Get(lineUpsKey, c.Lineup.BeginningSchedule); err != nil {
+			t.Fatalf("%d: expected the lineups saved apart: %v", i, err)
+		}
+		mrs := bot2.GetMergeRequests()
+		if len(mrs) != 2 || mrs[1].ID != 2 || mrs[1].Status != mergeRequests.StatusPending || !reflect.DeepEqual(mrs[1].Changes, legacyMr.Changes) {
+			t.Fatalf("%d: expected the merge request of the legacy bot to be imported once, got %v", i, mrs)
+		}
+	}
+}
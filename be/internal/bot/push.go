@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp"
+	"github.com/shallowBunny/app/be/internal/bot/webpush"
+)
+
+const (
+	pushQueueSize = 10000
+	pushWorkers   = 8
+)
+
+// pushNotification is a notification waiting to be sent by SendPushNotifications
+type pushNotification struct {
+	subscription webpush.Subscription
+	payload      []byte
+}
+
+// pushPayload is what the service worker of the app receives
+type pushPayload struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+var errPushDisabled = errors.New("web push is disabled, see secrets.webPushSubject")
+
+// initPush loads the VAPID keys and the push subscriptions when web push is enabled
+func (b *Bot) initPush() {
+	if b.config.WebPushSubject == "" {
+		return
+	}
+	keys, err := webpush.LoadKeys(b.dao, b.config.Lineup.BeginningSchedule)
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("web push disabled: %v", err))
+		return
+	}
+	b.pushKeys = keys
+	b.pushSubscriptions = webpush.NewSubscriptions(b.dao, b.config.Lineup.BeginningSchedule)
+	b.pushQueue = make(chan pushNotification, pushQueueSize)
+}
+
+// PushPublicKey returns the applicationServerKey to subscribe
+func (b *Bot) PushPublicKey() (string, error) {
+	b.lock()
+	defer b.unlock()
+	if b.pushKeys == nil {
+		return "", errPushDisabled
+	}
+	return b.pushKeys.PublicKey, nil
+}
+
+// SubscribePush adds or updates a push subscription
+func (b *Bot) SubscribePush(sub webpush.Subscription) error {
+	b.lock()
+	defer b.unlock()
+	if b.pushKeys == nil {
+		return errPushDisabled
+	}
+	for _, room := range sub.Rooms {
+		known := false
+		for _, v := range b.config.Lineup.Rooms {
+			known = known || v == room
+		}
+		if !known {
+			return fmt.Errorf("unknown room <%v>", room)
+		}
+	}
+	return b.pushSubscriptions.Add(sub)
+}
+
+// UnsubscribePush removes a push subscription, it returns false if it was unknown
+func (b *Bot) UnsubscribePush(endpoint string) (bool, error) {
+	b.lock()
+	defer b.unlock()
+	if b.pushKeys == nil {
+		return false, errPushDisabled
+	}
+	return b.pushSubscriptions.Remove(endpoint)
+}
+
+// queuePushEvents queues the notifications of the sets started, filtered by the rooms of
+// each subscription
+func (b *Bot) queuePushEvents(started []lineUp.Event) {
+	if b.pushKeys == nil || len(started) == 0 {
+		return
+	}
+	for _, sub := range b.pushSubscriptions.All() {
+		events := started
+		if len(sub.Rooms) != 0 {
+			events = []lineUp.Event{}
+			for _, e := range started {
+				for _, room := range sub.Rooms {
+					if e.Room == room {
+						events = append(events, e)
+					}
+				}
+			}
+		}
+		text := lineUp.PrintEvents(events)
+		if text == "" {
+			continue
+		}
+		payload, err := json.Marshal(pushPayload{Title: b.config.Meta.Title, Body: text})
+		if err != nil {
+			panic(err)
+		}
+		select {
+		case b.pushQueue <- pushNotification{subscription: sub, payload: payload}:
+		default:
+			log.Warn().Msg("push queue full, notification dropped")
+		}
+	}
+}
+
+// SendPushNotifications sends the queued push notifications until quit is closed, the
+// subscriptions gone are removed. client is nil except for tests.
+func (b *Bot) SendPushNotifications(quit <-chan struct{}, client *http.Client) {
+	b.lock()
+	keys, subject, queue := b.pushKeys, b.config.WebPushSubject, b.pushQueue
+	b.unlock()
+	if keys == nil {
+		return
+	}
+	sender := webpush.NewSender(keys, subject, client)
+	done := make(chan struct{})
+	for i := 0; i < pushWorkers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-quit:
+					return
+				case n := <-queue:
+					err := sender.Send(n.subscription, n.payload)
+					if errors.Is(err, webpush.ErrGone) {
+						log.Debug().Msg("push subscription gone")
+						if _, err := b.UnsubscribePush(n.subscription.Endpoint); err != nil {
+							log.Error().Msg(err.Error())
+						}
+					} else if err != nil {
+						log.Warn().Msg(fmt.Sprintf("web push: %v", err))
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < pushWorkers; i++ {
+		<-done
+	}
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/lineUp"
+	"github.com/shallowBunny/app/be/internal/bot/webpush"
+	"github.com/shallowBunny/app/be/internal/bot/webpush/webpushtest"
+	"github.com/shallowBunny/app/be/internal/infrastructure/clock"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func TestPushNotifications(t *testing.T) {
+	c, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := timeTests
+	currentTime := time.Date(tt.Year(), tt.Month(), tt.Day(), 0, 0, 0, 0, tt.Location())
+	c.Lineup.BeginningSchedule = currentTime
+	c.WebPushSubject = "mailto:admin@example.com"
+	service := webpushtest.NewService()
+	defer service.Close()
+
+	bot := New(DaoMem.New(), c)
+	bot.channel = nil
+	if key, err := bot.PushPublicKey(); err != nil || key == "" {
+		t.Fatalf("expected a public key, got %v %v", key, err)
+	}
+	every := service.Subscribe()
+	hammer := service.Subscribe("🔨")
+	gone := service.Subscribe()
+	for _, sub := range []webpush.Subscription{every, hammer, gone} {
+		if err := bot.SubscribePush(sub); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err := bot.SubscribePush(service.Subscribe("unknown")); err == nil {
+		t.Fatalf("expected an unknown room to be refused")
+	}
+	service.Unsubscribe(gone)
+
+	quit := make(chan struct{})
+	defer close(quit)
+	go bot.SendPushNotifications(quit, service.Client())
+
+	at := currentTime.Add(48 * time.Hour)
+	started := lineUp.New(c, clock.Real).StartedEvents(at)
+	hammerStarted := []lineUp.Event{}
+	for _, e := range started {
+		if e.Room == "🔨" {
+			hammerStarted = append(hammerStarted, e)
+		}
+	}
+	bot.lock()
+	bot.sendEvents(at, 0)
+	bot.unlock()
+
+	expected := func(events []lineUp.Event) string {
+		bytes, _ := json.Marshal(pushPayload{Title: c.Meta.Title, Body: lineUp.PrintEvents(events)})
+		return string(bytes)
+	}
+	for i := 0; i < 200 && (len(service.Messages(every)) == 0 || len(service.Messages(hammer)) == 0 || len(bot.pushSubscriptionsAll()) != 2); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m := service.Messages(every); len(m) != 1 || m[0] != expected(started) {
+		t.Fatalf("unexpected notifications %v", m)
+	}
+	if m := service.Messages(hammer); len(hammer.Rooms) != 1 || len(m) != 1 || m[0] != expected(hammerStarted) {
+		t.Fatalf("expected the sets of the room of the subscription, got %v", m)
+	}
+	if len(bot.pushSubscriptionsAll()) != 2 {
+		t.Fatalf("expected the subscription gone to be removed")
+	}
+	if errs := service.Errors(); len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
+
+func (b *Bot) pushSubscriptionsAll() []webpush.Subscription {
+	b.lock()
+	defer b.unlock()
+	return b.pushSubscriptions.All()
+}
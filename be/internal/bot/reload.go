@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	"github.com/shallowBunny/app/be/internal/lint"
+)
+
+const (
+	reloadedMessage         = "🔄 Config reloaded\n"
+	reloadedNoChangeMessage = "🔄 Config reloaded, no change with current lineup"
+	reloadedRoomsMessage    = "rooms: %v -> %v\n"
+)
+
+// Reload replaces the config and rebuilds the root lineup from its lineup section. The
+// detached lineups are rebased on the new root lineup, the inputs in progress, the users and
+// the merge requests are kept. The diff with the previous lineup is sent to the admins and
+// returned. Settings read at start (storage, transports, port...) need a restart.
+func (b *Bot) Reload(c *config.Config) (string, error) {
+	if report := lint.Check(c.Meta.Prefix, c); report.HasErrors() {
+		return "", errors.New(report.String())
+	}
+	b.lock()
+	defer b.unlock()
+	if c.Meta.Prefix != b.config.Meta.Prefix {
+		return "", fmt.Errorf("meta.prefix changed from %v to %v, a restart is needed", b.config.Meta.Prefix, c.Meta.Prefix)
+	}
+	if c.Location.String() != b.config.Location.String() {
+		return "", fmt.Errorf("meta.timeZone changed from %v to %v, a restart is needed", b.config.Meta.TimeZone, c.Meta.TimeZone)
+	}
+	if !c.Lineup.BeginningSchedule.Equal(b.config.Lineup.BeginningSchedule) {
+		// the saved values are keyed by the beginning of the schedule
+		return "", fmt.Errorf("beginningSchedule changed from %v to %v, a restart is needed", b.config.Lineup.BeginningSchedule, c.Lineup.BeginningSchedule)
+	}
+
+	previous := b.RootLineUp
+	previousRooms := b.config.Lineup.Rooms
+	root := lineUp.New(c, b.clock)
+	root.KeepNotified(previous)
+	root.Inputs.States = previous.Inputs.States
+	for chatId, l := range b.UsersLineUps {
+		rebased := root.DuplicateLineUp()
+		rebased.Changes = append([]inputs.InputCommandResultSet{}, l.Changes...)
+		for _, v := range rebased.Changes {
+			log.Debug().Msg(rebased.ApplyChange(v))
+		}
+		b.UsersLineUps[chatId] = rebased
+		b.setDirty(chatId)
+	}
+	b.RootLineUp = root
+	b.setConfig(c)
+	b.dirtyRoot = true
+	b.publishLineUp(previous)
+	if err := b.save(); err != nil {
+		log.Error().Msg(err.Error())
+	}
+
+	res := reloadedMessage
+	if strings.Join(previousRooms, ",") != strings.Join(c.Lineup.Rooms, ",") {
+		res += fmt.Sprintf(reloadedRoomsMessage, strings.Join(previousRooms, " "), strings.Join(c.Lineup.Rooms, " "))
+	}
+	diff, err := b.compareLineUps(previous, root)
+	if err != nil && res == reloadedMessage {
+		res = reloadedNoChangeMessage
+	} else {
+		res += diff
+	}
+	b.sendAdminsMessage(res)
+	return res, nil
+}
+
+// setConfig sets the config and what the bot derives from it
+func (b *Bot) setConfig(c *config.Config) {
+	b.config = c
+	b.admins = c.Admins
+	b.modos = c.Modos
+	b.magicRoomButton = len(c.Lineup.Rooms) < maxMnbRoomsForRoomButton
+	b.roomsEmoticons = nil
+	for _, v := range c.Lineup.Rooms {
+		emo := ExtractEmoticons(v)
+		log.Trace().Msg(fmt.Sprintf("Rooms:%v -> <%v>", v, emo))
+		b.roomsEmoticons = append(b.roomsEmoticons, emo)
+	}
+}
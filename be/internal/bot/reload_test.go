@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/lineUp"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func hasDj(sets []lineUp.Set, dj string) bool {
+	for _, s := range sets {
+		if s.Dj == dj {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReload(t *testing.T) {
+	tt := timeTests
+	currentTime := time.Date(tt.Year(), tt.Month(), tt.Day(), 0, 0, 0, 0, tt.Location())
+	newConfig := func() *config.Config {
+		c, err := config.New("../../configs/bot_test.yaml", false)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		c.Lineup.BeginningSchedule = currentTime
+		return c
+	}
+	var userID int64 = 123
+	var userID2 int64 = 124
+
+	bot := New(DaoMem.New(), newConfig())
+	bot.channel = nil
+	day := currentTime.Add(24 * time.Hour).Format("Mon")
+	for _, tc := range []string{inputs.InputCommand, "🍵", day, "2:30", "DJ FART", "90", inputs.ValidateCommand} {
+		bot.ProcessCommand(userID, tc, "test")
+	}
+	for _, tc := range []string{inputs.InputCommand, "🔨"} {
+		bot.ProcessCommand(userID2, tc, "test2")
+	}
+
+	c := newConfig()
+	c.Lineup.Sets["🍵"][0].Dj = "DJ RELOADED"
+	res, err := bot.Reload(c)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.Contains(res, "DJ RELOADED") {
+		t.Fatalf("expected the diff in the answer, got %v", res)
+	}
+	if !hasDj(bot.RootLineUp.Sets, "DJ RELOADED") || hasDj(bot.RootLineUp.Sets, "DJ FART") {
+		t.Fatalf("expected the root lineup from the new config")
+	}
+	if l := bot.UsersLineUps[userID]; !hasDj(l.Sets, "DJ RELOADED") || !hasDj(l.Sets, "DJ FART") {
+		t.Fatalf("expected the detached lineup rebased on the new config")
+	}
+	if bot.RootLineUp.Inputs.States[userID2] == nil || bot.UsersLineUps[userID].Inputs.States[userID2] == nil {
+		t.Fatalf("expected the input in progress to be kept")
+	}
+	if bot.GetConfig() != c {
+		t.Fatalf("expected the new config")
+	}
+
+	if res, err := bot.Reload(newConfig()); err != nil || !strings.Contains(res, "DJ RELOADED") {
+		t.Fatalf("expected the set back, got %v %v", res, err)
+	}
+	if res, _ := bot.Reload(newConfig()); res != reloadedNoChangeMessage {
+		t.Fatalf("expected no change, got %v", res)
+	}
+
+	c = newConfig()
+	c.Meta.Prefix = "other"
+	if _, err := bot.Reload(c); err == nil {
+		t.Fatalf("expected a prefix change to be refused")
+	}
+}
@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/infrastructure/clock"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	dao "github.com/shallowBunny/app/be/internal/infrastructure/repository"
+)
+
+const (
+	replayUser       int64 = 1 // user with the notifications on, the messages of the others are dropped
+	replayStep             = time.Minute
+	replayTimeFormat       = "Mon 02 Jan 15:04"
+)
+
+// Replay plays the festival of config from the notification of the liked djs of its first set
+// (likesNotificationMinutes before it) to the end of its last set, speed times faster than the
+// real time (without waiting when speed is 0). Each notification is written to w with the time
+// it is sent, followed by the answer of /now at that time.
+func Replay(dao dao.Dao, config *config.Config, speed float64, w io.Writer) error {
+	lead := time.Duration(config.LikesNotificationMinutes) * time.Minute
+	fake := clock.NewFake(config.Lineup.BeginningSchedule.Add(-lead - replayStep))
+	b := NewWithClock(dao, config, fake)
+	// the messages of replayUser are taken from the outbox, the others are dropped
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-b.channel:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	b.lock()
+	first, last := b.RootLineUp.FirstSetTime(), time.Time{}
+	for _, v := range b.RootLineUp.Sets {
+		if v.End.After(last) {
+			last = v.End
+		}
+	}
+	b.unlock()
+	if first.IsZero() {
+		return errors.New("no sets to replay")
+	}
+	b.ProcessCommand(replayUser, startNotificationsCommand, "replay")
+
+	for t := first.Add(-lead).Truncate(replayStep); !t.After(last); t = t.Add(replayStep) {
+		fake.Set(t)
+		b.lock()
+		// no "new max active users" message to the admins
+		b.sendEvents(t, math.MaxInt)
+		notifications := []string{}
+		for _, m := range b.outbox {
+			if m.UserID == replayUser {
+				notifications = append(notifications, strings.TrimSpace(m.Text))
+			}
+		}
+		b.outbox = nil
+		b.unlock()
+
+		if len(notifications) != 0 {
+			fmt.Fprintf(w, "=== %v\n%v\n\n", t.Format(replayTimeFormat), strings.Join(notifications, "\n"))
+			b.replayNow(w)
+		}
+		if speed > 0 {
+			time.Sleep(time.Duration(float64(replayStep) / speed))
+		}
+	}
+	fmt.Fprintf(w, "=== %v\n", last.Format(replayTimeFormat))
+	b.replayNow(w)
+	return nil
+}
+
+// replayNow writes the answer of /now
+func (b *Bot) replayNow(w io.Writer) {
+	for _, m := range b.ProcessCommand(replayUser, "/now", "replay") {
+		fmt.Fprintf(w, "%v\n\n", strings.TrimSpace(m.Text))
+	}
+}
@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func TestReplay(t *testing.T) {
+	c, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var out strings.Builder
+	if err := Replay(DaoMem.New(), c, 0, &out); err != nil {
+		t.Fatalf(err.Error())
+	}
+	want := `=== Fri 16 Aug 01:00
+A started in 🍵
+
+🔨 🚫 closed (E at 03:00)
+🍵 ✅ A (B at 02:00)
+
+=== Fri 16 Aug 02:00
+B started in 🍵
+
+🔨 🚫 closed (E at 03:00)
+🍵 ✅ B (C at 03:00)
+
+=== Fri 16 Aug 03:00
+E started in 🔨
+C in 🍵
+
+🔨 ✅ E (F at 06:00)
+🍵 ✅ C (D at 04:00)
+
+=== Fri 16 Aug 04:00
+D started in 🍵
+
+🔨 ✅ E (F at 06:00)
+🍵 ✅ D (closing at 05:00)
+
+=== Fri 16 Aug 06:00
+F started in 🔨
+
+🔨 ✅ F (closing at 09:00)
+🍵 🚫 closed
+
+=== Fri 16 Aug 09:00
+🔨 🚫 closed
+🍵 🚫 closed
+
+`
+	if out.String() != want {
+		t.Fatalf("unexpected replay\n%v", out.String())
+	}
+}
+
+func TestReplayLikes(t *testing.T) {
+	c, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the notification of a liked dj of the first set is sent before it
+	dao := DaoMem.New()
+	bot := New(dao, c)
+	bot.channel = nil
+	// the djs of the test lineup are too short to be searched by /like
+	bot.ProcessCommand(replayUser, "/now", "replay")
+	if err := bot.users.LikeDj(replayUser, "A"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	var out strings.Builder
+	if err := Replay(dao, c, 0, &out); err != nil {
+		t.Fatalf(err.Error())
+	}
+	want := `=== Fri 16 Aug 00:45
+❤️ A starts in 15 minutes in 🍵
+
+🔨 🚫 closed (E at 03:00)
+🍵 🚫 closed (A at 01:00)
+
+`
+	if !strings.HasPrefix(out.String(), want) {
+		t.Fatalf("unexpected replay\n%v", out.String())
+	}
+}
@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot/analytics"
+)
+
+const statsCommand = "stats"
+
+// initAnalytics loads the analytics, they start empty if they can't be read
+func (b *Bot) initAnalytics() {
+	a, err := analytics.New(b.dao)
+	if err != nil {
+		log.Error().Msg(fmt.Sprintf("analytics: %v", err))
+	}
+	b.analytics = a
+}
+
+// StatsUsingUserIp records a request of the app
+func (b *Bot) StatsUsingUserIp(ip string) {
+	b.analytics.Visit(analytics.API, ip, b.clock.Now())
+}
+
+// visit records a command of a bot user
+func (b *Bot) visit(chatId int64, command string) {
+	channel := analytics.Telegram
+	if chatId >= TransportIDBase {
+		channel = analytics.Matrix
+	}
+	b.analytics.Visit(channel, strconv.FormatInt(chatId, 10), b.clock.Now())
+	b.analytics.Command(commandLabel(command))
+}
+
+// Stats returns the analytics of the festival
+func (b *Bot) Stats() analytics.Report {
+	return b.analytics.Report()
+}
+
+// SaveAnalytics saves the analytics if they changed
+func (b *Bot) SaveAnalytics() error {
+	return b.analytics.Save()
+}
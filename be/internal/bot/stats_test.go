@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/analytics"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func TestStats(t *testing.T) {
+	c, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := timeTests
+	c.Lineup.BeginningSchedule = time.Date(tt.Year(), tt.Month(), tt.Day(), 0, 0, 0, 0, tt.Location())
+	dao := DaoMem.New()
+	bot := New(dao, c)
+	bot.channel = nil
+
+	bot.StatsUsingUserIp("1.2.3.4")
+	bot.ProcessCommand(123, "/now", "test")
+	bot.ProcessCommand(123, "🍵", "test")
+	bot.ProcessCommand(TransportIDBase+1, "/now", "test")
+	if m := bot.ProcessCommand(123, "/"+statsCommand, "test"); len(m) != 0 && strings.Contains(m[0].Text, "📊") {
+		t.Fatalf("stats shown to a user")
+	}
+	m := bot.ProcessCommand(-123, "/"+statsCommand, "test")
+	if len(m) != 1 || !strings.Contains(m[0].Text, "📊 4 users") || !strings.Contains(m[0].Text, "🏠 🍵") {
+		t.Fatalf("unexpected stats %+v", m)
+	}
+
+	r := bot.Stats()
+	day := r.Days[len(r.Days)-1].Channels
+	if day[analytics.API].Uniques != 1 || day[analytics.Telegram].Uniques != 2 || day[analytics.Matrix].Uniques != 1 {
+		t.Fatalf("unexpected channels %+v", day)
+	}
+	if err := bot.SaveAnalytics(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if New(dao, c).Stats().Users != 4 {
+		t.Fatalf("expected the analytics to be loaded")
+	}
+}
@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot/lineUp"
+)
+
+// types of the stream events
+const (
+	StreamLineUp       = "lineup"       // the root lineup changed, Data is a StreamLineUpChange
+	StreamStarted      = "started"      // sets started, Data is a StreamStartedSets
+	StreamAnnouncement = "announcement" // admins announcement, Data is a StreamAnnouncementMessage
+	StreamRefetch      = "refetch"      // the lineup changed while the client was away, Data is a StreamRefetchVersion
+)
+
+const (
+	streamBuffer              = 16 // events kept for a subscriber not reading, it is dropped after
+	announceCommand           = "announce"
+	announcedMessage          = "📣 Announced to %d app users"
+	announceUsageMessage      = "Use /announce <text> to send an announcement to the app users"
+	tooManySubscribersMessage = "too many subscribers"
+)
+
+// maxStreamSubscribers bounds the number of open streams of a festival
+var maxStreamSubscribers = 500
+
+// StreamEvent is sent to the subscribers of the stream, Version is the version of the root
+// lineup, incremented each time it changes
+type StreamEvent struct {
+	Type    string
+	Version int
+	Data    any
+}
+
+type StreamLineUpChange struct {
+	Version int `json:"version"`
+	lineUp.LineUpDiff
+}
+
+type StreamStartedSets struct {
+	Version int            `json:"version"`
+	Events  []lineUp.Event `json:"events"`
+}
+
+type StreamRefetchVersion struct {
+	Version int `json:"version"`
+}
+
+type StreamAnnouncementMessage struct {
+	Version int    `json:"version"`
+	Message string `json:"message"`
+}
+
+// Subscribe returns the channel receiving the stream events and the function to call once
+// done. The channel is closed when the subscriber is too slow or on CloseStreams.
+func (b *Bot) Subscribe() (<-chan StreamEvent, func(), error) {
+	b.lock()
+	defer b.unlock()
+	if len(b.subscribers) >= maxStreamSubscribers {
+		return nil, nil, errors.New(tooManySubscribersMessage)
+	}
+	ch := make(chan StreamEvent, streamBuffer)
+	b.subscribers[ch] = true
+	unsubscribe := func() {
+		b.lock()
+		defer b.unlock()
+		b.unsubscribe(ch)
+	}
+	return ch, unsubscribe, nil
+}
+
+func (b *Bot) unsubscribe(ch chan StreamEvent) {
+	if b.subscribers[ch] {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// CloseStreams closes the channels of every subscriber, i.e. before shutting down the rest api
+func (b *Bot) CloseStreams() {
+	b.lock()
+	defer b.unlock()
+	for ch := range b.subscribers {
+		b.unsubscribe(ch)
+	}
+}
+
+// LineUpVersion returns the version of the root lineup sent in the stream events
+func (b *Bot) LineUpVersion() int {
+	b.lock()
+	defer b.unlock()
+	return b.lineUpVersion
+}
+
+// publish sends an event to the subscribers without blocking
+func (b *Bot) publish(t string, data any) {
+	e := StreamEvent{Type: t, Version: b.lineUpVersion, Data: data}
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			log.Warn().Msg("stream subscriber too slow, dropped")
+			b.unsubscribe(ch)
+		}
+	}
+}
+
+// publishLineUp sends the changes of the root lineup since previous
+func (b *Bot) publishLineUp(previous *lineUp.LineUp) {
+	diff := lineUp.Diff(previous, b.RootLineUp)
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Modified) == 0 {
+		return
+	}
+	b.lineUpVersion++
+	b.publish(StreamLineUp, StreamLineUpChange{Version: b.lineUpVersion, LineUpDiff: diff})
+}
+
+// Announce sends an announcement to the stream subscribers, it returns their number
+func (b *Bot) Announce(message string) int {
+	b.lock()
+	defer b.unlock()
+	return b.announce(message)
+}
+
+func (b *Bot) announce(message string) int {
+	b.publish(StreamAnnouncement, StreamAnnouncementMessage{Version: b.lineUpVersion, Message: message})
+	return len(b.subscribers)
+}
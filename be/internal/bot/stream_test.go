@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/lineUp/inputs"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func receive(t *testing.T, events <-chan StreamEvent, eventType string) StreamEvent {
+	t.Helper()
+	select {
+	case e := <-events:
+		if e.Type != eventType {
+			t.Fatalf("expected a %v event, got %v", eventType, e)
+		}
+		return e
+	default:
+		t.Fatalf("expected a %v event", eventType)
+	}
+	return StreamEvent{}
+}
+
+func TestStream(t *testing.T) {
+	c, err := config.New("../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := timeTests
+	currentTime := time.Date(tt.Year(), tt.Month(), tt.Day(), 0, 0, 0, 0, tt.Location())
+	c.Lineup.BeginningSchedule = currentTime
+	var userID int64 = 123
+	var modoID int64 = -123
+
+	dao := DaoMem.New()
+	bot := New(dao, c)
+	bot.channel = nil
+	events, unsubscribe, err := bot.Subscribe()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	day := currentTime.Add(24 * time.Hour).Format("Mon")
+	for _, tc := range []string{inputs.InputCommand, "🍵", day, "2:30", "DJ FART", "90", inputs.ValidateCommand, inputs.MergeCommand, inputs.MergeSubmitCommand} {
+		bot.ProcessCommand(userID, tc, "test")
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no event before the merge request is accepted")
+	}
+	mrs := bot.GetMergeRequests()
+	if len(mrs) != 1 {
+		t.Fatalf("expected a merge request, got %v", mrs)
+	}
+	if _, err := bot.AcceptMergeRequest(mrs[0].ID, "modo", modoID); err != nil {
+		t.Fatalf(err.Error())
+	}
+	e := receive(t, events, StreamLineUp)
+	change := e.Data.(StreamLineUpChange)
+	if e.Version != 2 || change.Version != 2 || len(change.Added) != 1 || change.Added[0].Dj != "DJ FART" {
+		t.Fatalf("unexpected lineup event %+v", e)
+	}
+
+	// the version is kept with the lineup after a restart, a lineup read from the config is a new one
+	if err := bot.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c.ReadSetsFromRedisOnRestart = true
+	if v := New(dao, c).LineUpVersion(); v != 2 {
+		t.Fatalf("expected version 2 after a restart, got %v", v)
+	}
+	c.ReadSetsFromRedisOnRestart = false
+	if v := New(dao, c).LineUpVersion(); v != 3 {
+		t.Fatalf("expected version 3 after a restart from the config, got %v", v)
+	}
+
+	bot.lock()
+	bot.sendEvents(currentTime.Add(48*time.Hour), 0)
+	bot.unlock()
+	e = receive(t, events, StreamStarted)
+	if started := e.Data.(StreamStartedSets); len(started.Events) == 0 {
+		t.Fatalf("expected started sets")
+	}
+
+	bot.ProcessCommand(modoID, "/announce Rain, the 🔨 room closes", "admin")
+	e = receive(t, events, StreamAnnouncement)
+	if m := e.Data.(StreamAnnouncementMessage); m.Message != "Rain, the 🔨 room closes" {
+		t.Fatalf("unexpected announcement %+v", m)
+	}
+	bot.ProcessCommand(userID, "/announce not an admin", "test")
+	if len(events) != 0 {
+		t.Fatalf("expected announcements from admins only")
+	}
+
+	// a subscriber not reading is dropped
+	for i := 0; i <= streamBuffer; i++ {
+		bot.Announce("spam")
+	}
+	for range events {
+	}
+	unsubscribe()
+	if n := bot.Announce("nobody"); n != 0 {
+		t.Fatalf("expected no subscriber, got %v", n)
+	}
+
+	maxStreamSubscribers = 1
+	defer func() { maxStreamSubscribers = 500 }()
+	if _, _, err := bot.Subscribe(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, _, err := bot.Subscribe(); err == nil {
+		t.Fatalf("expected too many subscribers")
+	}
+}
@@ -1,21 +1,38 @@
 package telegram
 
 import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
+	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/rs/zerolog/log"
 	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/bot/transport"
+)
+
+const (
+	// header of the webhook requests holding the secret token given to setWebhook
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+	inlineCacheTime   = 30 // seconds
 )
 
 type Telegram struct {
-	bot *bot.Bot
-	api *tgbotapi.BotAPI
+	api                        *tgbotapi.BotAPI
+	deleteLeftTheGroupMessages bool
+	webhookURL                 string
+	secretToken                string
+	updates                    chan tgbotapi.Update // updates received by the webhook
 }
 
-func New(apiToken string, bot *bot.Bot) *Telegram {
+func New(apiToken string, deleteLeftTheGroupMessages bool) *Telegram {
 
 	api, err := tgbotapi.NewBotAPI(apiToken)
 	if err != nil {
@@ -25,24 +42,27 @@ func New(apiToken string, bot *bot.Bot) *Telegram {
 	log.Trace().Msg("using api token <" + apiToken + ">")
 
 	return &Telegram{
-		bot: bot,
-		api: api,
+		api:                        api,
+		deleteLeftTheGroupMessages: deleteLeftTheGroupMessages,
 	}
 }
 
-func getUsername(update tgbotapi.Update) string {
+func getUsername(from *tgbotapi.User) string {
 	userString := ""
-	if update.Message.From.UserName != "" {
-		userString += "@" + update.Message.From.UserName
+	if from == nil {
+		return userString
+	}
+	if from.UserName != "" {
+		userString += "@" + from.UserName
 	} else {
-		if update.Message.From.FirstName != "" {
-			userString += update.Message.From.FirstName
+		if from.FirstName != "" {
+			userString += from.FirstName
 		}
-		if update.Message.From.LastName != "" {
+		if from.LastName != "" {
 			if userString != "" {
 				userString += "."
 			}
-			userString += update.Message.From.LastName
+			userString += from.LastName
 		}
 	}
 	return userString
@@ -102,11 +122,27 @@ func messageToMessageConfig(msgFromBot bot.Message) tgbotapi.MessageConfig {
 	} else {
 		log.Debug().Msg("msgFromBot.Buttons == nil ")
 	}
+	if msgFromBot.InlineButtons != nil {
+		msg.ReplyMarkup = inlineKeyboard(msgFromBot.InlineButtons)
+	}
 
 	return msg
 }
 
-func (t *Telegram) SendPhoto(chatID int64, photoFilePath string, caption string) error {
+func inlineKeyboard(inline [][]bot.InlineButton) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	for _, row := range inline {
+		buttons := []tgbotapi.InlineKeyboardButton{}
+		for _, v := range row {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(v.Text, v.Data))
+		}
+		rows = append(rows, buttons)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// SendImage sends a local image
+func (t *Telegram) SendImage(chatID int64, photoFilePath string, caption string) error {
 	// Create a new photo message with a local file
 	photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(photoFilePath))
 
@@ -124,31 +160,204 @@ func (t *Telegram) SendPhoto(chatID int64, photoFilePath string, caption string)
 	return err
 }
 
-func (t Telegram) SendMessages() {
+func (t *Telegram) Name() string {
+	return "telegram"
+}
 
-	for {
-		msgFromBot := <-t.bot.GetMessageChannel()
-
-		msg := messageToMessageConfig(msgFromBot)
-
-		if _, err := t.api.Send(msg); err != nil {
-			log.Error().Msg(err.Error())
-			if err.Error() == "Forbidden: bot was blocked by the user" {
-				err = t.bot.DeleteUser(msg.ChatID)
-				if err != nil {
-					log.Error().Msg(err.Error())
-				} else {
-					log.Info().Msg("deleted user")
-				}
+// Owns returns true for telegram chat ids, the other transports use ids above transport.IDBase
+func (t *Telegram) Owns(userID int64) bool {
+	return userID < transport.IDBase
+}
+
+func (t *Telegram) IsBlocked(err error) bool {
+	return err.Error() == "Forbidden: bot was blocked by the user"
+}
+
+// Retry retries the rate limited sends after the delay asked and the server or network errors
+func (t *Telegram) Retry(err error) (bool, time.Duration) {
+	var e *tgbotapi.Error
+	if errors.As(err, &e) {
+		if e.RetryAfter != 0 {
+			return true, time.Duration(e.RetryAfter) * time.Second
+		}
+		return e.Code == http.StatusTooManyRequests || e.Code >= http.StatusInternalServerError, 0
+	}
+	return true, 0
+}
+
+func (t *Telegram) SendText(chatID int64, text string, html bool, buttons []string, replyTo string) error {
+	msg := messageToMessageConfig(bot.Message{UserID: chatID, Text: text, Html: html, Buttons: buttons})
+	if replyTo != "" {
+		if id, err := strconv.Atoi(replyTo); err == nil {
+			msg.ReplyToMessageID = id
+		}
+	}
+	_, err := t.api.Send(msg)
+	return err
+}
+
+// UseWebhook makes Receive get the updates from Telegram calling ServeHTTP on url instead of
+// long polling, the requests must have the secretToken header
+func (t *Telegram) UseWebhook(url string, secretToken string) {
+	t.webhookURL = url
+	t.secretToken = secretToken
+	t.updates = make(chan tgbotapi.Update, 100)
+}
+
+// ServeHTTP receives the updates posted by Telegram on the webhook
+func (t *Telegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t.updates == nil {
+		http.Error(w, "webhook not enabled", http.StatusNotFound)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(t.secretToken)) != 1 {
+		log.Warn().Msg("telegram webhook: invalid secret token from " + r.RemoteAddr)
+		http.Error(w, "invalid secret token", http.StatusUnauthorized)
+		return
+	}
+	var update tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		log.Error().Msg(fmt.Sprintf("telegram webhook: %v", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	select {
+	case t.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// telegram will retry
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func (t *Telegram) handleUpdate(update tgbotapi.Update, handle func(transport.Update)) {
+	if q := update.InlineQuery; q != nil {
+		handle(transport.Update{
+			UserID:        q.From.ID,
+			UserName:      getUsername(q.From),
+			Text:          q.Query,
+			InlineQueryID: q.ID,
+		})
+		return
+	}
+	if q := update.CallbackQuery; q != nil {
+		if q.Message == nil {
+			log.Debug().Msg("callback without message")
+			return
+		}
+		handle(transport.Update{
+			UserID:     q.Message.Chat.ID,
+			UserName:   getUsername(q.From),
+			MessageID:  strconv.Itoa(q.Message.MessageID),
+			CallbackID: q.ID,
+			Data:       q.Data,
+		})
+		return
+	}
+
+	// Process the update if it's a valid message
+	if update.Message == nil {
+		log.Debug().Msg("update. update.Message == nil ...")
+		return
+	}
+
+	if t.deleteLeftTheGroupMessages {
+		if update.Message.LeftChatMember != nil {
+			log.Debug().Msg("deleting message")
+			deleteMsg := tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID)
+			if _, err := t.api.Send(deleteMsg); err != nil {
+				log.Error().Msg(fmt.Sprintf("Failed to delete message: %v", err))
 			}
+			return
 		}
 	}
+
+	if update.Message.Chat.IsGroup() || update.Message.Chat.IsChannel() {
+		log.Debug().Msg("update.Message.Chat.Type = group")
+		handle(transport.Update{
+			UserID:    update.Message.Chat.ID,
+			UserName:  getUsername(update.Message.From),
+			Group:     true,
+			GroupName: update.Message.Chat.Title,
+		})
+		return
+	}
+
+	if update.Message.Chat.ID > 0 { // Skip joins in channels
+		handle(transport.Update{
+			UserID:    update.Message.Chat.ID,
+			UserName:  getUsername(update.Message.From),
+			Text:      update.Message.Text,
+			MessageID: strconv.Itoa(update.Message.MessageID),
+		})
+	}
+}
+
+// SendInline sends a message with an inline keyboard, it replaces the reply keyboard
+func (t *Telegram) SendInline(msgFromBot bot.Message, replyTo string) error {
+	msg := messageToMessageConfig(msgFromBot)
+	if id, err := strconv.Atoi(replyTo); err == nil {
+		msg.ReplyToMessageID = id
+	}
+	_, err := t.api.Send(msg)
+	return err
+}
+
+func (t *Telegram) EditInline(msgFromBot bot.Message) error {
+	id, err := strconv.Atoi(msgFromBot.EditMessageID)
+	if err != nil {
+		return err
+	}
+	inline := inlineKeyboard(msgFromBot.InlineButtons)
+	if msgFromBot.Text == "" {
+		_, err = t.api.Request(tgbotapi.NewEditMessageReplyMarkup(msgFromBot.UserID, id, inline))
+		return err
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(msgFromBot.UserID, id, msgFromBot.Text, inline)
+	if msgFromBot.Html {
+		edit.ParseMode = "HTML"
+		edit.Text = escapeHTMLSpecialChars(edit.Text)
+	}
+	edit.DisableWebPagePreview = true
+	_, err = t.api.Send(edit)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		// clicked twice
+		return nil
+	}
+	return err
 }
 
-func (t Telegram) Listen(quit <-chan struct{}) {
-	// Start the goroutine to send messages
-	go t.SendMessages()
+func (t *Telegram) AnswerCallback(callbackID string, text string) error {
+	_, err := t.api.Request(tgbotapi.NewCallback(callbackID, text))
+	return err
+}
 
+// AnswerInlineQuery answers with article cards, cached shortly as the current sets change
+func (t *Telegram) AnswerInlineQuery(queryID string, results []bot.InlineResult) error {
+	articles := []interface{}{}
+	for _, v := range results {
+		article := tgbotapi.NewInlineQueryResultArticle(v.ID, v.Title, v.Text)
+		article.Description = v.Description
+		articles = append(articles, article)
+	}
+	_, err := t.api.Request(tgbotapi.InlineConfig{
+		InlineQueryID: queryID,
+		Results:       articles,
+		CacheTime:     inlineCacheTime,
+	})
+	return err
+}
+
+func (t *Telegram) Receive(quit <-chan struct{}, handle func(transport.Update)) {
+	if t.webhookURL != "" {
+		t.receiveWebhook(quit, handle)
+		return
+	}
+
+	// getUpdates is refused while a webhook is set
+	if _, err := t.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		log.Error().Msg(fmt.Sprintf("deleteWebhook: %v", err))
+	}
 	for {
 		// Telegram polling configuration
 		updateConfig := tgbotapi.NewUpdate(0)
@@ -166,66 +375,34 @@ func (t Telegram) Listen(quit <-chan struct{}) {
 					restartListener = true
 					break
 				}
-
-				// Process the update if it's a valid message
-				if update.Message == nil {
-					log.Debug().Msg("update. update.Message == nil ...")
-					continue
-				}
-
-				if t.bot.GetConfig().TelegramDeleteLeftTheGroupMessages {
-					if update.Message.LeftChatMember != nil {
-						log.Debug().Msg("deleting message")
-						deleteMsg := tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID)
-						if _, err := t.api.Send(deleteMsg); err != nil {
-							log.Error().Msg(fmt.Sprintf("Failed to delete message: %v", err))
-						}
-						continue
-					}
-				}
-
-				if update.Message.Chat.IsGroup() || update.Message.Chat.IsChannel() {
-					log.Debug().Msg("update.Message.Chat.Type = group")
-					userString := getUsername(update)
-					group := update.Message.Chat.Title
-					t.bot.GroupChange(update.Message.Chat.ID, userString, group)
-					continue
-				}
-
-				var msg tgbotapi.MessageConfig
-				if update.Message.Chat.ID > 0 { // Skip joins in channels
-					messages := t.bot.ProcessCommand(update.Message.Chat.ID, update.Message.Text, getUsername(update))
-					for i, answer := range messages {
-
-						if answer.ImagePath != "" {
-							if err := t.SendPhoto(answer.UserID, answer.ImagePath, answer.Text); err != nil {
-								log.Error().Msg("Failed to send image")
-							}
-							continue
-						}
-
-						if len(answer.Text) > 4096 {
-							log.Error().Msg("Had to trim inside!!?")
-							answer.Text = bot.Trim(answer.Text)
-						}
-						msg = messageToMessageConfig(answer)
-						t.bot.Log(update.Message.Chat.ID, update.Message.Text, getUsername(update))
-
-						if i == 0 {
-							msg.ReplyToMessageID = update.Message.MessageID
-						}
-
-						if _, err := t.api.Send(msg); err != nil {
-							log.Error().Msg(fmt.Sprintf("%v %v", err.Error(), msg))
-						}
-					}
-				}
+				t.handleUpdate(update, handle)
 
 			case <-quit: // Listen for quit signal
 				log.Info().Msg("Shutting down Telegram listener gracefully")
+				t.api.StopReceivingUpdates()
 				return
 			}
 		}
 		log.Warn().Msg("Restarting Telegram listener")
 	}
 }
+
+func (t *Telegram) receiveWebhook(quit <-chan struct{}, handle func(transport.Update)) {
+	log.Info().Msg("setting telegram webhook " + t.webhookURL)
+	params := tgbotapi.Params{"url": t.webhookURL, "secret_token": t.secretToken}
+	if _, err := t.api.MakeRequest("setWebhook", params); err != nil {
+		log.Error().Msg(fmt.Sprintf("setWebhook: %v", err))
+	}
+	for {
+		select {
+		case update := <-t.updates:
+			t.handleUpdate(update, handle)
+		case <-quit:
+			log.Info().Msg("Shutting down Telegram webhook gracefully")
+			if _, err := t.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+				log.Error().Msg(fmt.Sprintf("deleteWebhook: %v", err))
+			}
+			return
+		}
+	}
+}
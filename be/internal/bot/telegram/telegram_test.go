@@ -0,0 +1,174 @@
+package telegram
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/bot/transport"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+const (
+	testToken  = "123:TOKEN"
+	testSecret = "s3cret_token"
+)
+
+// fakeBotApi answers the calls of tgbotapi and records their parameters
+type fakeBotApi struct {
+	mu    sync.Mutex
+	calls map[string][]*http.Request
+	sent  chan *http.Request
+}
+
+func (f *fakeBotApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/bot"+testToken+"/")
+	r.ParseForm()
+	f.mu.Lock()
+	f.calls[method] = append(f.calls[method], r)
+	f.mu.Unlock()
+	switch method {
+	case "getMe":
+		w.Write([]byte(`{"ok":true,"result":{"id":99,"is_bot":true,"first_name":"Bunny","username":"bunny_bot"}}`))
+	case "sendMessage":
+		f.sent <- r
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":` + r.Form.Get("chat_id") + `}}}`))
+	default:
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}
+}
+
+func (f *fakeBotApi) called(method string) []*http.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+func post(t *Telegram, file string, secret string) int {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		panic(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/telegram", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(secretTokenHeader, secret)
+	}
+	w := httptest.NewRecorder()
+	t.ServeHTTP(w, req)
+	return w.Code
+}
+
+func (f *fakeBotApi) waitSent(t *testing.T) *http.Request {
+	select {
+	case r := <-f.sent:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message sent")
+	}
+	return nil
+}
+
+func TestWebhook(t *testing.T) {
+	c, err := config.New("../../../configs/bot_test.yaml", false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tt := time.Now()
+	c.Lineup.BeginningSchedule = time.Date(tt.Year()+1, 1, 1, 0, 0, 0, 0, tt.Location())
+
+	fake := &fakeBotApi{calls: make(map[string][]*http.Request), sent: make(chan *http.Request, 10)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	api, err := tgbotapi.NewBotAPIWithClient(testToken, server.URL+"/bot%s/%s", server.Client())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tg := &Telegram{api: api}
+	tg.UseWebhook("https://example.org/telegram", testSecret)
+
+	b := bot.New(DaoMem.New(), c)
+	quit := make(chan struct{})
+	done := transport.Run(b, []transport.Transport{tg}, quit)
+
+	if code := post(tg, "testdata/update_private.json", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without secret token, got %v", code)
+	}
+	if code := post(tg, "testdata/update_private.json", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with a wrong secret token, got %v", code)
+	}
+	if code := post(tg, "testdata/update_private.json", testSecret); code != http.StatusOK {
+		t.Errorf("expected 200, got %v", code)
+	}
+	r := fake.waitSent(t)
+	if r.Form.Get("chat_id") != "2024001" || r.Form.Get("reply_to_message_id") != "42" || r.Form.Get("text") == "" {
+		t.Errorf("unexpected answer %v", r.Form)
+	}
+
+	// the bot added in a group is reported to the admins
+	if code := post(tg, "testdata/update_group.json", testSecret); code != http.StatusOK {
+		t.Errorf("expected 200, got %v", code)
+	}
+	r = fake.waitSent(t)
+	if r.Form.Get("chat_id") != "-123" || !strings.Contains(r.Form.Get("text"), "Bunnies") {
+		t.Errorf("unexpected admin message %v", r.Form)
+	}
+
+	// a click on an outdated keyboard shows a popup and removes the buttons
+	if code := post(tg, "testdata/update_callback.json", testSecret); code != http.StatusOK {
+		t.Errorf("expected 200, got %v", code)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fake.called("editMessageReplyMarkup")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	answers := fake.called("answerCallbackQuery")
+	if len(answers) != 1 || answers[0].Form.Get("callback_query_id") != "4382bfdwdsb323b2d9" || answers[0].Form.Get("text") == "" {
+		t.Errorf("unexpected answerCallbackQuery calls %v", answers)
+	}
+	edits := fake.called("editMessageReplyMarkup")
+	if len(edits) != 1 || edits[0].Form.Get("message_id") != "43" {
+		t.Errorf("unexpected editMessageReplyMarkup calls %v", edits)
+	}
+
+	// "@bot" typed in a group is answered with the status of every room
+	if code := post(tg, "testdata/update_inline_query.json", testSecret); code != http.StatusOK {
+		t.Errorf("expected 200, got %v", code)
+	}
+	for len(fake.called("answerInlineQuery")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	inline := fake.called("answerInlineQuery")
+	if len(inline) != 1 || inline[0].Form.Get("inline_query_id") != "1154123456789012345" || !strings.Contains(inline[0].Form.Get("results"), `"type":"article"`) {
+		t.Errorf("unexpected answerInlineQuery calls %v", inline)
+	}
+
+	setWebhook := fake.called("setWebhook")
+	if len(setWebhook) != 1 || setWebhook[0].Form.Get("url") != "https://example.org/telegram" || setWebhook[0].Form.Get("secret_token") != testSecret {
+		t.Errorf("unexpected setWebhook calls %v", setWebhook)
+	}
+	if len(fake.called("deleteWebhook")) != 0 {
+		t.Errorf("webhook deleted before shutdown")
+	}
+
+	close(quit)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("webhook receiver not stopped")
+	}
+	if len(fake.called("deleteWebhook")) != 1 {
+		t.Errorf("expected the webhook to be deleted on shutdown")
+	}
+	if len(fake.called("getUpdates")) != 0 {
+		t.Errorf("getUpdates called in webhook mode")
+	}
+}
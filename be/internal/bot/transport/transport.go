@@ -0,0 +1,257 @@
+package transport
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/bot"
+	"github.com/shallowBunny/app/be/internal/bot/outbox"
+	"github.com/shallowBunny/app/be/internal/infrastructure/metrics"
+)
+
+// IDBase is the first user id of the transports not having int64 ids, see bot.TransportIDBase
+const IDBase = bot.TransportIDBase
+
+// number of goroutines sending the messages of the outbox
+const senders = 4
+
+// Update is a message received by a transport
+type Update struct {
+	UserID    int64
+	UserName  string
+	Text      string
+	MessageID string // used to reply to the message
+	Group     bool   // message in a group or a channel
+	GroupName string
+	// click on an inline button of the message MessageID
+	CallbackID string
+	Data       string
+	// "@bot <Text>" typed in any chat
+	InlineQueryID string
+}
+
+// Transport connects the bot to a chat network
+type Transport interface {
+	Name() string
+	// Receive calls handle for every message received until quit is closed
+	Receive(quit <-chan struct{}, handle func(Update))
+	// SendText sends a text with the buttons of the keyboard, an empty non nil buttons removes the keyboard
+	SendText(userID int64, text string, html bool, buttons []string, replyTo string) error
+	SendImage(userID int64, path string, caption string) error
+	// Owns returns true if the user id belongs to the transport
+	Owns(userID int64) bool
+	// IsBlocked returns true if a send error means the user doesn't want messages anymore
+	IsBlocked(err error) bool
+	// Retry returns true if a send error is worth retrying, after the delay asked by the
+	// chat network when rate limited
+	Retry(err error) (bool, time.Duration)
+}
+
+// InlineTransport is a transport showing the inline buttons of the messages and sending
+// callbacks when they are clicked
+type InlineTransport interface {
+	Transport
+	SendInline(msg bot.Message, replyTo string) error
+	// EditInline replaces the message msg.EditMessageID, an empty text only removes its buttons
+	EditInline(msg bot.Message) error
+	// AnswerCallback acknowledges a callback, text is shown in a popup if not empty
+	AnswerCallback(callbackID string, text string) error
+	AnswerInlineQuery(queryID string, results []bot.InlineResult) error
+}
+
+var messagesTotal = metrics.NewCounter("shallowbunny_messages_total", "Messages sent by the transports: sent, retried, failed or blocked (the user is deleted).", "festival", "transport", "result")
+
+// HashID returns a stable user id for the string identity of a user (i.e. a matrix room id)
+func HashID(name, identity string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name + "\x00" + identity))
+	return IDBase + int64(h.Sum64()%uint64(IDBase))
+}
+
+func send(t Transport, msg bot.Message, replyTo string) error {
+	if msg.ImagePath != "" {
+		return t.SendImage(msg.UserID, msg.ImagePath, msg.Text)
+	}
+	if len(msg.Text) > 4096 {
+		log.Error().Msg("Had to trim inside!!?")
+		msg.Text = bot.Trim(msg.Text)
+	}
+	if it, ok := t.(InlineTransport); ok {
+		if msg.EditMessageID != "" {
+			return it.EditInline(msg)
+		}
+		if msg.InlineButtons != nil {
+			return it.SendInline(msg, replyTo)
+		}
+	}
+	return t.SendText(msg.UserID, msg.Text, msg.Html, msg.Buttons, replyTo)
+}
+
+// callback answers a click on an inline button: the next step of a wizard replaces the clicked
+// message, other answers are new messages (restoring the keyboard) and the buttons of the
+// clicked message are removed so it can't be clicked twice
+func callback(b *bot.Bot, t Transport, ob *outbox.Outbox, u Update) {
+	it, ok := t.(InlineTransport)
+	if !ok {
+		log.Error().Msg(fmt.Sprintf("%v: callback without inline buttons", t.Name()))
+		return
+	}
+	b.Log(u.UserID, u.Data, u.UserName)
+	answers, notice := b.ProcessCallback(u.UserID, u.Data, u.UserName)
+	if err := it.AnswerCallback(u.CallbackID, notice); err != nil {
+		log.Error().Msg(fmt.Sprintf("%v: %v", t.Name(), err.Error()))
+	}
+	edited := false
+	for i, answer := range answers {
+		if !edited && answer.ImagePath == "" && answer.InlineButtons != nil {
+			answers[i].EditMessageID = u.MessageID
+			edited = true
+		}
+	}
+	if !edited {
+		answers = append([]bot.Message{{UserID: u.UserID, EditMessageID: u.MessageID}}, answers...)
+	}
+	ob.Push("", true, answers...)
+}
+
+func inlineQuery(b *bot.Bot, t Transport, u Update) {
+	it, ok := t.(InlineTransport)
+	if !ok {
+		log.Error().Msg(fmt.Sprintf("%v: inline query without inline support", t.Name()))
+		return
+	}
+	log.Debug().Msg(fmt.Sprintf("%v inline query <%v>", u.UserName, u.Text))
+	if err := it.AnswerInlineQuery(u.InlineQueryID, b.InlineQuery(u.Text)); err != nil {
+		log.Error().Msg(fmt.Sprintf("%v: %v", t.Name(), err.Error()))
+	}
+}
+
+func owner(transports []Transport, userID int64) Transport {
+	for _, t := range transports {
+		if t.Owns(userID) {
+			return t
+		}
+	}
+	return nil
+}
+
+// sendItem sends a message of the outbox, a blocked user is deleted
+func sendItem(b *bot.Bot, transports []Transport, ob *outbox.Outbox, item *outbox.Item) {
+	prefix := b.GetConfig().Meta.Prefix
+	t := owner(transports, item.Message.UserID)
+	if t == nil {
+		messagesTotal.Inc(prefix, "none", "failed")
+		ob.Fail(item, fmt.Errorf("no transport for user %v", item.Message.UserID), false)
+		return
+	}
+	err := send(t, item.Message, item.ReplyTo)
+	if err == nil {
+		messagesTotal.Inc(prefix, t.Name(), "sent")
+		ob.Done(item)
+		return
+	}
+	log.Error().Msg(fmt.Sprintf("%v: %v", t.Name(), err.Error()))
+	if t.IsBlocked(err) {
+		messagesTotal.Inc(prefix, t.Name(), "blocked")
+		ob.Fail(item, err, true)
+		if err := b.DeleteUser(item.Message.UserID); err != nil {
+			log.Error().Msg(err.Error())
+		} else {
+			log.Info().Msg("deleted user")
+		}
+		return
+	}
+	if retry, after := t.Retry(err); retry {
+		messagesTotal.Inc(prefix, t.Name(), "retried")
+		ob.Retry(item, err, after)
+		return
+	}
+	messagesTotal.Inc(prefix, t.Name(), "failed")
+	ob.Fail(item, err, false)
+}
+
+// Run connects the transports to the bot until quit is closed: the messages of the bot
+// (notifications, admin messages...) and the answers to the messages received by the
+// transports go through an outbox, sent by the transport owning the user.
+// The returned channel is closed once all the transports stopped receiving, the bot is stopped
+// and the outbox is saved.
+func Run(b *bot.Bot, transports []Transport, quit <-chan struct{}) <-chan struct{} {
+	ob := outbox.New(b.GetDao(), b.GetConfig().Lineup.BeginningSchedule)
+	b.SetQueueStats(ob.String)
+
+	// the channel is read until the bot is stopped, a message sent while quitting would
+	// block the bot otherwise
+	messages, stopped, read := b.GetMessageChannel(), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(read)
+		for {
+			select {
+			case msg := <-messages:
+				ob.Push("", false, msg)
+			case <-stopped:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				item, wait, wake := ob.Next(time.Now())
+				if item != nil {
+					sendItem(b, transports, ob, item)
+					continue
+				}
+				timer := time.NewTimer(wait)
+				select {
+				case <-wake:
+				case <-timer.C:
+				case <-quit:
+					timer.Stop()
+					ob.Flush()
+					return
+				}
+				timer.Stop()
+			}
+		}()
+	}
+
+	for _, t := range transports {
+		wg.Add(1)
+		go func(t Transport) {
+			defer wg.Done()
+			t.Receive(quit, func(u Update) {
+				if u.Group {
+					b.GroupChange(u.UserID, u.UserName, u.GroupName)
+					return
+				}
+				if u.CallbackID != "" {
+					callback(b, t, ob, u)
+					return
+				}
+				if u.InlineQueryID != "" {
+					inlineQuery(b, t, u)
+					return
+				}
+				b.Log(u.UserID, u.Text, u.UserName)
+				ob.Push(u.MessageID, true, b.ProcessCommand(u.UserID, u.Text, u.UserName)...)
+			})
+		}(t)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		b.Stop()
+		close(stopped)
+		<-read
+		ob.Flush()
+		close(done)
+	}()
+	return done
+}
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
+	"sort"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -19,6 +19,7 @@ type UserInfo struct {
 	MagicButton1  int
 	MagicButton2  int
 	MapImageShown bool
+	LikedDjs      []string
 }
 
 type Users struct {
@@ -28,29 +29,75 @@ type Users struct {
 	prefix    string
 }
 
+const (
+	legacyKey = "users" // every user in one value, before they were saved apart
+	idsKey    = "userIds"
+	userKey   = "user-%d"
+)
+
 func New(dao dao.Dao, prefix string, startTime time.Time) Users {
-	usersInfo := make(map[int64]*UserInfo)
-	usersString, err := dao.Get("users", startTime)
+	res := Users{
+		usersInfo: make(map[int64]*UserInfo),
+		dao:       dao,
+		startTime: startTime,
+		prefix:    prefix,
+	}
+	idsString, err := dao.Get(idsKey, startTime)
 	if err != nil {
 		if err.Error() == "redis: nil" {
-			log.Warn().Msg("empty dao.Users")
+			res.loadLegacy()
 		} else {
 			log.Error().Msg(err.Error())
 		}
-	} else {
-		err = json.Unmarshal([]byte(usersString), &usersInfo)
+		return res
+	}
+	ids := []int64{}
+	if err := json.Unmarshal([]byte(idsString), &ids); err != nil {
+		log.Error().Msg(err.Error())
+		return res
+	}
+	for _, id := range ids {
+		s, err := dao.Get(fmt.Sprintf(userKey, id), startTime)
 		if err != nil {
+			log.Error().Msg(fmt.Sprintf("user %d: %v", id, err))
+			continue
+		}
+		info := &UserInfo{}
+		if err := json.Unmarshal([]byte(s), info); err != nil {
 			log.Error().Msg(err.Error())
+			continue
 		}
-	}
-	res := Users{
-		usersInfo: usersInfo,
-		dao:       dao,
-		startTime: startTime,
-		prefix:    prefix,
+		res.usersInfo[id] = info
 	}
 	return res
 }
+
+// loadLegacy loads the users saved in one value and saves them apart
+func (u *Users) loadLegacy() {
+	usersString, err := u.dao.Get(legacyKey, u.startTime)
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			log.Warn().Msg("empty dao.Users")
+		} else {
+			log.Error().Msg(err.Error())
+		}
+		return
+	}
+	if err := json.Unmarshal([]byte(usersString), &u.usersInfo); err != nil {
+		log.Error().Msg(err.Error())
+		return
+	}
+	log.Info().Msg(fmt.Sprintf("saving %d users apart", len(u.usersInfo)))
+	for id := range u.usersInfo {
+		if err := u.saveUser(id); err != nil {
+			log.Error().Msg(err.Error())
+		}
+	}
+	if err := u.saveIds(); err != nil {
+		log.Error().Msg(err.Error())
+	}
+}
+
 func PrettyString(str string) (string, error) {
 	var prettyJSON bytes.Buffer
 	if err := json.Indent(&prettyJSON, []byte(str), "", "    "); err != nil {
@@ -59,18 +106,28 @@ func PrettyString(str string) (string, error) {
 	return prettyJSON.String(), nil
 }
 
-func (u *Users) SaveUsers() error {
-	bytes, err := json.Marshal(u.usersInfo)
+// saveIds saves the list of the users, only needed when a user is added
+func (u *Users) saveIds() error {
+	ids := []int64{}
+	for k := range u.usersInfo {
+		ids = append(ids, k)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	bytes, err := json.Marshal(ids)
 	if err != nil {
 		panic(err)
 	}
-	s := string(bytes)
-	res, err := PrettyString(s)
+	return u.dao.Save(idsKey, u.startTime, string(bytes))
+}
+
+func (u *Users) saveUser(userId int64) error {
+	bytes, err := json.Marshal(u.usersInfo[userId])
 	if err != nil {
-		log.Error().Msg(err.Error())
+		panic(err)
 	}
-	log.Trace().Msg(res)
-	return u.dao.Save("users", u.startTime, s)
+	s := string(bytes)
+	log.Trace().Msg(s)
+	return u.dao.Save(fmt.Sprintf(userKey, userId), u.startTime, s)
 }
 
 func (u Users) MapImageShown(userId int64) (bool, error) {
@@ -88,7 +145,7 @@ func (u *Users) SetMapImageShown(userId int64) error {
 		return errors.New("trying to set MapImageShown on unknown user")
 	}
 	u.usersInfo[userId].MapImageShown = true
-	return u.SaveUsers()
+	return u.saveUser(userId)
 }
 
 func (u Users) HasUserNotifications(userId int64) (bool, error) {
@@ -106,7 +163,7 @@ func (u *Users) DeleteUser(userId int64) error {
 		return errors.New("trying to delete unknown user")
 	}
 	u.usersInfo[userId].Deleted = true
-	return u.SaveUsers()
+	return u.saveUser(userId)
 }
 
 func (u *Users) SetNotificationsUser(userId int64, notification bool) error {
@@ -115,7 +172,7 @@ func (u *Users) SetNotificationsUser(userId int64, notification bool) error {
 		return errors.New("trying to set notifications on unknown user")
 	}
 	u.usersInfo[userId].Notifications = notification
-	return u.SaveUsers()
+	return u.saveUser(userId)
 }
 
 func (u *Users) SetUserAsNew(userId int64) error {
@@ -124,7 +181,7 @@ func (u *Users) SetUserAsNew(userId int64) error {
 		return errors.New("trying to set SetUserAsNew on unknown user")
 	}
 	u.usersInfo[userId].NewUser = true
-	return u.SaveUsers()
+	return u.saveUser(userId)
 }
 
 func (u *Users) GetMagicButtons(userId int64) (int, int) {
@@ -157,25 +214,16 @@ func (u *Users) UpdateMagicButtons(userId int64, room int, nbRooms int) error {
 		}
 		u.usersInfo[userId].MagicButton2 = i
 	}
-	return u.SaveUsers()
-}
-
-func (u *Users) StatsUsingTelegramId(userId int64) {
-	i, err := u.dao.SaveHset24Hours("stats-telegram-users-"+u.prefix, strconv.FormatInt(userId, 10))
-	if err != nil {
-		log.Info().Msgf("SaveHset24Hours: %v %v %v\n", userId, i, err)
-	}
+	return u.saveUser(userId)
 }
 
 func (u *Users) DoesUserExists(userId int64) bool {
 
-	go u.StatsUsingTelegramId(userId)
-
 	_, ok := u.usersInfo[userId]
 	if ok {
 		if u.usersInfo[userId].Deleted {
 			u.usersInfo[userId].Deleted = false
-			u.SaveUsers()
+			u.saveUser(userId)
 		}
 		return true
 	}
@@ -183,7 +231,11 @@ func (u *Users) DoesUserExists(userId int64) bool {
 		Notifications: false,
 		Deleted:       false,
 	}
-	err := u.SaveUsers()
+	// the user first, the list of the users never points to a missing one
+	err := u.saveUser(userId)
+	if err == nil {
+		err = u.saveIds()
+	}
 	if err != nil {
 		log.Error().Msg(err.Error())
 	}
@@ -200,6 +252,55 @@ func (u Users) UsersWithNotifications() []int64 {
 	return res
 }
 
+func (u Users) LikedDjs(userId int64) []string {
+	info, ok := u.usersInfo[userId]
+	if !ok {
+		return []string{}
+	}
+	return append([]string{}, info.LikedDjs...)
+}
+
+func (u *Users) LikeDj(userId int64, dj string) error {
+	_, ok := u.usersInfo[userId]
+	if !ok {
+		return errors.New("trying to LikeDj on unknown user")
+	}
+	for _, v := range u.usersInfo[userId].LikedDjs {
+		if v == dj {
+			return nil
+		}
+	}
+	u.usersInfo[userId].LikedDjs = append(u.usersInfo[userId].LikedDjs, dj)
+	return u.saveUser(userId)
+}
+
+func (u *Users) UnlikeDj(userId int64, dj string) error {
+	_, ok := u.usersInfo[userId]
+	if !ok {
+		return errors.New("trying to UnlikeDj on unknown user")
+	}
+	likedDjs := []string{}
+	for _, v := range u.usersInfo[userId].LikedDjs {
+		if v != dj {
+			likedDjs = append(likedDjs, v)
+		}
+	}
+	u.usersInfo[userId].LikedDjs = likedDjs
+	return u.saveUser(userId)
+}
+
+// UsersWithLikedDjs returns the liked djs of the users (not deleted, with the notifications on)
+// having liked at least one dj
+func (u Users) UsersWithLikedDjs() map[int64][]string {
+	res := make(map[int64][]string)
+	for k, v := range u.usersInfo {
+		if !v.Deleted && v.Notifications && len(v.LikedDjs) != 0 {
+			res[k] = v.LikedDjs
+		}
+	}
+	return res
+}
+
 func (u Users) UsersStats() (int, int, int, int) {
 	newUsers := 0
 	totalUsers := 0
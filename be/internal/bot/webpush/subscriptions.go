@@ -0,0 +1,128 @@
+package webpush
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	dao "github.com/shallowBunny/app/be/internal/infrastructure/repository"
+)
+
+const (
+	idsKey           = "pushSubscriptionIds"
+	subscriptionKey  = "pushSubscription-%v"
+	maxSubscriptions = 20000
+)
+
+// Subscriptions are the push subscriptions of a festival, saved apart by id as the users and without ttl
+type Subscriptions struct {
+	subscriptions map[string]Subscription // id -> subscription
+	dao           dao.Dao
+	startTime     time.Time
+}
+
+// id identifies a subscription by its endpoint, the endpoints are secret
+func id(endpoint string) string {
+	h := sha256.Sum256([]byte(endpoint))
+	return hex.EncodeToString(h[:8])
+}
+
+func NewSubscriptions(dao dao.Dao, startTime time.Time) Subscriptions {
+	res := Subscriptions{
+		subscriptions: make(map[string]Subscription),
+		dao:           dao,
+		startTime:     startTime,
+	}
+	idsString, err := dao.Get(idsKey, startTime)
+	if err != nil {
+		if err.Error() != "redis: nil" {
+			log.Error().Msg(err.Error())
+		}
+		return res
+	}
+	ids := []string{}
+	if err := json.Unmarshal([]byte(idsString), &ids); err != nil {
+		log.Error().Msg(err.Error())
+		return res
+	}
+	for _, id := range ids {
+		s, err := dao.Get(fmt.Sprintf(subscriptionKey, id), startTime)
+		if err != nil {
+			log.Error().Msg(fmt.Sprintf("push subscription %v: %v", id, err))
+			continue
+		}
+		var sub Subscription
+		if err := json.Unmarshal([]byte(s), &sub); err != nil {
+			log.Error().Msg(err.Error())
+			continue
+		}
+		res.subscriptions[id] = sub
+	}
+	return res
+}
+
+func (s *Subscriptions) saveIds() error {
+	ids := []string{}
+	for k := range s.subscriptions {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+	bytes, err := json.Marshal(ids)
+	if err != nil {
+		panic(err)
+	}
+	return s.dao.SaveWithoutTtl(idsKey, s.startTime, string(bytes))
+}
+
+// Add adds or updates (i.e. its rooms) a subscription
+func (s *Subscriptions) Add(sub Subscription) error {
+	if err := sub.Check(); err != nil {
+		return err
+	}
+	k := id(sub.Endpoint)
+	_, known := s.subscriptions[k]
+	if !known && len(s.subscriptions) >= maxSubscriptions {
+		return errors.New("too many push subscriptions")
+	}
+	bytes, err := json.Marshal(sub)
+	if err != nil {
+		panic(err)
+	}
+	if err := s.dao.SaveWithoutTtl(fmt.Sprintf(subscriptionKey, k), s.startTime, string(bytes)); err != nil {
+		return err
+	}
+	s.subscriptions[k] = sub
+	if known {
+		return nil
+	}
+	return s.saveIds()
+}
+
+// Remove removes the subscription of endpoint, it returns false if it was unknown
+func (s *Subscriptions) Remove(endpoint string) (bool, error) {
+	k := id(endpoint)
+	if _, ok := s.subscriptions[k]; !ok {
+		return false, nil
+	}
+	delete(s.subscriptions, k)
+	return true, s.saveIds()
+}
+
+// All returns the subscriptions sorted by id
+func (s Subscriptions) All() []Subscription {
+	ids := []string{}
+	for k := range s.subscriptions {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+	res := []Subscription{}
+	for _, k := range ids {
+		res = append(res, s.subscriptions[k])
+	}
+	return res
+}
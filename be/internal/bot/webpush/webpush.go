@@ -0,0 +1,276 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	dao "github.com/shallowBunny/app/be/internal/infrastructure/repository"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	keysKey     = "vapidKeys"
+	recordSize  = 4096
+	headerSize  = 16 + 4 + 1 + 65 // salt, record size, key id length, key id
+	maxPayload  = recordSize - headerSize - 16 - 1
+	jwtDuration = 12 * time.Hour
+	ttl         = 4 * time.Hour // the push service drops the message after, nobody needs an old set start
+)
+
+// ErrGone is returned by Send when the subscription expired or was removed by the user
+var ErrGone = errors.New("push subscription gone")
+
+var b64 = base64.RawURLEncoding
+
+// Keys are the VAPID keys identifying the server to the push services (RFC 8292)
+type Keys struct {
+	private *ecdsa.PrivateKey
+	// PublicKey is the applicationServerKey of PushManager.subscribe, base64url encoded
+	PublicKey string
+}
+
+// savedKeys is what is saved of the keys, the private key in PKCS #8
+type savedKeys struct {
+	PrivateKey string
+}
+
+func GenerateKeys() (*Keys, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newKeys(private)
+}
+
+func newKeys(private *ecdsa.PrivateKey) (*Keys, error) {
+	public, err := private.PublicKey.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	return &Keys{private: private, PublicKey: b64.EncodeToString(public.Bytes())}, nil
+}
+
+// LoadKeys returns the keys saved in the dao without ttl, they are generated on the first call
+func LoadKeys(dao dao.Dao, startTime time.Time) (*Keys, error) {
+	s, err := dao.Get(keysKey, startTime)
+	if err != nil {
+		if err.Error() != "redis: nil" {
+			return nil, err
+		}
+		keys, err := GenerateKeys()
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(keys.private)
+		if err != nil {
+			return nil, err
+		}
+		bytes, err := json.Marshal(savedKeys{PrivateKey: b64.EncodeToString(der)})
+		if err != nil {
+			panic(err)
+		}
+		return keys, dao.SaveWithoutTtl(keysKey, startTime, string(bytes))
+	}
+	var saved savedKeys
+	if err := json.Unmarshal([]byte(s), &saved); err != nil {
+		return nil, err
+	}
+	der, err := b64.DecodeString(saved.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("vapid key is not an ecdsa key")
+	}
+	return newKeys(private)
+}
+
+// authorization returns the Authorization header of a request to the push service of endpoint
+func (k *Keys) authorization(endpoint, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	claims, _ := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(jwtDuration).Unix(),
+		"sub": subject,
+	})
+	unsigned := b64.EncodeToString(header) + "." + b64.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, k.private, hash[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return fmt.Sprintf("vapid t=%v.%v, k=%v", unsigned, b64.EncodeToString(signature), k.PublicKey), nil
+}
+
+// Subscription is the PushSubscription of a browser, Rooms filters the sets notified
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+	Rooms []string `json:"rooms,omitempty"`
+}
+
+// Check returns an error if the subscription can't be used
+func (s Subscription) Check() error {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("endpoint must be an https url")
+	}
+	if p, err := b64.DecodeString(s.Keys.P256dh); err != nil || len(p) != 65 {
+		return errors.New("invalid p256dh key")
+	}
+	if a, err := b64.DecodeString(s.Keys.Auth); err != nil || len(a) != 16 {
+		return errors.New("invalid auth secret")
+	}
+	return nil
+}
+
+// hkdfRead derives length bytes from secret (RFC 5869)
+func hkdfRead(secret, salt, info []byte, length int) ([]byte, error) {
+	res := make([]byte, length)
+	_, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), res)
+	return res, err
+}
+
+// encrypt encrypts the payload for the subscription in one aes128gcm record (RFC 8291, RFC 8188)
+func encrypt(payload []byte, s Subscription) ([]byte, error) {
+	if len(payload) > maxPayload {
+		return nil, fmt.Errorf("payload of %d bytes, max %d", len(payload), maxPayload)
+	}
+	p256dh, err := b64.DecodeString(s.Keys.P256dh)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := b64.DecodeString(s.Keys.Auth)
+	if err != nil {
+		return nil, err
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(p256dh)
+	if err != nil {
+		return nil, err
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	secret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), p256dh...), asPublic...)
+	ikm, err := hkdfRead(secret, auth, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdfRead(ikm, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdfRead(ikm, salt, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	res := bytes.NewBuffer(make([]byte, 0, headerSize+len(payload)+17))
+	res.Write(salt)
+	binary.Write(res, binary.BigEndian, uint32(recordSize))
+	res.WriteByte(byte(len(asPublic)))
+	res.Write(asPublic)
+	// 0x02 is the padding delimiter of the last record
+	record := append(append([]byte{}, payload...), 0x02)
+	return gcm.Seal(res.Bytes(), nonce, record, nil), nil
+}
+
+// Sender sends the notifications to the push services
+type Sender struct {
+	keys    *Keys
+	subject string
+	client  *http.Client
+}
+
+// NewSender returns a sender identified by subject, a mailto: or https: url of the admins
+func NewSender(keys *Keys, subject string, client *http.Client) *Sender {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Sender{keys: keys, subject: subject, client: client}
+}
+
+// Send sends the payload to the subscription, it returns ErrGone when the subscription must
+// be removed
+func (s *Sender) Send(sub Subscription, payload []byte) error {
+	body, err := encrypt(payload, sub)
+	if err != nil {
+		return err
+	}
+	auth, err := s.keys.authorization(sub.Endpoint, s.subject, time.Now())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode >= 300:
+		answer, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push service answered %v: %s", resp.Status, answer)
+	}
+	return nil
+}
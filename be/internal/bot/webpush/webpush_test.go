@@ -0,0 +1,112 @@
+package webpush_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/webpush"
+	"github.com/shallowBunny/app/be/internal/bot/webpush/webpushtest"
+	DaoMem "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoMem"
+)
+
+func TestSend(t *testing.T) {
+	service := webpushtest.NewService()
+	defer service.Close()
+	dao := DaoMem.New()
+	startTime := time.Date(2024, 8, 15, 0, 0, 0, 0, time.Local)
+	keys, err := webpush.LoadKeys(dao, startTime)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if again, err := webpush.LoadKeys(dao, startTime); err != nil || again.PublicKey != keys.PublicKey {
+		t.Fatalf("expected the saved keys, got %v %v", again, err)
+	}
+	sender := webpush.NewSender(keys, "mailto:admin@example.com", service.Client())
+
+	sub := service.Subscribe()
+	if err := sender.Send(sub, []byte("DJ FART started in 🍵")); err != nil {
+		t.Fatalf(err.Error())
+	}
+	long := strings.Repeat("x", 3000)
+	if err := sender.Send(sub, []byte(long)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if m := service.Messages(sub); len(m) != 2 || m[0] != "DJ FART started in 🍵" || m[1] != long {
+		t.Fatalf("unexpected messages %v", m)
+	}
+	if err := sender.Send(sub, []byte(strings.Repeat("x", 5000))); err == nil {
+		t.Fatalf("expected the payload to be too long")
+	}
+
+	service.Unsubscribe(sub)
+	if err := sender.Send(sub, []byte("gone")); !errors.Is(err, webpush.ErrGone) {
+		t.Fatalf("expected gone, got %v", err)
+	}
+
+	other, _ := webpush.GenerateKeys()
+	if err := webpush.NewSender(other, "", service.Client()).Send(service.Subscribe(), []byte("no subject")); err == nil {
+		t.Fatalf("expected the push service to refuse a jwt without subject")
+	}
+	if errs := service.Errors(); len(errs) != 1 {
+		t.Fatalf("expected one refused request, got %v", errs)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	service := webpushtest.NewService()
+	defer service.Close()
+	dao := DaoMem.New()
+	startTime := time.Date(2024, 8, 15, 0, 0, 0, 0, time.Local)
+
+	s := webpush.NewSubscriptions(dao, startTime)
+	sub1 := service.Subscribe()
+	sub2 := service.Subscribe("🍵")
+	for _, sub := range []webpush.Subscription{sub1, sub2, sub2} {
+		if err := s.Add(sub); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	invalid := service.Subscribe()
+	invalid.Keys.Auth = "x"
+	if err := s.Add(invalid); err == nil {
+		t.Fatalf("expected an invalid subscription")
+	}
+	if removed, err := s.Remove(sub1.Endpoint); !removed || err != nil {
+		t.Fatalf("expected sub1 removed, got %v %v", removed, err)
+	}
+
+	// restart
+	all := webpush.NewSubscriptions(dao, startTime).All()
+	if len(all) != 1 || all[0].Endpoint != sub2.Endpoint || len(all[0].Rooms) != 1 {
+		t.Fatalf("unexpected subscriptions %v", all)
+	}
+}
+
+// ttlDao refuses the values saved with a ttl
+type ttlDao struct {
+	*DaoMem.DaoMem
+}
+
+func (d ttlDao) Save(key string, startTime time.Time, value string) error {
+	return errors.New("saved with a ttl: " + key)
+}
+
+func TestWithoutTtl(t *testing.T) {
+	service := webpushtest.NewService()
+	defer service.Close()
+	dao := ttlDao{DaoMem.New()}
+	startTime := time.Date(2024, 8, 15, 0, 0, 0, 0, time.Local)
+
+	if _, err := webpush.LoadKeys(dao, startTime); err != nil {
+		t.Fatalf(err.Error())
+	}
+	s := webpush.NewSubscriptions(dao, startTime)
+	if err := s.Add(service.Subscribe("🍵")); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if all := webpush.NewSubscriptions(dao, startTime).All(); len(all) != 1 {
+		t.Fatalf("unexpected subscriptions %v", all)
+	}
+}
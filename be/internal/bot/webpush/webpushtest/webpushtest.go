@@ -0,0 +1,228 @@
+// Package webpushtest is a fake push service checking the VAPID authorization and
+// decrypting the notifications as a browser would
+package webpushtest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/webpush"
+	"golang.org/x/crypto/hkdf"
+)
+
+var b64 = base64.RawURLEncoding
+
+type browser struct {
+	private  *ecdh.PrivateKey
+	auth     []byte
+	gone     bool
+	messages []string
+}
+
+// Service is a push service on a local https server, use its Client to send
+type Service struct {
+	*httptest.Server
+	mu       sync.Mutex
+	browsers map[string]*browser // path -> browser
+	errs     []error
+}
+
+func NewService() *Service {
+	s := &Service{browsers: make(map[string]*browser)}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Subscribe returns the subscription of a new browser
+func (s *Service) Subscribe(rooms ...string) webpush.Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	b := &browser{private: private, auth: make([]byte, 16)}
+	rand.Read(b.auth)
+	path := fmt.Sprintf("/push/%d", len(s.browsers))
+	s.browsers[path] = b
+	var sub webpush.Subscription
+	sub.Endpoint = s.URL + path
+	sub.Keys.P256dh = b64.EncodeToString(private.PublicKey().Bytes())
+	sub.Keys.Auth = b64.EncodeToString(b.auth)
+	sub.Rooms = rooms
+	return sub
+}
+
+// Unsubscribe makes the push service answer 410 Gone for the subscription
+func (s *Service) Unsubscribe(sub webpush.Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.browsers[strings.TrimPrefix(sub.Endpoint, s.URL)].gone = true
+}
+
+// Messages returns the payloads received by the browser of the subscription
+func (s *Service) Messages(sub webpush.Subscription) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.browsers[strings.TrimPrefix(sub.Endpoint, s.URL)].messages...)
+}
+
+// Errors returns the requests refused by the push service
+func (s *Service) Errors() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]error{}, s.errs...)
+}
+
+func (s *Service) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.browsers[r.URL.Path]
+	if !ok || b.gone {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	fail := func(err error) {
+		s.errs = append(s.errs, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+	if err := s.checkAuthorization(r.Header.Get("Authorization")); err != nil {
+		fail(err)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+		fail(errors.New("missing Content-Encoding or TTL"))
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		fail(err)
+		return
+	}
+	payload, err := decrypt(body, b)
+	if err != nil {
+		fail(err)
+		return
+	}
+	b.messages = append(b.messages, string(payload))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// checkAuthorization checks the "vapid t=<jwt>, k=<public key>" header (RFC 8292)
+func (s *Service) checkAuthorization(header string) error {
+	var token, key string
+	for _, v := range strings.Split(strings.TrimPrefix(header, "vapid "), ",") {
+		v = strings.TrimSpace(v)
+		if strings.HasPrefix(v, "t=") {
+			token = v[2:]
+		} else if strings.HasPrefix(v, "k=") {
+			key = v[2:]
+		}
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || key == "" {
+		return fmt.Errorf("invalid authorization <%v>", header)
+	}
+	public, err := b64.DecodeString(key)
+	if err != nil {
+		return err
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), public)
+	if x == nil {
+		return errors.New("invalid vapid key")
+	}
+	signature, err := b64.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return errors.New("invalid jwt signature")
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, sig := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, hash[:], r, sig) {
+		return errors.New("wrong jwt signature")
+	}
+	claimsJSON, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		Aud string
+		Exp int64
+		Sub string
+	}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return err
+	}
+	if claims.Aud != s.URL || claims.Exp < time.Now().Unix() || claims.Exp > time.Now().Add(24*time.Hour).Unix() || claims.Sub == "" {
+		return fmt.Errorf("invalid jwt claims %+v", claims)
+	}
+	return nil
+}
+
+func hkdfRead(secret, salt, info []byte, length int) []byte {
+	res := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), res); err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// decrypt decrypts an aes128gcm body of one record (RFC 8291, RFC 8188)
+func decrypt(body []byte, b *browser) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, errors.New("body too short")
+	}
+	salt := body[:16]
+	recordSize := binary.BigEndian.Uint32(body[16:20])
+	idLen := int(body[20])
+	if len(body) < 21+idLen || uint32(len(body)-21-idLen) > recordSize {
+		return nil, errors.New("invalid header")
+	}
+	asPublic, err := ecdh.P256().NewPublicKey(body[21 : 21+idLen])
+	if err != nil {
+		return nil, err
+	}
+	secret, err := b.private.ECDH(asPublic)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := append(append([]byte("WebPush: info\x00"), b.private.PublicKey().Bytes()...), asPublic.Bytes()...)
+	ikm := hkdfRead(secret, b.auth, keyInfo, 32)
+	block, err := aes.NewCipher(hkdfRead(ikm, salt, []byte("Content-Encoding: aes128gcm\x00"), 16))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	record, err := gcm.Open(nil, hkdfRead(ikm, salt, []byte("Content-Encoding: nonce\x00"), 12), body[21+idLen:], nil)
+	if err != nil {
+		return nil, err
+	}
+	// padding of zeros after the delimiter of the last record
+	i := len(record) - 1
+	for i >= 0 && record[i] == 0 {
+		i--
+	}
+	if i < 0 || record[i] != 0x02 {
+		return nil, errors.New("missing last record delimiter")
+	}
+	return record[:i], nil
+}
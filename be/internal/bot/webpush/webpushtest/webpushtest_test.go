@@ -0,0 +1,21 @@
+package webpushtest
+
+import (
+	"crypto/ecdh"
+	"testing"
+)
+
+// example of RFC 8291 appendix A
+func TestDecrypt(t *testing.T) {
+	uaPrivate, _ := b64.DecodeString("q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94")
+	auth, _ := b64.DecodeString("BTBZMqHH6r4Tts7J_aSIgg")
+	body, _ := b64.DecodeString("DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN")
+	private, err := ecdh.P256().NewPrivateKey(uaPrivate)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	res, err := decrypt(body, &browser{private: private, auth: auth})
+	if err != nil || string(res) != "When I grow up, I want to be a watermelon" {
+		t.Fatalf("unexpected plaintext %q %v", res, err)
+	}
+}
@@ -0,0 +1,407 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/araddon/dateparse"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	fieldRoom     = "room"
+	fieldDate     = "date"
+	fieldDay      = "day"
+	fieldStart    = "start"
+	fieldEnd      = "end"
+	fieldDuration = "duration"
+	fieldDj       = "dj"
+	fieldLink     = "link"
+	fieldSkip     = "-"
+)
+
+// headers recognized without explicit mapping
+var defaultHeaders = map[string]string{
+	"room":     fieldRoom,
+	"stage":    fieldRoom,
+	"floor":    fieldRoom,
+	"date":     fieldDate,
+	"day":      fieldDay,
+	"start":    fieldStart,
+	"begin":    fieldStart,
+	"from":     fieldStart,
+	"time":     fieldStart,
+	"end":      fieldEnd,
+	"stop":     fieldEnd,
+	"to":       fieldEnd,
+	"duration": fieldDuration,
+	"length":   fieldDuration,
+	"dj":       fieldDj,
+	"artist":   fieldDj,
+	"act":      fieldDj,
+	"name":     fieldDj,
+	"link":     fieldLink,
+	"links":    fieldLink,
+	"url":      fieldLink,
+}
+
+type Importer struct {
+	rooms             []string
+	beginningSchedule time.Time
+	mapping           map[string]string // lowercase header -> field
+}
+
+// New returns an importer for the rooms of a config, mapping overrides the recognized headers
+func New(rooms []string, beginningSchedule time.Time, mapping map[string]string) *Importer {
+	m := make(map[string]string)
+	for k, v := range defaultHeaders {
+		m[k] = v
+	}
+	for k, v := range mapping {
+		m[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	return &Importer{
+		rooms:             rooms,
+		beginningSchedule: beginningSchedule,
+		mapping:           m,
+	}
+}
+
+// ParseMapping parses "Stage=room,Artist=dj,Soundcloud=link"
+func ParseMapping(s string) (map[string]string, error) {
+	res := make(map[string]string)
+	if s == "" {
+		return res, nil
+	}
+	for _, v := range strings.Split(s, ",") {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid column mapping <%v>", v)
+		}
+		field := strings.ToLower(strings.TrimSpace(kv[1]))
+		switch field {
+		case fieldRoom, fieldDate, fieldDay, fieldStart, fieldEnd, fieldDuration, fieldDj, fieldLink, fieldSkip:
+		default:
+			return nil, fmt.Errorf("unknown field <%v> in column mapping", field)
+		}
+		res[strings.TrimSpace(kv[0])] = field
+	}
+	return res, nil
+}
+
+// ImportFile reads a .csv or .xlsx file
+func (i *Importer) ImportFile(fileName string) (config.Lineup, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return config.Lineup{}, err
+	}
+	var rows [][]string
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".xlsx":
+		rows, err = readXLSX(data)
+	case ".csv", ".tsv", ".txt":
+		r := csv.NewReader(strings.NewReader(string(data)))
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		if strings.ToLower(filepath.Ext(fileName)) == ".tsv" {
+			r.Comma = '\t'
+		} else if strings.Count(strings.SplitN(string(data), "\n", 2)[0], ";") > strings.Count(strings.SplitN(string(data), "\n", 2)[0], ",") {
+			r.Comma = ';' // spreadsheets with a comma as decimal separator export with semicolons
+		}
+		rows, err = r.ReadAll()
+	default:
+		return config.Lineup{}, fmt.Errorf("unsupported file type <%v>, use .csv or .xlsx", filepath.Ext(fileName))
+	}
+	if err != nil {
+		return config.Lineup{}, err
+	}
+	return i.Import(rows)
+}
+
+func normalizeRoom(s string) string {
+	res := []rune{}
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			res = append(res, r)
+		}
+	}
+	return string(res)
+}
+
+// findRoom matches a room of the file with a room of the config, ignoring case, spaces and emoticons
+func (i *Importer) findRoom(s string) (string, bool) {
+	for _, v := range i.rooms {
+		if v == s {
+			return v, true
+		}
+	}
+	n := normalizeRoom(s)
+	if n == "" {
+		return "", false
+	}
+	for _, v := range i.rooms {
+		if normalizeRoom(v) == n {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// parseClock parses "22:00", "22.00", "2200", "22h30", "22" or a date with a time
+func parseClock(s string) (int, int, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if t, err := dateparse.ParseLocal(s); err == nil && strings.ContainsAny(s, "-/") {
+		return t.Hour(), t.Minute(), nil
+	}
+	s = strings.NewReplacer(".", ":", "h", ":").Replace(s)
+	hour, min := -1, 0
+	var err error
+	switch {
+	case strings.Contains(s, ":"):
+		parts := strings.SplitN(s, ":", 2)
+		hour, err = strconv.Atoi(parts[0])
+		if err == nil && parts[1] != "" {
+			min, err = strconv.Atoi(parts[1][:min2(2, len(parts[1]))])
+		}
+	case len(s) == 4:
+		hour, err = strconv.Atoi(s[:2])
+		if err == nil {
+			min, err = strconv.Atoi(s[2:])
+		}
+	default:
+		hour, err = strconv.Atoi(s)
+	}
+	if err != nil || hour < 0 || hour > 24 || min < 0 || min > 59 {
+		return 0, 0, fmt.Errorf("invalid time <%v>", s)
+	}
+	return hour % 24, min, nil
+}
+
+func min2(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// parseDuration parses minutes ("90"), "1:30" or "1h30"
+func parseDuration(s string) (int, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if m, err := strconv.Atoi(s); err == nil {
+		return m, nil
+	}
+	s = strings.TrimSuffix(strings.NewReplacer("h", ":", "min", "").Replace(s), ":")
+	parts := strings.SplitN(s, ":", 2)
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration <%v>", s)
+	}
+	mins := 0
+	if len(parts) == 2 && parts[1] != "" {
+		mins, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration <%v>", s)
+		}
+	}
+	return hours*60 + mins, nil
+}
+
+// dayIndex returns the number of days between the beginning of the schedule and the date
+func (i *Importer) dayIndex(t time.Time) int {
+	b := i.beginningSchedule
+	d0 := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, b.Location())
+	d1 := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, b.Location())
+	return int(math.Round(d1.Sub(d0).Hours() / 24))
+}
+
+// parseDay parses a day index ("1") or a week day ("Fri", "Friday"), counted from the beginning of the schedule
+func (i *Importer) parseDay(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if d, err := strconv.Atoi(s); err == nil {
+		return d, nil
+	}
+	for d := 0; d < 7; d++ {
+		day := i.beginningSchedule.AddDate(0, 0, d)
+		if strings.EqualFold(s, day.Format("Mon")) || strings.EqualFold(s, day.Format("Monday")) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day <%v>", s)
+}
+
+// Import converts the rows of a timetable (first row being the headers) into a lineup
+func (i *Importer) Import(rows [][]string) (config.Lineup, error) {
+	lineup := config.Lineup{
+		BeginningSchedule: i.beginningSchedule,
+		Rooms:             i.rooms,
+		Sets:              make(map[string][]config.Set),
+	}
+	if len(rows) < 2 {
+		return lineup, errors.New("no data, expecting a header row and at least one set")
+	}
+
+	fields := make(map[string]int)
+	links := make(map[int]string)
+	for index, h := range rows[0] {
+		header := strings.TrimSpace(h)
+		field, ok := i.mapping[strings.ToLower(header)]
+		if !ok {
+			field, ok = i.mapping[header]
+		}
+		if !ok || field == fieldSkip {
+			continue
+		}
+		if field == fieldLink {
+			links[index] = strings.ToLower(header)
+			continue
+		}
+		if _, exists := fields[field]; !exists {
+			fields[field] = index
+		}
+	}
+	for _, f := range []string{fieldRoom, fieldStart, fieldDj} {
+		if _, ok := fields[f]; !ok {
+			return lineup, fmt.Errorf("missing column for <%v> in headers %v", f, rows[0])
+		}
+	}
+	_, hasEnd := fields[fieldEnd]
+	_, hasDuration := fields[fieldDuration]
+	if !hasEnd && !hasDuration {
+		return lineup, fmt.Errorf("missing column for <%v> or <%v> in headers %v", fieldEnd, fieldDuration, rows[0])
+	}
+
+	cell := func(row []string, field string) string {
+		index, ok := fields[field]
+		if !ok || index >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[index])
+	}
+
+	errorString := ""
+	for n, row := range rows[1:] {
+		line := n + 2
+		empty := true
+		for _, v := range row {
+			if strings.TrimSpace(v) != "" {
+				empty = false
+			}
+		}
+		if empty {
+			continue
+		}
+
+		room, ok := i.findRoom(cell(row, fieldRoom))
+		if !ok {
+			errorString += fmt.Sprintf("row %d: unknown room <%v>, known rooms: %v\n", line, cell(row, fieldRoom), i.rooms)
+			continue
+		}
+		dj := cell(row, fieldDj)
+		if dj == "" {
+			errorString += fmt.Sprintf("row %d: missing dj\n", line)
+			continue
+		}
+		hour, min, err := parseClock(cell(row, fieldStart))
+		if err != nil {
+			errorString += fmt.Sprintf("row %d: %v\n", line, err)
+			continue
+		}
+
+		day := 0
+		switch {
+		case cell(row, fieldDate) != "":
+			t, err := dateparse.ParseIn(cell(row, fieldDate), i.beginningSchedule.Location())
+			if err != nil {
+				errorString += fmt.Sprintf("row %d: invalid date <%v>\n", line, cell(row, fieldDate))
+				continue
+			}
+			day = i.dayIndex(t)
+		case cell(row, fieldDay) != "":
+			day, err = i.parseDay(cell(row, fieldDay))
+			if err != nil {
+				errorString += fmt.Sprintf("row %d: %v\n", line, err)
+				continue
+			}
+		default:
+			t, err := dateparse.ParseIn(cell(row, fieldStart), i.beginningSchedule.Location())
+			if err != nil || !strings.ContainsAny(cell(row, fieldStart), "-/") {
+				errorString += fmt.Sprintf("row %d: missing date or day\n", line)
+				continue
+			}
+			day = i.dayIndex(t)
+		}
+		if day < 0 {
+			errorString += fmt.Sprintf("row %d: set before the beginning of the schedule %v\n", line, i.beginningSchedule.Format("Mon Jan 2 2006"))
+			continue
+		}
+
+		duration := 0
+		if cell(row, fieldDuration) != "" {
+			duration, err = parseDuration(cell(row, fieldDuration))
+		} else {
+			var endHour, endMin int
+			endHour, endMin, err = parseClock(cell(row, fieldEnd))
+			duration = endHour*60 + endMin - (hour*60 + min)
+			if duration <= 0 {
+				duration += 24 * 60
+			}
+		}
+		if err != nil {
+			errorString += fmt.Sprintf("row %d: %v\n", line, err)
+			continue
+		}
+		if duration <= 0 {
+			errorString += fmt.Sprintf("row %d: empty duration\n", line)
+			continue
+		}
+
+		meta := []config.SetMeta{}
+		for index, key := range links {
+			if index < len(row) && strings.TrimSpace(row[index]) != "" {
+				meta = append(meta, config.SetMeta{Key: key, Value: strings.TrimSpace(row[index])})
+			}
+		}
+		sort.Slice(meta, func(a, b int) bool { return meta[a].Key < meta[b].Key })
+
+		lineup.Sets[room] = append(lineup.Sets[room], config.Set{
+			Day:      day,
+			Hour:     hour,
+			Minute:   min,
+			Duration: duration,
+			Dj:       dj,
+			Meta:     meta,
+		})
+	}
+	if errorString != "" {
+		return lineup, errors.New(errorString)
+	}
+
+	for room := range lineup.Sets {
+		sets := lineup.Sets[room]
+		sort.Slice(sets, func(a, b int) bool {
+			if sets[a].Day != sets[b].Day {
+				return sets[a].Day < sets[b].Day
+			}
+			return sets[a].Hour*60+sets[a].Minute < sets[b].Hour*60+sets[b].Minute
+		})
+	}
+	return lineup, nil
+}
+
+// ToYaml returns the lineup section of a config file
+func ToYaml(lineup config.Lineup) (string, error) {
+	out, err := yaml.Marshal(struct {
+		Lineup config.Lineup `yaml:"lineup"`
+	}{lineup})
+	return string(out), err
+}
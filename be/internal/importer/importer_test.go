@@ -0,0 +1,120 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var rooms = []string{"🔨 Hammahalle", "🌲 Freaky Forest"}
+
+func newTestImporter(mapping map[string]string) *Importer {
+	beginning := time.Date(2024, 8, 16, 0, 0, 0, 0, time.UTC) // a Friday
+	return New(rooms, beginning, mapping)
+}
+
+func TestImportCSV(t *testing.T) {
+	rows := [][]string{
+		{"Stage", "Date", "Start", "End", "Artist", "Soundcloud"},
+		{"hammahalle", "2024-08-17", "23:00", "01:30", "Dj B", "https://soundcloud.com/b"},
+		{"Hammahalle", "2024-08-16", "22.00", "2300", "Dj A", ""},
+		{"Freaky Forest", "2024-08-18", "14:00", "16:00", "Dj C", ""},
+		{"", "", "", "", "", ""},
+	}
+	mapping, err := ParseMapping("Soundcloud=link")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	lineup, err := newTestImporter(mapping).Import(rows)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	sets := lineup.Sets["🔨 Hammahalle"]
+	if len(sets) != 2 {
+		t.Fatalf("expected 2 sets in Hammahalle, got %v", lineup.Sets)
+	}
+	if sets[0].Dj != "Dj A" || sets[0].Day != 0 || sets[0].Hour != 22 || sets[0].Duration != 60 {
+		t.Errorf("unexpected first set %+v", sets[0])
+	}
+	if sets[1].Dj != "Dj B" || sets[1].Day != 1 || sets[1].Duration != 150 {
+		t.Errorf("unexpected second set %+v", sets[1])
+	}
+	if len(sets[1].Meta) != 1 || sets[1].Meta[0].Key != "soundcloud" || sets[1].Meta[0].Value != "https://soundcloud.com/b" {
+		t.Errorf("unexpected meta %+v", sets[1].Meta)
+	}
+	if forest := lineup.Sets["🌲 Freaky Forest"]; len(forest) != 1 || forest[0].Day != 2 {
+		t.Errorf("unexpected Freaky Forest sets %+v", forest)
+	}
+
+	out, err := ToYaml(lineup)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.HasPrefix(out, "lineup:\n") || !strings.Contains(out, "dj: Dj B") {
+		t.Errorf("unexpected yaml %v", out)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	rows := [][]string{
+		{"room", "day", "start", "duration", "dj"},
+		{"Berghain", "Fri", "22:00", "60", "Dj A"},
+		{"Hammahalle", "Sat", "25:00", "60", "Dj B"},
+		{"Hammahalle", "Sun", "22:00", "60", ""},
+		{"Hammahalle", "Sat", "22:00", "1h30", "Dj D"},
+	}
+	_, err := newTestImporter(nil).Import(rows)
+	if err == nil {
+		t.Fatalf("expected errors")
+	}
+	for _, expected := range []string{"row 2: unknown room <Berghain>", "row 3: invalid time", "row 4: missing dj"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected <%v> in %v", expected, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), "row 5") {
+		t.Errorf("row 5 is valid: %v", err.Error())
+	}
+
+	_, err = newTestImporter(nil).Import([][]string{{"room", "dj", "duration"}, {"Hammahalle", "Dj", "60"}})
+	if err == nil || !strings.Contains(err.Error(), "missing column for <start>") {
+		t.Errorf("expected missing start column, got %v", err)
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]string{
+		"xl/sharedStrings.xml": `<sst><si><t>room</t></si><si><t>dj</t></si><si><r><t>Hamma</t></r><r><t>halle</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><t>date</t></is></c><c r="C1" t="inlineStr"><is><t>start</t></is></c><c r="D1" t="inlineStr"><is><t>duration</t></is></c><c r="E1" t="s"><v>1</v></c></row>
+<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2" s="1"><v>45521</v></c><c r="C2" s="2"><v>0.9375</v></c><c r="D2"><v>90</v></c><c r="E2" t="inlineStr"><is><t>Dj X</t></is></c></row>
+</sheetData></worksheet>`,
+	}
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+
+	rows, err := readXLSX(buf.Bytes())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(rows) != 2 || rows[1][0] != "Hammahalle" || rows[1][1] != "2024-08-17" || rows[1][2] != "22:30" || rows[1][3] != "90" {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	lineup, err := newTestImporter(nil).Import(rows)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if sets := lineup.Sets["🔨 Hammahalle"]; len(sets) != 1 || sets[0].Day != 1 || sets[0].Hour != 22 || sets[0].Minute != 30 {
+		t.Errorf("unexpected sets %+v", lineup.Sets)
+	}
+}
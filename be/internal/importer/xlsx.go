@@ -0,0 +1,188 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minimal reader of the first sheet of a xlsx file (Office Open XML), enough for timetables exports
+
+type xlsxSharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref       string `xml:"r,attr"`
+			Type      string `xml:"t,attr"`
+			Style     string `xml:"s,attr"`
+			Value     string `xml:"v"`
+			InlineStr string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+type xlsxWorkbookRels struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+func readZipFile(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, errors.New("xlsx: missing " + name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// firstSheetPath returns the path of the first sheet of the workbook
+func firstSheetPath(files map[string]*zip.File) string {
+	res := "xl/worksheets/sheet1.xml"
+	data, err := readZipFile(files, "xl/workbook.xml")
+	if err != nil {
+		return res
+	}
+	var wb xlsxWorkbook
+	if xml.Unmarshal(data, &wb) != nil || len(wb.Sheets) == 0 {
+		return res
+	}
+	data, err = readZipFile(files, "xl/_rels/workbook.xml.rels")
+	if err != nil {
+		return res
+	}
+	var rels xlsxWorkbookRels
+	if xml.Unmarshal(data, &rels) != nil {
+		return res
+	}
+	for _, v := range rels.Relationships {
+		if v.ID == wb.Sheets[0].RID {
+			return "xl/" + strings.TrimPrefix(strings.TrimPrefix(v.Target, "/xl/"), "/")
+		}
+	}
+	return res
+}
+
+// columnIndex returns the index of the column of a cell reference ("C12" -> 2)
+func columnIndex(ref string) int {
+	res := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		res = res*26 + int(r-'A'+1)
+	}
+	return res - 1
+}
+
+// excelSerialTime converts an excel serial date (days since 1899-12-30, fraction for the time)
+func excelSerialTime(value float64) time.Time {
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return base.Add(time.Duration(value * 24 * float64(time.Hour)).Round(time.Minute))
+}
+
+// readXLSX returns the rows of the first sheet, numeric cells looking like dates or times
+// are converted to "2006-01-02 15:04" or "15:04"
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var shared xlsxSharedStrings
+	if d, err := readZipFile(files, "xl/sharedStrings.xml"); err == nil {
+		if err := xml.Unmarshal(d, &shared); err != nil {
+			return nil, err
+		}
+	}
+	sharedStrings := []string{}
+	for _, v := range shared.Items {
+		s := v.Text
+		for _, r := range v.Runs {
+			s += r.Text
+		}
+		sharedStrings = append(sharedStrings, s)
+	}
+
+	d, err := readZipFile(files, firstSheetPath(files))
+	if err != nil {
+		return nil, err
+	}
+	var sheet xlsxSheet
+	if err := xml.Unmarshal(d, &sheet); err != nil {
+		return nil, err
+	}
+
+	res := [][]string{}
+	for _, row := range sheet.Rows {
+		cells := []string{}
+		for i, c := range row.Cells {
+			index := i
+			if c.Ref != "" {
+				index = columnIndex(c.Ref)
+			}
+			for len(cells) <= index {
+				cells = append(cells, "")
+			}
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(sharedStrings) {
+					return nil, errors.New("xlsx: invalid shared string " + c.Ref)
+				}
+				cells[index] = sharedStrings[n]
+			case "inlineStr":
+				cells[index] = c.InlineStr
+			case "str", "b", "e":
+				cells[index] = c.Value
+			default:
+				cells[index] = c.Value
+				f, err := strconv.ParseFloat(c.Value, 64)
+				if err != nil || c.Style == "" || c.Style == "0" {
+					continue
+				}
+				// styled numeric cells are most of the time dates or times in timetables
+				if f < 1 {
+					cells[index] = excelSerialTime(f).Format("15:04")
+				} else if f > 20000 {
+					t := excelSerialTime(f)
+					if t.Hour() == 0 && t.Minute() == 0 && f == float64(int(f)) {
+						cells[index] = t.Format("2006-01-02")
+					} else {
+						cells[index] = t.Format("2006-01-02 15:04")
+					}
+				}
+			}
+		}
+		res = append(res, cells)
+	}
+	return res, nil
+}
@@ -0,0 +1,59 @@
+// Package clock gives the time to the lineups and the bot, a Fake clock makes the tests and
+// the replays of a festival deterministic
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct {
+	loc *time.Location
+}
+
+func (c realClock) Now() time.Time {
+	if c.loc == nil {
+		return time.Now()
+	}
+	return time.Now().In(c.loc)
+}
+
+// Real is the time of the system
+var Real Clock = realClock{}
+
+// In is the time of the system in loc (i.e. the timezone of a festival)
+func In(loc *time.Location) Clock {
+	return realClock{loc: loc}
+}
+
+// Fake only moves when Set or Add are called
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
+
+func (f *Fake) Add(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
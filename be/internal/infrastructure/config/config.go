@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -14,6 +16,17 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// values of secrets.storage
+const (
+	StorageRedis  = "redis"
+	StorageMemory = "memory"
+	StorageFile   = "file"
+	StorageSqlite = "sqlite"
+)
+
+// characters allowed by telegram in the secret token of a webhook
+var webhookSecretRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
 type Meta struct {
 	AboutBigIcon              string    `json:"aboutBigIcon" yaml:"aboutBigIcon"`
 	AboutShowPatreonIcon      bool      `json:"aboutShowPatreonIcon" yaml:"aboutShowPatreonIcon"`
@@ -48,7 +61,17 @@ type Config struct {
 	Modos                              []int    `yaml:"secrets.modos,omitempty"`
 	TelegramToken                      string   `yaml:"secrets.telegramToken,omitempty"`
 	ServerToken                        string   `yaml:"secrets.serverToken,omitempty"`
+	TelegramWebhookURL                 string   `yaml:"secrets.telegramWebhookUrl,omitempty"`
+	TelegramWebhookSecret              string   `yaml:"secrets.telegramWebhookSecret,omitempty"`
+	MatrixHomeserver                   string   `yaml:"secrets.matrixHomeserver,omitempty"`
+	MatrixUserID                       string   `yaml:"secrets.matrixUserId,omitempty"`
+	MatrixAccessToken                  string   `yaml:"secrets.matrixAccessToken,omitempty"`
 	MapImageDirectory                  string   `yaml:"secrets.mapImageDirectory,omitempty"`
+	Storage                            string   `yaml:"secrets.storage,omitempty"`
+	RedisAddress                       string   `yaml:"secrets.redisAddress,omitempty"`
+	DataDirectory                      string   `yaml:"secrets.dataDirectory,omitempty"`
+	WebPushSubject                     string   `yaml:"secrets.webPushSubject,omitempty"`
+	MetricsAddress                     string   `yaml:"secrets.metricsAddress,omitempty"`
 	NbDaysForInput                     int      `yaml:"nbDaysForInput"`
 	Buttons                            []string `yaml:"buttons"`
 	ReadSetsFromRedisOnRestart         bool     `yaml:"readSetsFromRedisOnRestart"`
@@ -57,10 +80,18 @@ type Config struct {
 	NowSkipClosed                      bool     `yaml:"nowSkipClosed"`
 	Port                               int      `yaml:"port"`
 	BeginningSchedule                  string   `yaml:"beginningSchedule"`
+	LikesNotificationMinutes           int      `yaml:"likesNotificationMinutes"`
+	ApiUrl                             string   `yaml:"apiUrl"`
 
 	Demo   bool   `yaml:"demo"`
 	Meta   Meta   `yaml:"meta"`
 	Lineup Lineup `yaml:"lineup"`
+
+	// location of meta.timeZone, the times of the festival are in it
+	Location *time.Location `yaml:"-"`
+
+	// sets keyed under a room missing from lineup.rooms, ignored by the lineup but reported by -check
+	UnknownRoomSets map[string][]Set `yaml:"-"`
 }
 
 type Set struct {
@@ -121,7 +152,50 @@ func New(fileName string, isConfigCheck bool) (*Config, error) {
 		c.Modos = v.GetIntSlice("secrets.modos")
 		c.Port = v.GetInt("secrets.port")
 		c.ServerToken = v.GetString("secrets.serverToken")
+		// telegram updates are long polled unless a webhook url is set
+		c.TelegramWebhookURL = v.GetString("secrets.telegramWebhookUrl")
+		c.TelegramWebhookSecret = v.GetString("secrets.telegramWebhookSecret")
+		if c.TelegramWebhookURL != "" {
+			if u, err := url.Parse(c.TelegramWebhookURL); err != nil || u.Scheme != "https" || u.Path == "" || u.Path == "/" {
+				errorString += "secrets.telegramWebhookUrl must be an https url with a path\n"
+			}
+			if !webhookSecretRegex.MatchString(c.TelegramWebhookSecret) {
+				errorString += "secrets.telegramWebhookSecret must be 1-256 characters A-Z, a-z, 0-9, _ or -\n"
+			}
+		}
+		c.MatrixHomeserver = strings.TrimSuffix(v.GetString("secrets.matrixHomeserver"), "/")
+		c.MatrixUserID = v.GetString("secrets.matrixUserId")
+		c.MatrixAccessToken = v.GetString("secrets.matrixAccessToken")
+		if c.MatrixHomeserver != "" && c.MatrixAccessToken == "" {
+			errorString += "missing secrets.matrixAccessToken\n"
+		}
 		c.MapImageDirectory = v.GetString("secrets.mapImageDirectory")
+		// redis by default, memory, a json file per festival or a sqlite database without redis
+		c.Storage = v.GetString("secrets.storage")
+		if c.Storage == "" {
+			c.Storage = StorageRedis
+		}
+		c.RedisAddress = v.GetString("secrets.redisAddress")
+		if c.RedisAddress == "" {
+			c.RedisAddress = "localhost:6379"
+		}
+		c.DataDirectory = v.GetString("secrets.dataDirectory")
+		switch c.Storage {
+		case StorageRedis, StorageMemory:
+		case StorageFile, StorageSqlite:
+			if c.DataDirectory == "" {
+				errorString += fmt.Sprintf("missing secrets.dataDirectory for %v storage\n", c.Storage)
+			}
+		default:
+			errorString += fmt.Sprintf("secrets.storage must be %v, %v, %v or %v\n", StorageRedis, StorageMemory, StorageFile, StorageSqlite)
+		}
+		// web push notifications are sent when the admins can be contacted by the push services
+		c.WebPushSubject = v.GetString("secrets.webPushSubject")
+		if c.WebPushSubject != "" && !strings.HasPrefix(c.WebPushSubject, "mailto:") && !strings.HasPrefix(c.WebPushSubject, "https://") {
+			errorString += "secrets.webPushSubject must be a mailto: or https: url\n"
+		}
+		// /metrics is served on its own address (i.e. 127.0.0.1:9100) or with the server token
+		c.MetricsAddress = v.GetString("secrets.metricsAddress")
 		c.CommandsHistoryLogFile = v.GetString("secrets.commandsHistoryLogFile")
 		c.LogFile = v.GetString("secrets.logFile")
 		c.Demo = v.GetBool("secrets.demo")
@@ -178,12 +252,20 @@ func New(fileName string, isConfigCheck bool) (*Config, error) {
 			errorString += fmt.Sprintf("Error unmarshalling lineup: %v\n", err)
 		}
 
+		c.UnknownRoomSets = make(map[string][]Set)
+		known := make(map[string]bool)
 		for _, room := range lineup.Rooms {
+			known[strings.ToLower(room)] = true
 			sets, ok := lineup.Sets[strings.ToLower(room)]
 			if ok {
 				c.Lineup.Sets[room] = sets
 			}
 		}
+		for room, sets := range lineup.Sets {
+			if !known[room] {
+				c.UnknownRoomSets[room] = sets
+			}
+		}
 		if len(lineup.Rooms) == 0 {
 			errorString += "missing rooms\n"
 		}
@@ -197,6 +279,13 @@ func New(fileName string, isConfigCheck bool) (*Config, error) {
 		errorString += "Missing nbDaysForInput\n"
 	}
 
+	c.LikesNotificationMinutes = v.GetInt("likesNotificationMinutes")
+	if !v.IsSet("likesNotificationMinutes") {
+		c.LikesNotificationMinutes = 15
+	}
+
+	c.ApiUrl = strings.TrimSuffix(v.GetString("apiUrl"), "/")
+
 	c.BotOldLineupMessage = v.GetString("botOldLineupMessage")
 	c.NowSkipClosed = v.GetBool("nowSkipClosed")
 
@@ -211,11 +300,11 @@ func New(fileName string, isConfigCheck bool) (*Config, error) {
 	loc, err := time.LoadLocation(c.Meta.TimeZone)
 	if err != nil {
 		errorString += err.Error()
-	} else {
-		time.Local = loc // -> this is setting the global timezone
+		loc = time.UTC
 	}
+	c.Location = loc
 
-	beginningSchedule, err := dateparse.ParseLocal(v.GetString("beginningSchedule"))
+	beginningSchedule, err := dateparse.ParseIn(v.GetString("beginningSchedule"), loc)
 	if err != nil {
 		if !c.Demo {
 			errorString += "Error on beginningSchedule\n" + err.Error()
@@ -225,19 +314,14 @@ func New(fileName string, isConfigCheck bool) (*Config, error) {
 	}
 
 	if c.Demo {
-		now := time.Now().AddDate(0, 0, -1)
+		now := time.Now().In(loc).AddDate(0, 0, -1)
 		c.Lineup.BeginningSchedule = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 		log.Warn().Msg(fmt.Sprintf("demo mode, forcing BeginningSchedule to %v", c.Lineup.BeginningSchedule))
 	}
 
 	c.Meta.BeginningSchedule = c.Lineup.BeginningSchedule
 
-	cetLocation, err := time.LoadLocation(c.Meta.TimeZone)
-	if err != nil {
-		errorString += err.Error()
-	}
-	cetTime := c.Lineup.BeginningSchedule.In(cetLocation)
-	c.BeginningSchedule = cetTime.Format(time.RFC3339)
+	c.BeginningSchedule = c.Lineup.BeginningSchedule.In(loc).Format(time.RFC3339)
 
 	if errorString != "" {
 		return nil, errors.New(errorString)
@@ -0,0 +1,234 @@
+// Package metrics exposes counters, histograms and gauges in the prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the buckets of the durations in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric is written by the handler
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	mu      sync.Mutex
+	metrics = map[string]metric{}
+)
+
+func register(m metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := metrics[m.name()]; ok {
+		panic("metric registered twice: " + m.name())
+	}
+	metrics[m.name()] = m
+}
+
+// desc is the name, help and label names of a metric
+type desc struct {
+	n      string
+	help   string
+	labels []string
+}
+
+func (d desc) name() string {
+	return d.n
+}
+
+func (d desc) header(w io.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", d.n, strings.ReplaceAll(d.help, "\n", " "), d.n, kind)
+}
+
+// key identifies the values of the labels of a series
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("%v: %d label values for %d labels", d.n, len(values), len(d.labels)))
+	}
+	return strings.Join(values, "\x00")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// series returns name{label="value",...}, extra are added after the labels of the metric
+func (d desc) series(name, key string, extra ...string) string {
+	pairs := []string{}
+	if len(d.labels) != 0 {
+		for i, v := range strings.Split(key, "\x00") {
+			pairs = append(pairs, d.labels[i]+`="`+labelEscaper.Replace(v)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+extra[i+1]+`"`)
+	}
+	if len(pairs) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{n: name, help: help, labels: labels}, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	k := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[k] += v
+}
+
+// Value returns the value of a series
+func (c *Counter) Value(labelValues ...string) float64 {
+	k := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[k]
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w, "counter")
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%v %v\n", c.series(c.n, k), formatFloat(c.values[k]))
+	}
+}
+
+type histogramValue struct {
+	counts []uint64 // by bucket, not cumulated
+	sum    float64
+	count  uint64
+}
+
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{desc: desc{n: name, help: help, labels: labels}, buckets: buckets, values: make(map[string]*histogramValue)}
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	value, ok := h.values[k]
+	if !ok {
+		value = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = value
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			value.counts[i]++
+			break
+		}
+	}
+	value.sum += v
+	value.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, "histogram")
+	for _, k := range sortedKeys(h.values) {
+		value := h.values[k]
+		var cumulated uint64
+		for i, b := range h.buckets {
+			cumulated += value.counts[i]
+			fmt.Fprintf(w, "%v %d\n", h.series(h.n+"_bucket", k, "le", formatFloat(b)), cumulated)
+		}
+		fmt.Fprintf(w, "%v %d\n", h.series(h.n+"_bucket", k, "le", "+Inf"), value.count)
+		fmt.Fprintf(w, "%v %v\n", h.series(h.n+"_sum", k), formatFloat(value.sum))
+		fmt.Fprintf(w, "%v %d\n", h.series(h.n+"_count", k), value.count)
+	}
+}
+
+// GaugeFunc reads its values when the metrics are scraped
+type GaugeFunc struct {
+	desc
+	collect func(set func(value float64, labelValues ...string))
+}
+
+// NewGaugeFunc returns a gauge whose values are set by collect on each scrape
+func NewGaugeFunc(name, help string, collect func(set func(value float64, labelValues ...string)), labels ...string) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{n: name, help: help, labels: labels}, collect: collect}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	values := make(map[string]float64)
+	g.collect(func(value float64, labelValues ...string) {
+		values[g.key(labelValues)] = value
+	})
+	g.header(w, "gauge")
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(w, "%v %v\n", g.series(g.n, k), formatFloat(values[k]))
+	}
+}
+
+// Write writes every metric sorted by name
+func Write(w io.Writer) {
+	mu.Lock()
+	all := []metric{}
+	for _, k := range sortedKeys(metrics) {
+		all = append(all, metrics[k])
+	}
+	mu.Unlock()
+	for _, m := range all {
+		m.write(w)
+	}
+}
+
+// Handler serves the metrics to prometheus
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
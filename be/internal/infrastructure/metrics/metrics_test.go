@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	c := NewCounter("test_requests_total", "Requests.", "route", "status")
+	c.Inc("/api", "200")
+	c.Inc("/api", "200")
+	c.Inc(`/a"b`, "404")
+	h := NewHistogram("test_duration_seconds", "Durations.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/api")
+	h.Observe(0.5, "/api")
+	h.Observe(3, "/api")
+	NewGaugeFunc("test_users", "Users.", func(set func(float64, ...string)) {
+		set(3, "festival")
+	}, "prefix")
+
+	var b strings.Builder
+	Write(&b)
+	expected := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/api",le="0.1"} 1
+test_duration_seconds_bucket{route="/api",le="1"} 2
+test_duration_seconds_bucket{route="/api",le="+Inf"} 3
+test_duration_seconds_sum{route="/api"} 3.55
+test_duration_seconds_count{route="/api"} 3
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{route="/a\"b",status="404"} 1
+test_requests_total{route="/api",status="200"} 2
+# HELP test_users Users.
+# TYPE test_users gauge
+test_users{prefix="festival"} 3
+`
+	if b.String() != expected {
+		t.Fatalf("unexpected metrics:\n%v", b.String())
+	}
+}
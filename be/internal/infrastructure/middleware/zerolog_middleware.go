@@ -1,10 +1,17 @@
 package middleware
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
+	"github.com/shallowBunny/app/be/internal/infrastructure/metrics"
+)
+
+var (
+	requestsTotal   = metrics.NewCounter("shallowbunny_http_requests_total", "Rest api requests by route and status.", "method", "route", "status")
+	requestDuration = metrics.NewHistogram("shallowbunny_http_request_duration_seconds", "Rest api requests duration by route.", metrics.DefaultBuckets, "method", "route")
 )
 
 func ZerologMiddleware() gin.HandlerFunc {
@@ -18,6 +25,14 @@ func ZerologMiddleware() gin.HandlerFunc {
 		// Stop timer
 		duration := time.Since(startTime)
 
+		// the route pattern, not the path, keeps the number of series bounded
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		requestsTotal.Inc(c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+		requestDuration.Observe(duration.Seconds(), c.Request.Method, route)
+
 		// Log the request details
 		log.Info().
 			Str("method", c.Request.Method).
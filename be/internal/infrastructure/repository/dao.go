@@ -5,6 +5,8 @@ import "time"
 type Dao interface {
 	Save(key string, startTime time.Time, users string) error
 	Get(key string, startTime time.Time) (string, error)
+	// SaveWithoutTtl is Save for the values that must not expire (i.e. the web push keys), read with Get
+	SaveWithoutTtl(key string, startTime time.Time, value string) error
 
 	SaveLogs(logs string) error
 	GetLogs() (string, error)
@@ -12,5 +14,7 @@ type Dao interface {
 	SaveBot(startTime time.Time, bot string) error
 	GetBot(startTime time.Time) (string, error)
 	DeleteBot(startTime time.Time) error
-	SaveHset24Hours(key string, ip string) (int64, error)
+	// the analytics are kept without ttl
+	SaveAnalytics(analytics string) error
+	GetAnalytics() (string, error)
 }
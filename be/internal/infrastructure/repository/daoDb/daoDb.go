@@ -21,6 +21,9 @@ type DaoDb struct {
 func (d DaoDb) Save(key string, startTime time.Time, users string) error {
 	return d.redisclient.Set(context.Background(), key+"-"+d.redisKey+"-"+startTime.Format("Mon-02-Jan-2006"), users, Ttl).Err()
 }
+func (d DaoDb) SaveWithoutTtl(key string, startTime time.Time, value string) error {
+	return d.redisclient.Set(context.Background(), key+"-"+d.redisKey+"-"+startTime.Format("Mon-02-Jan-2006"), value, 0).Err()
+}
 func (d DaoDb) Get(key string, startTime time.Time) (string, error) {
 	return d.redisclient.Get(context.Background(), key+"-"+d.redisKey+"-"+startTime.Format("Mon-02-Jan-2006")).Result()
 }
@@ -74,12 +77,25 @@ func (d DaoDb) GetLogs() (string, error) {
 	return d.redisclient.Get(context.Background(), "logs-"+d.redisKey).Result()
 }
 
-func New(apiToken string, redisclient *redis.Client) *DaoDb {
+// SaveAnalytics saves without ttl, the analytics outlive the festival
+func (d DaoDb) SaveAnalytics(analytics string) error {
+	return d.redisclient.Set(context.Background(), "analytics-"+d.redisKey, analytics, 0).Err()
+}
+func (d DaoDb) GetAnalytics() (string, error) {
+	return d.redisclient.Get(context.Background(), "analytics-"+d.redisKey).Result()
+}
+
+// Key returns the namespace of the keys of a bot
+func Key(apiToken string) string {
 	h := sha256.New()
 	h.Write([]byte(apiToken))
 	bs := h.Sum(nil)
+	return fmt.Sprintf("%x", bs)
+}
+
+func New(apiToken string, redisclient *redis.Client) *DaoDb {
 	res := &DaoDb{
-		redisKey:    fmt.Sprintf("%x", bs),
+		redisKey:    Key(apiToken),
 		redisclient: redisclient,
 	}
 	return res
@@ -88,46 +104,3 @@ func New(apiToken string, redisclient *redis.Client) *DaoDb {
 func (d DaoDb) GetKey() string {
 	return d.redisKey
 }
-
-func (d DaoDb) SaveHset24Hours(key, ip string) (int64, error) {
-	ctx := context.Background()
-	timestamp := time.Now().Unix()
-
-	// Start a transaction
-	pipeline := d.redisclient.TxPipeline()
-
-	// Add or update the IP timestamp
-	pipeline.HSet(ctx, key, ip, timestamp)
-
-	// Get all IPs and timestamps
-	entries, err := d.redisclient.HGetAll(ctx, key).Result()
-	if err != nil {
-		return 0, err
-	}
-
-	// Remove outdated entries (older than 24 hours)
-	threshold := timestamp - 24*3600
-	for storedIP, storedTimeStr := range entries {
-		storedTime, err := strconv.ParseInt(storedTimeStr, 10, 64)
-		if err != nil {
-			continue // Skip invalid entries
-		}
-		if storedTime < threshold {
-			pipeline.HDel(ctx, key, storedIP)
-		}
-	}
-
-	// Execute pipeline
-	_, err = pipeline.Exec(ctx)
-	if err != nil {
-		return 0, err
-	}
-
-	// Get the updated count of elements
-	count, err := d.redisclient.HLen(ctx, key).Result()
-	if err != nil {
-		return 0, err
-	}
-
-	return count, nil
-}
@@ -1,55 +1,247 @@
 package DaoMem
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
+// same lifetime as the redis keys
+var Ttl = 2 * 7 * 24 * time.Hour
+
+var SnapshotInterval = 10 * time.Second
+
+// a missing key returns the same error as redis, the callers check it
+var errNil = errors.New("redis: nil")
+
+type entry struct {
+	Value   string
+	Expires time.Time // zero for the keys without ttl
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+// snapshot is the content of the file
+type snapshot struct {
+	Keys map[string]entry
+}
+
+// DaoMem keeps everything in memory, and in a json file written every SnapshotInterval when
+// created by NewFile
 type DaoMem struct {
+	mu    sync.Mutex
+	keys  map[string]entry
+	file  string
+	dirty bool
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+func dayKey(key string, startTime time.Time) string {
+	return key + "-" + startTime.Format("Mon-02-Jan-2006")
+}
+
+func (d *DaoMem) set(key, value string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys[key] = entry{Value: value, Expires: time.Now().Add(Ttl)}
+	d.dirty = true
+}
+
+func (d *DaoMem) get(key string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.keys[key]
+	if !ok {
+		return "", errNil
+	}
+	if e.expired(time.Now()) {
+		delete(d.keys, key)
+		d.dirty = true
+		return "", errNil
+	}
+	return e.Value, nil
 }
 
-func (d DaoMem) Save(key string, startTime time.Time, users string) error {
+func (d *DaoMem) Save(key string, startTime time.Time, users string) error {
+	d.set(dayKey(key, startTime), users)
+	return nil
+}
+func (d *DaoMem) SaveWithoutTtl(key string, startTime time.Time, value string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys[dayKey(key, startTime)] = entry{Value: value}
+	d.dirty = true
 	return nil
 }
-func (d DaoMem) Get(key string, startTime time.Time) (string, error) {
-	return "", errors.New("memory")
+func (d *DaoMem) Get(key string, startTime time.Time) (string, error) {
+	return d.get(dayKey(key, startTime))
 }
 
-func (d DaoMem) SaveBot(startTime time.Time, bot string) error {
+func (d *DaoMem) SaveBot(startTime time.Time, bot string) error {
+	d.set(dayKey("bot", startTime), bot)
 	return nil
 }
-func (d DaoMem) GetBot(startTime time.Time) (string, error) {
-	return "", errors.New("memory")
+func (d *DaoMem) GetBot(startTime time.Time) (string, error) {
+	return d.get(dayKey("bot", startTime))
 }
-func (d DaoMem) DeleteBot(startTime time.Time) error {
+func (d *DaoMem) DeleteBot(startTime time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.keys, dayKey("bot", startTime))
+	d.dirty = true
 	return nil
 }
 
-func (d DaoMem) SaveUsers(usersId []int64) error {
+func (d *DaoMem) SaveUsers(usersId []int64) error {
+	res := []string{}
+	for _, v := range usersId {
+		res = append(res, strconv.FormatInt(v, 10))
+	}
+	d.set("users", strings.Join(res, " "))
 	return nil
 }
 
-func (d DaoMem) GetUsers() ([]int64, error) {
+func (d *DaoMem) GetUsers() ([]int64, error) {
 	res := []int64{}
+	val, err := d.get("users")
+	if err != nil {
+		return res, err
+	}
+	for _, v := range strings.Fields(val) {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, i)
+	}
 	return res, nil
 }
 
-func (d DaoMem) SaveLogs(logs string) error {
+func (d *DaoMem) SaveLogs(logs string) error {
+	d.set("logs", logs)
+	return nil
+}
+func (d *DaoMem) GetLogs() (string, error) {
+	val, err := d.get("logs")
+	if err == errNil {
+		return "", nil
+	}
+	return val, err
+}
+
+// SaveAnalytics saves without ttl, the analytics outlive the festival
+func (d *DaoMem) SaveAnalytics(analytics string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys["analytics"] = entry{Value: analytics}
+	d.dirty = true
 	return nil
 }
-func (d DaoMem) GetLogs() (string, error) {
-	return "", nil
+func (d *DaoMem) GetAnalytics() (string, error) {
+	return d.get("analytics")
 }
 
 func New() *DaoMem {
-	return &DaoMem{}
+	return &DaoMem{
+		keys: make(map[string]entry),
+	}
+}
 
+// NewFile loads file if it exists and writes it every SnapshotInterval until Close
+func NewFile(file string) (*DaoMem, error) {
+	d := New()
+	d.file = file
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err == nil {
+		var s snapshot
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("%v: %w", file, err)
+		}
+		if s.Keys != nil {
+			d.keys = s.Keys
+		}
+		log.Info().Msg(fmt.Sprintf("loaded %d keys from %v", len(d.keys), file))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	d.quit = make(chan struct{})
+	d.done = make(chan struct{})
+	go d.snapshotLoop()
+	return d, nil
 }
 
-func (d DaoMem) GetKey() string {
-	return "memory"
+func (d *DaoMem) snapshotLoop() {
+	defer close(d.done)
+	ticker := time.NewTicker(SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.Snapshot(); err != nil {
+				log.Error().Msg(err.Error())
+			}
+		case <-d.quit:
+			return
+		}
+	}
+}
+
+// Snapshot writes the file if something changed, the expired keys are dropped
+func (d *DaoMem) Snapshot() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.file == "" || !d.dirty {
+		return nil
+	}
+	now := time.Now()
+	for k, v := range d.keys {
+		if v.expired(now) {
+			delete(d.keys, k)
+		}
+	}
+	data, err := json.Marshal(snapshot{Keys: d.keys})
+	if err != nil {
+		return err
+	}
+	// a crash while writing keeps the previous file
+	tmp := d.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, d.file); err != nil {
+		return err
+	}
+	d.dirty = false
+	return nil
 }
 
-func (d DaoMem) SaveHset24Hours(key, ip string) (int64, error) {
-	return 0, nil
+// Close stops the snapshots and writes the last one
+func (d *DaoMem) Close() error {
+	if d.quit != nil {
+		close(d.quit)
+		<-d.done
+		d.quit = nil
+	}
+	return d.Snapshot()
+}
+
+func (d *DaoMem) GetKey() string {
+	if d.file != "" {
+		return d.file
+	}
+	return "memory"
 }
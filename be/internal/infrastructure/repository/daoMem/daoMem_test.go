@@ -0,0 +1,57 @@
+package DaoMem
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "festival", "test.json")
+	startTime := time.Date(2024, 8, 15, 0, 0, 0, 0, time.UTC)
+
+	d, err := NewFile(file)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := d.GetBot(startTime); err == nil || err.Error() != "redis: nil" {
+		t.Fatalf("expected a missing key, got %v", err)
+	}
+	d.SaveBot(startTime, "bot")
+	d.Save("users", startTime, "1 2")
+	d.Save("expired", startTime, "old")
+	d.keys[dayKey("expired", startTime)] = entry{Value: "old", Expires: time.Now().Add(-time.Second)}
+	d.SaveWithoutTtl("keys", startTime, "vapid")
+	if e := d.keys[dayKey("keys", startTime)]; !e.Expires.IsZero() {
+		t.Fatalf("expected the keys without ttl, got %v", e.Expires)
+	}
+	d.SaveAnalytics("analytics")
+	if err := d.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	d, err = NewFile(file)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer d.Close()
+	if v, err := d.GetBot(startTime); err != nil || v != "bot" {
+		t.Fatalf("expected the bot after reload, got %v %v", v, err)
+	}
+	if v, err := d.Get("users", startTime); err != nil || v != "1 2" {
+		t.Fatalf("expected the users after reload, got %v %v", v, err)
+	}
+	if _, err := d.Get("expired", startTime); err == nil {
+		t.Fatalf("expected the expired key to be dropped")
+	}
+	if v, err := d.Get("keys", startTime); err != nil || v != "vapid" {
+		t.Fatalf("expected the keys without ttl after reload, got %v %v", v, err)
+	}
+	if v, err := d.GetAnalytics(); err != nil || v != "analytics" {
+		t.Fatalf("expected the analytics without ttl after reload, got %v %v", v, err)
+	}
+	d.DeleteBot(startTime)
+	if _, err := d.GetBot(startTime); err == nil {
+		t.Fatalf("expected the bot to be deleted")
+	}
+}
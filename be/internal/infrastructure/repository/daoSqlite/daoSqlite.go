@@ -0,0 +1,469 @@
+package DaoSqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
+	DaoDb "github.com/shallowBunny/app/be/internal/infrastructure/repository/daoDb"
+)
+
+const (
+	dayFormat = "2006-01-02"
+	// the root lineup is saved when a merge request is accepted, only the last snapshots are kept
+	maxSnapshots = 200
+	usersKey     = "users" // every user, saved by the previous versions
+	userPrefix   = "user-"
+	mergeKey     = "mergeRequests"
+	mergePrefix  = "mergeRequest-"
+	logsKey      = "logs"
+	analyticsKey = "analytics"
+)
+
+// a missing key returns the same error as redis, the callers check it
+var errNil = errors.New("redis: nil")
+
+// migrations are applied in order, PRAGMA user_version is the number of migrations applied
+var migrations = []string{
+	`CREATE TABLE kv (
+		namespace TEXT NOT NULL,
+		key TEXT NOT NULL,
+		day TEXT NOT NULL,
+		value TEXT NOT NULL,
+		updated INTEGER NOT NULL,
+		PRIMARY KEY (namespace, key, day)
+	);
+	CREATE TABLE users (
+		namespace TEXT NOT NULL,
+		day TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		notifications INTEGER NOT NULL,
+		deleted INTEGER NOT NULL,
+		liked_djs TEXT NOT NULL,
+		data TEXT NOT NULL,
+		created INTEGER NOT NULL,
+		updated INTEGER NOT NULL,
+		PRIMARY KEY (namespace, day, user_id)
+	);
+	CREATE TABLE merge_requests (
+		namespace TEXT NOT NULL,
+		day TEXT NOT NULL,
+		id INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		user TEXT NOT NULL,
+		created TEXT NOT NULL,
+		decided_by TEXT NOT NULL,
+		decided TEXT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (namespace, day, id)
+	);
+	CREATE TABLE lineup_snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		namespace TEXT NOT NULL,
+		day TEXT NOT NULL,
+		created INTEGER NOT NULL,
+		deleted INTEGER NOT NULL DEFAULT 0,
+		data TEXT NOT NULL
+	);
+	CREATE INDEX lineup_snapshots_day ON lineup_snapshots (namespace, day, id);
+	CREATE TABLE logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		namespace TEXT NOT NULL,
+		created INTEGER NOT NULL,
+		line TEXT NOT NULL
+	);
+	CREATE INDEX logs_namespace ON logs (namespace, id);
+	CREATE TABLE stats_days (
+		namespace TEXT NOT NULL,
+		day TEXT NOT NULL,
+		channel TEXT NOT NULL,
+		uniques INTEGER NOT NULL,
+		new_users INTEGER NOT NULL,
+		returning_users INTEGER NOT NULL,
+		PRIMARY KEY (namespace, day, channel)
+	);
+	CREATE TABLE stats_hours (
+		namespace TEXT NOT NULL,
+		day TEXT NOT NULL,
+		channel TEXT NOT NULL,
+		hour INTEGER NOT NULL,
+		users INTEGER NOT NULL,
+		PRIMARY KEY (namespace, day, channel, hour)
+	);
+	CREATE TABLE stats_counts (
+		namespace TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		name TEXT NOT NULL,
+		count INTEGER NOT NULL,
+		PRIMARY KEY (namespace, kind, name)
+	);`,
+}
+
+// DaoSqlite stores the keys of a bot in a sqlite database shared by the festivals. The users, the
+// merge requests, the lineup snapshots, the logs and the analytics also go to tables kept without
+// ttl to be queried.
+type DaoSqlite struct {
+	db        *sql.DB
+	namespace string
+}
+
+// Open opens or creates the database and applies the missing migrations
+func Open(file string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+file+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	// one writer at a time, sqlite would answer "database is locked"
+	db.SetMaxOpenConns(1)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+	return db, nil
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database version %d is newer than this binary (%d)", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Info().Msg(fmt.Sprintf("sqlite migration %d applied", i+1))
+	}
+	return nil
+}
+
+// New uses the same namespace as DaoDb.New, so a redis namespace can be copied with MigrateRedis
+func New(apiToken string, db *sql.DB) *DaoSqlite {
+	return &DaoSqlite{
+		db:        db,
+		namespace: DaoDb.Key(apiToken),
+	}
+}
+
+func day(startTime time.Time) string {
+	return startTime.Format(dayFormat)
+}
+
+func (d *DaoSqlite) get(key, day string) (string, error) {
+	var value string
+	err := d.db.QueryRow("SELECT value FROM kv WHERE namespace = ? AND key = ? AND day = ?", d.namespace, key, day).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", errNil
+	}
+	return value, err
+}
+
+func setKv(tx *sql.Tx, namespace, key, day, value string) error {
+	_, err := tx.Exec(`INSERT INTO kv (namespace, key, day, value, updated) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (namespace, key, day) DO UPDATE SET value = excluded.value, updated = excluded.updated`,
+		namespace, key, day, value, time.Now().Unix())
+	return err
+}
+
+// inTx runs f in a transaction
+func (d *DaoSqlite) inTx(f func(tx *sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DaoSqlite) Save(key string, startTime time.Time, users string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		if err := setKv(tx, d.namespace, key, day(startTime), users); err != nil {
+			return err
+		}
+		switch {
+		case key == usersKey:
+			return d.saveUsers(tx, day(startTime), users)
+		case strings.HasPrefix(key, userPrefix):
+			id, err := strconv.ParseInt(strings.TrimPrefix(key, userPrefix), 10, 64)
+			if err != nil {
+				return nil
+			}
+			return d.saveUser(tx, day(startTime), id, json.RawMessage(users))
+		case key == mergeKey:
+			return d.saveMergeRequests(tx, day(startTime), users)
+		case strings.HasPrefix(key, mergePrefix):
+			return d.saveMergeRequest(tx, day(startTime), json.RawMessage(users))
+		}
+		return nil
+	})
+}
+
+// SaveWithoutTtl is Save, nothing expires in sqlite
+func (d *DaoSqlite) SaveWithoutTtl(key string, startTime time.Time, value string) error {
+	return d.Save(key, startTime, value)
+}
+func (d *DaoSqlite) Get(key string, startTime time.Time) (string, error) {
+	return d.get(key, day(startTime))
+}
+
+// user is the part of users.UserInfo put in columns, the whole of it is in data
+type user struct {
+	Notifications bool
+	Deleted       bool
+	LikedDjs      []string
+}
+
+// saveUsers upserts the users saved in one value by the previous versions
+func (d *DaoSqlite) saveUsers(tx *sql.Tx, day, value string) error {
+	users := make(map[int64]json.RawMessage)
+	if err := json.Unmarshal([]byte(value), &users); err != nil {
+		return err
+	}
+	for id, data := range users {
+		if err := d.saveUser(tx, day, id, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DaoSqlite) saveUser(tx *sql.Tx, day string, id int64, data json.RawMessage) error {
+	var u user
+	if err := json.Unmarshal(data, &u); err != nil {
+		return err
+	}
+	likedDjs, err := json.Marshal(u.LikedDjs)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	_, err = tx.Exec(`INSERT INTO users (namespace, day, user_id, notifications, deleted, liked_djs, data, created, updated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (namespace, day, user_id) DO UPDATE SET notifications = excluded.notifications,
+		deleted = excluded.deleted, liked_djs = excluded.liked_djs, data = excluded.data, updated = excluded.updated
+		WHERE data != excluded.data`,
+		d.namespace, day, id, u.Notifications, u.Deleted, string(likedDjs), string(data), now, now)
+	return err
+}
+
+// mergeRequest is the part of mergeRequests.MergeRequest put in columns, the whole of it is in data
+type mergeRequest struct {
+	ID        int
+	Status    string
+	UserId    int64
+	User      string
+	Created   time.Time
+	DecidedBy string
+	Decided   time.Time
+}
+
+// saveMergeRequests upserts the merge requests saved in one value by the previous versions
+func (d *DaoSqlite) saveMergeRequests(tx *sql.Tx, day, value string) error {
+	var stored struct {
+		MergeRequests []json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return err
+	}
+	for _, data := range stored.MergeRequests {
+		if err := d.saveMergeRequest(tx, day, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DaoSqlite) saveMergeRequest(tx *sql.Tx, day string, data json.RawMessage) error {
+	var mr mergeRequest
+	if err := json.Unmarshal(data, &mr); err != nil {
+		return err
+	}
+	decided := ""
+	if !mr.Decided.IsZero() {
+		decided = mr.Decided.Format(time.RFC3339)
+	}
+	_, err := tx.Exec(`INSERT INTO merge_requests (namespace, day, id, status, user_id, user, created, decided_by, decided, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (namespace, day, id) DO UPDATE SET status = excluded.status, decided_by = excluded.decided_by,
+		decided = excluded.decided, data = excluded.data`,
+		d.namespace, day, mr.ID, mr.Status, mr.UserId, mr.User, mr.Created.Format(time.RFC3339), mr.DecidedBy, decided, string(data))
+	return err
+}
+
+// SaveBot adds a snapshot of the root lineup unless it didn't change
+func (d *DaoSqlite) SaveBot(startTime time.Time, bot string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		var last string
+		err := tx.QueryRow("SELECT data FROM lineup_snapshots WHERE namespace = ? AND day = ? AND deleted = 0 ORDER BY id DESC LIMIT 1",
+			d.namespace, day(startTime)).Scan(&last)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && last == bot {
+			return nil
+		}
+		if _, err := tx.Exec("INSERT INTO lineup_snapshots (namespace, day, created, data) VALUES (?, ?, ?, ?)",
+			d.namespace, day(startTime), time.Now().Unix(), bot); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM lineup_snapshots WHERE namespace = ? AND day = ? AND id <= (
+			SELECT id FROM lineup_snapshots WHERE namespace = ? AND day = ? ORDER BY id DESC LIMIT 1 OFFSET ?)`,
+			d.namespace, day(startTime), d.namespace, day(startTime), maxSnapshots)
+		return err
+	})
+}
+func (d *DaoSqlite) GetBot(startTime time.Time) (string, error) {
+	var data string
+	err := d.db.QueryRow("SELECT data FROM lineup_snapshots WHERE namespace = ? AND day = ? AND deleted = 0 ORDER BY id DESC LIMIT 1",
+		d.namespace, day(startTime)).Scan(&data)
+	if err == sql.ErrNoRows {
+		return "", errNil
+	}
+	return data, err
+}
+
+// DeleteBot keeps the snapshots, GetBot doesn't return them anymore
+func (d *DaoSqlite) DeleteBot(startTime time.Time) error {
+	_, err := d.db.Exec("UPDATE lineup_snapshots SET deleted = 1 WHERE namespace = ? AND day = ?", d.namespace, day(startTime))
+	return err
+}
+
+// newLines returns the lines added at the end of logs, the first ones being trimmed by the bot
+func newLines(previous, logs string) []string {
+	old := strings.Split(strings.TrimSuffix(previous, "\n"), "\n")
+	lines := strings.Split(strings.TrimSuffix(logs, "\n"), "\n")
+	if previous == "" {
+		old = []string{}
+	}
+	if logs == "" {
+		return []string{}
+	}
+	for k := min(len(old), len(lines)); k > 0; k-- {
+		match := true
+		for i := 0; i < k; i++ {
+			if old[len(old)-k+i] != lines[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return lines[k:]
+		}
+	}
+	return lines
+}
+
+// SaveLogs keeps the last logs in kv and appends the new lines to the logs table
+func (d *DaoSqlite) SaveLogs(logs string) error {
+	return d.inTx(func(tx *sql.Tx) error {
+		var previous string
+		err := tx.QueryRow("SELECT value FROM kv WHERE namespace = ? AND key = ? AND day = ''", d.namespace, logsKey).Scan(&previous)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		now := time.Now().Unix()
+		for _, line := range newLines(previous, logs) {
+			if _, err := tx.Exec("INSERT INTO logs (namespace, created, line) VALUES (?, ?, ?)", d.namespace, now, line); err != nil {
+				return err
+			}
+		}
+		return setKv(tx, d.namespace, logsKey, "", logs)
+	})
+}
+func (d *DaoSqlite) GetLogs() (string, error) {
+	return d.get(logsKey, "")
+}
+
+// analytics is the part of the analytics put in the stats tables, the whole of it is in kv
+type analytics struct {
+	Days map[string]map[string]struct {
+		Uniques   int
+		New       int
+		Returning int
+		Hours     [24]int
+	}
+	Djs      map[string]int
+	Rooms    map[string]int
+	Commands map[string]int
+}
+
+// SaveAnalytics keeps the analytics in kv, like the logs they don't depend on the start time.
+// The unique users by day and hour and the counts go to the stats tables.
+func (d *DaoSqlite) SaveAnalytics(value string) error {
+	var a analytics
+	if err := json.Unmarshal([]byte(value), &a); err != nil {
+		return err
+	}
+	return d.inTx(func(tx *sql.Tx) error {
+		for day, channels := range a.Days {
+			for channel, c := range channels {
+				_, err := tx.Exec(`INSERT INTO stats_days (namespace, day, channel, uniques, new_users, returning_users)
+					VALUES (?, ?, ?, ?, ?, ?)
+					ON CONFLICT (namespace, day, channel) DO UPDATE SET uniques = excluded.uniques,
+					new_users = excluded.new_users, returning_users = excluded.returning_users`,
+					d.namespace, day, channel, c.Uniques, c.New, c.Returning)
+				if err != nil {
+					return err
+				}
+				for hour, users := range c.Hours {
+					if users == 0 {
+						continue
+					}
+					_, err := tx.Exec(`INSERT INTO stats_hours (namespace, day, channel, hour, users) VALUES (?, ?, ?, ?, ?)
+						ON CONFLICT (namespace, day, channel, hour) DO UPDATE SET users = excluded.users`,
+						d.namespace, day, channel, hour, users)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		for kind, counts := range map[string]map[string]int{"dj": a.Djs, "room": a.Rooms, "command": a.Commands} {
+			for name, count := range counts {
+				_, err := tx.Exec(`INSERT INTO stats_counts (namespace, kind, name, count) VALUES (?, ?, ?, ?)
+					ON CONFLICT (namespace, kind, name) DO UPDATE SET count = excluded.count`,
+					d.namespace, kind, name, count)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return setKv(tx, d.namespace, analyticsKey, "", value)
+	})
+}
+func (d *DaoSqlite) GetAnalytics() (string, error) {
+	return d.get(analyticsKey, "")
+}
+
+func (d *DaoSqlite) GetKey() string {
+	return d.namespace
+}
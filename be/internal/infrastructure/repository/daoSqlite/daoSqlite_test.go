@@ -0,0 +1,155 @@
+package DaoSqlite
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func count(t *testing.T, d *DaoSqlite, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := d.db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return n
+}
+
+func TestDaoSqlite(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(file)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	d := New("token", db)
+	other := New("other", db)
+	startTime := time.Date(2024, 8, 15, 0, 0, 0, 0, time.Local)
+
+	if _, err := d.GetBot(startTime); err == nil || err.Error() != "redis: nil" {
+		t.Fatalf("expected a missing key, got %v", err)
+	}
+	for _, bot := range []string{"bot1", "bot1", "bot2"} {
+		if err := d.SaveBot(startTime, bot); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if v, _ := d.GetBot(startTime); v != "bot2" {
+		t.Fatalf("expected the last bot, got %v", v)
+	}
+	if n := count(t, d, "SELECT COUNT(*) FROM lineup_snapshots"); n != 2 {
+		t.Fatalf("expected 2 snapshots, got %v", n)
+	}
+	d.DeleteBot(startTime)
+	if _, err := d.GetBot(startTime); err == nil {
+		t.Fatalf("expected the bot to be deleted")
+	}
+
+	users := `{"1":{"Notifications":true,"Deleted":false,"LikedDjs":["DJ FART"]},"2":{"Notifications":false,"Deleted":true}}`
+	if err := d.Save("users", startTime, users); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if v, _ := d.Get("users", startTime); v != users {
+		t.Fatalf("unexpected users %v", v)
+	}
+	if _, err := other.Get("users", startTime); err == nil {
+		t.Fatalf("expected the namespaces to be separated")
+	}
+	if n := count(t, d, `SELECT COUNT(*) FROM users WHERE notifications = 1 AND liked_djs = '["DJ FART"]'`); n != 1 {
+		t.Fatalf("expected user 1 in the users table, got %v", n)
+	}
+
+	if err := d.Save("user-3", startTime, `{"Notifications":true,"Deleted":false}`); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := count(t, d, "SELECT COUNT(*) FROM users WHERE user_id = 3 AND notifications = 1"); n != 1 {
+		t.Fatalf("expected user 3 in the users table, got %v", n)
+	}
+
+	mergeRequests := `{"LastID":2,"MergeRequests":[{"ID":1,"Status":"accepted","UserId":1,"User":"test","DecidedBy":"modo"},{"ID":2,"Status":"pending","UserId":1,"User":"test"}]}`
+	if err := d.Save("mergeRequests", startTime, mergeRequests); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := count(t, d, "SELECT COUNT(*) FROM merge_requests WHERE status = 'accepted' AND decided_by = 'modo'"); n != 1 {
+		t.Fatalf("expected an accepted merge request, got %v", n)
+	}
+
+	if err := d.Save("mergeRequest-2", startTime, `{"ID":2,"Status":"refused","UserId":1,"User":"test","DecidedBy":"modo"}`); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := count(t, d, "SELECT COUNT(*) FROM merge_requests WHERE id = 2 AND status = 'refused'"); n != 1 {
+		t.Fatalf("expected a refused merge request, got %v", n)
+	}
+
+	d.SaveLogs("a\nb\n")
+	d.SaveLogs("b\nc\n")
+	if v, _ := d.GetLogs(); v != "b\nc\n" {
+		t.Fatalf("unexpected logs %v", v)
+	}
+	if n := count(t, d, "SELECT COUNT(*) FROM logs"); n != 3 {
+		t.Fatalf("expected the 3 lines in the logs table, got %v", n)
+	}
+
+	// the analytics are queryable, the last save wins
+	for _, users := range []int{1, 3} {
+		analytics := fmt.Sprintf(`{"Days":{"2024-08-16":{"api":{"uniques":%d,"new":2,"returning":1,"hours":[0,%d]}}},"Djs":{"Robyn":4},"Rooms":{"🍵":2},"Commands":{"now":%d}}`, users, users, users)
+		if err := d.SaveAnalytics(analytics); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if v, err := d.GetAnalytics(); err != nil || v != analytics {
+			t.Fatalf("expected the analytics, got %v %v", v, err)
+		}
+	}
+	for query, want := range map[string]int{
+		"SELECT uniques FROM stats_days WHERE day = '2024-08-16' AND channel = 'api' AND new_users = 2 AND returning_users = 1": 3,
+		"SELECT users FROM stats_hours WHERE day = '2024-08-16' AND channel = 'api' AND hour = 1":                               3,
+		"SELECT COUNT(*) FROM stats_hours":                                       1,
+		"SELECT count FROM stats_counts WHERE kind = 'dj' AND name = 'Robyn'":    4,
+		"SELECT count FROM stats_counts WHERE kind = 'command' AND name = 'now'": 3,
+	} {
+		if n := count(t, d, query); n != want {
+			t.Fatalf("%v: expected %v, got %v", query, want, n)
+		}
+	}
+	db.Close()
+
+	// the migrations are not applied twice
+	db, err = Open(file)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer db.Close()
+	if v, err := New("token", db).Get("users", startTime); err != nil || v != users {
+		t.Fatalf("expected the users after reopening, got %v %v", v, err)
+	}
+}
+
+func TestNewLines(t *testing.T) {
+	tests := []struct {
+		previous, logs string
+		expected       []string
+	}{
+		{"", "a\n", []string{"a"}},
+		{"a\nb\n", "a\nb\nc\n", []string{"c"}},
+		{"a\nb\n", "b\nc\nd\n", []string{"c", "d"}},
+		{"a\n", "x\n", []string{"x"}},
+		{"a\n", "", []string{}},
+	}
+	for _, test := range tests {
+		if res := newLines(test.previous, test.logs); !reflect.DeepEqual(res, test.expected) {
+			t.Errorf("newLines(%q, %q) = %v, expected %v", test.previous, test.logs, res, test.expected)
+		}
+	}
+}
+
+func TestSplitRedisKey(t *testing.T) {
+	namespace := "4f2a"
+	key, startTime, err := splitRedisKey("likes-test-abc-4f2a-Thu-15-Aug-2024", namespace)
+	if err != nil || key != "likes-test-abc" || day(startTime) != "2024-08-15" {
+		t.Fatalf("unexpected split %v %v %v", key, startTime, err)
+	}
+	if _, _, err := splitRedisKey("logs-4f2a", namespace); err == nil {
+		t.Fatalf("expected an error without day")
+	}
+}
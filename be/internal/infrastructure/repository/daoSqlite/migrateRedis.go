@@ -0,0 +1,75 @@
+package DaoSqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// same format as DaoDb
+const redisDayFormat = "Mon-02-Jan-2006"
+
+// splitRedisKey returns the key and the start time of a redis key "<key>-<namespace>-<day>"
+func splitRedisKey(redisKey, namespace string) (string, time.Time, error) {
+	i := strings.Index(redisKey, "-"+namespace+"-")
+	if i <= 0 {
+		return "", time.Time{}, fmt.Errorf("unexpected key %v", redisKey)
+	}
+	startTime, err := time.ParseInLocation(redisDayFormat, redisKey[i+len(namespace)+2:], time.Local)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return redisKey[:i], startTime, nil
+}
+
+// MigrateRedis copies the keys of the redis namespace of d (see DaoDb.New) into d, returns the
+// number of keys copied. It can be run again, the keys already copied are overwritten.
+func MigrateRedis(redisclient *redis.Client, d *DaoSqlite) (int, error) {
+	ctx := context.Background()
+	copied := 0
+	keys := []string{}
+	iter := redisclient.Scan(ctx, 0, "*"+d.namespace+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return copied, err
+	}
+	for _, k := range keys {
+		if k == "users-"+d.namespace {
+			// written by DaoDb.SaveUsers, not used anymore
+			log.Warn().Msg("skipping " + k)
+			continue
+		}
+		value, err := redisclient.Get(ctx, k).Result()
+		if err != nil {
+			return copied, fmt.Errorf("%v: %w", k, err)
+		}
+		if k == "logs-"+d.namespace {
+			err = d.SaveLogs(value)
+		} else if k == "analytics-"+d.namespace {
+			err = d.SaveAnalytics(value)
+		} else {
+			key, startTime, splitErr := splitRedisKey(k, d.namespace)
+			if splitErr != nil {
+				log.Warn().Msg(fmt.Sprintf("skipping %v: %v", k, splitErr))
+				continue
+			}
+			if key == "bot" {
+				err = d.SaveBot(startTime, value)
+			} else {
+				err = d.Save(key, startTime, value)
+			}
+		}
+		if err != nil {
+			return copied, fmt.Errorf("%v: %w", k, err)
+		}
+		copied++
+	}
+
+	return copied, nil
+}
@@ -0,0 +1,217 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/bot/lineUp"
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+
+	CheckConfig          = "config"
+	CheckEmptyDuration   = "emptyDuration"
+	CheckOverlap         = "overlap"
+	CheckGap             = "gap"
+	CheckUnknownRoom     = "unknownRoom"
+	CheckEmptyRoom       = "emptyRoom"
+	CheckDuplicateDj     = "duplicateDj"
+	CheckBeyondInputDays = "beyondInputDays"
+
+	// longer gaps are the room being closed between two nights
+	maxGap = 6 * time.Hour
+)
+
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Check    string   `json:"check"`
+	Room     string   `json:"room,omitempty"`
+	Day      *int     `json:"day,omitempty"`
+	Time     string   `json:"time,omitempty"`
+	Dj       string   `json:"dj,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (i Issue) String() string {
+	location := ""
+	if i.Room != "" {
+		location += " " + i.Room
+	}
+	if i.Day != nil {
+		location += fmt.Sprintf(" day %d", *i.Day)
+	}
+	if i.Time != "" {
+		location += " " + i.Time
+	}
+	return fmt.Sprintf("%v [%v]%v: %v", i.Severity, i.Check, location, i.Message)
+}
+
+type Report struct {
+	File   string  `json:"file"`
+	Issues []Issue `json:"issues"`
+}
+
+func (r Report) HasErrors() bool {
+	for _, v := range r.Issues {
+		if v.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Report) count(s Severity) int {
+	res := 0
+	for _, v := range r.Issues {
+		if v.Severity == s {
+			res++
+		}
+	}
+	return res
+}
+
+func (r Report) String() string {
+	res := fmt.Sprintf("%v: %d error(s), %d warning(s)\n", r.File, r.count(SeverityError), r.count(SeverityWarning))
+	for _, v := range r.Issues {
+		res += "  " + v.String() + "\n"
+	}
+	return res
+}
+
+// set of the config with its absolute times
+type set struct {
+	room  string
+	day   int
+	dj    string
+	start time.Time
+	end   time.Time
+}
+
+func (r *Report) add(severity Severity, check string, s *set, message string) {
+	issue := Issue{Severity: severity, Check: check, Message: message}
+	if s != nil {
+		day := s.day
+		issue.Room = s.room
+		issue.Day = &day
+		issue.Time = s.start.Format("Mon 15:04")
+		issue.Dj = s.dj
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// same computation as LineUp.NewSet
+func newSet(c *config.Config, room string, s config.Set) set {
+	t := c.Lineup.BeginningSchedule
+	start := time.Date(t.Year(), t.Month(), t.Day(), s.Hour, s.Minute, t.Second(), t.Nanosecond(), t.Location()).AddDate(0, 0, s.Day)
+	return set{
+		room:  room,
+		day:   s.Day,
+		dj:    s.Dj,
+		start: start,
+		end:   start.Add(time.Duration(s.Duration) * time.Minute),
+	}
+}
+
+// ConfigError returns the report of a config file config.New refused
+func ConfigError(file string, err error) Report {
+	r := Report{File: file, Issues: []Issue{}}
+	for _, v := range strings.Split(strings.TrimSpace(err.Error()), "\n") {
+		if v != "" {
+			r.add(SeverityError, CheckConfig, nil, v)
+		}
+	}
+	return r
+}
+
+// Check validates the lineup of a config, errors are what the lineup would silently drop or panic on
+func Check(file string, c *config.Config) Report {
+	r := Report{File: file, Issues: []Issue{}}
+
+	unknownRooms := []string{}
+	for room := range c.UnknownRoomSets {
+		unknownRooms = append(unknownRooms, room)
+	}
+	sort.Strings(unknownRooms)
+	for _, room := range unknownRooms {
+		r.Issues = append(r.Issues, Issue{
+			Severity: SeverityError,
+			Check:    CheckUnknownRoom,
+			Room:     room,
+			Message:  fmt.Sprintf("%d set(s) ignored, room <%v> is not in lineup.rooms (room names are case insensitive)", len(c.UnknownRoomSets[room]), room),
+		})
+	}
+
+	all := []set{}
+	for _, room := range c.Lineup.Rooms {
+		sets, ok := c.Lineup.Sets[room]
+		if !ok || len(sets) == 0 {
+			r.add(SeverityWarning, CheckEmptyRoom, nil, fmt.Sprintf("no set in room <%v>", room))
+			continue
+		}
+		roomSets := []set{}
+		for _, v := range sets {
+			s := newSet(c, room, v)
+			if v.Duration < 0 {
+				r.add(SeverityError, CheckEmptyDuration, &s, fmt.Sprintf("duration of %v is %d minutes", v.Dj, v.Duration))
+				continue
+			}
+			if v.Day < 0 || v.Day >= c.NbDaysForInput {
+				r.add(SeverityWarning, CheckBeyondInputDays, &s, fmt.Sprintf("day %d of %v is outside the %d days of nbDaysForInput, it can't be edited from the bot", v.Day, v.Dj, c.NbDaysForInput))
+			}
+			roomSets = append(roomSets, s)
+		}
+		sort.SliceStable(roomSets, func(i, j int) bool { return roomSets[i].start.Before(roomSets[j].start) })
+
+		// like LineUp.AddSet, a set without duration lasts until the next one of the room
+		for i := range roomSets {
+			if roomSets[i].end != roomSets[i].start {
+				continue
+			}
+			if i+1 < len(roomSets) && roomSets[i+1].start.After(roomSets[i].start) {
+				roomSets[i].end = roomSets[i+1].start
+			} else {
+				r.add(SeverityError, CheckEmptyDuration, &roomSets[i], fmt.Sprintf("%v has no duration and no next set in the room, the lineup would panic", roomSets[i].dj))
+			}
+		}
+
+		for i := 1; i < len(roomSets); i++ {
+			s := roomSets[i]
+			// compare with the set ending last, a long set can cover several short ones
+			prev := roomSets[0]
+			for _, v := range roomSets[1:i] {
+				if v.end.After(prev.end) {
+					prev = v
+				}
+			}
+			if s.start.Before(prev.end) {
+				r.add(SeverityError, CheckOverlap, &s, fmt.Sprintf("%v (%v-%v) overlaps %v (%v-%v), one of them would be dropped",
+					s.dj, s.start.Format("15:04"), s.end.Format("15:04"), prev.dj, prev.start.Format("15:04"), prev.end.Format("15:04")))
+			} else if s.start.After(prev.end) && s.start.Sub(prev.end) < maxGap {
+				r.add(SeverityWarning, CheckGap, &s, fmt.Sprintf("gap from %v to %v (%v -> %v)",
+					prev.end.Format("Mon 15:04"), s.start.Format("Mon 15:04"), prev.dj, s.dj))
+			}
+		}
+		all = append(all, roomSets...)
+	}
+
+	// a dj can't play in two rooms at the same time
+	for i := 0; i < len(all); i++ {
+		for j := i + 1; j < len(all); j++ {
+			a, b := all[i], all[j]
+			if a.room == b.room || !strings.EqualFold(strings.TrimSpace(a.dj), strings.TrimSpace(b.dj)) || strings.TrimSpace(a.dj) == lineUp.UnknownDJ {
+				continue
+			}
+			if a.start.Before(b.end) && b.start.Before(a.end) {
+				r.add(SeverityError, CheckDuplicateDj, &b, fmt.Sprintf("%v also plays in %v at %v", b.dj, a.room, a.start.Format("Mon 15:04")))
+			}
+		}
+	}
+	return r
+}
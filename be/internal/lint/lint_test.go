@@ -0,0 +1,67 @@
+package lint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shallowBunny/app/be/internal/infrastructure/config"
+)
+
+func checks(r Report, severity Severity) map[string]int {
+	res := make(map[string]int)
+	for _, v := range r.Issues {
+		if v.Severity == severity {
+			res[v.Check]++
+		}
+	}
+	return res
+}
+
+func TestCheck(t *testing.T) {
+	c := &config.Config{
+		NbDaysForInput: 2,
+		Lineup: config.Lineup{
+			BeginningSchedule: time.Date(2024, 8, 16, 0, 0, 0, 0, time.UTC),
+			Rooms:             []string{"A", "B", "C"},
+			Sets: map[string][]config.Set{
+				"A": {
+					{Day: 0, Hour: 22, Duration: 0, Dj: "a1"}, // lasts until a2
+					{Day: 0, Hour: 23, Duration: 120, Dj: "a2"},
+					{Day: 1, Hour: 0, Duration: 60, Dj: "a3"},  // overlaps a2
+					{Day: 1, Hour: 2, Duration: 60, Dj: "a4"},  // 1h gap
+					{Day: 2, Hour: 22, Duration: 60, Dj: "a5"}, // beyond input days, long gap ignored
+				},
+				"B": {
+					{Day: 0, Hour: 23, Duration: 60, Dj: "A2 "}, // same dj as in A
+					{Day: 1, Hour: 0, Duration: 0, Dj: "b2"},    // no duration and last set
+				},
+			},
+		},
+		UnknownRoomSets: map[string][]config.Set{
+			"d": {{Day: 0, Hour: 22, Duration: 60, Dj: "d1"}},
+		},
+	}
+	r := Check("test.yml", c)
+	if !r.HasErrors() {
+		t.Fatalf("expected errors, got %v", r)
+	}
+	errors := checks(r, SeverityError)
+	for check, n := range map[string]int{CheckOverlap: 1, CheckDuplicateDj: 1, CheckEmptyDuration: 1, CheckUnknownRoom: 1} {
+		if errors[check] != n {
+			t.Errorf("expected %d %v error(s), got %v", n, check, r)
+		}
+	}
+	warnings := checks(r, SeverityWarning)
+	for check, n := range map[string]int{CheckGap: 1, CheckBeyondInputDays: 1, CheckEmptyRoom: 1} {
+		if warnings[check] != n {
+			t.Errorf("expected %d %v warning(s), got %v", n, check, r)
+		}
+	}
+
+	delete(c.Lineup.Sets, "B")
+	c.Lineup.Sets["A"] = c.Lineup.Sets["A"][:2]
+	c.UnknownRoomSets = nil
+	if r := Check("test.yml", c); r.HasErrors() {
+		t.Errorf("expected no errors, got %v", r)
+	}
+}
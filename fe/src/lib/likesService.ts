@@ -21,19 +21,32 @@ export const parseAndMigrateLikedDJs = (parsedLikedDJs: Like[]): Like[] => {
 
 /**
  * Posts updated liked DJs to the server and handles token management.
+ * The server merges them with the likes of the other devices using the token.
  *
  * @param updatedLikedDJs - Array of updated Like objects
+ * @param removedLikedDJs - Likes unliked since the last post
+ * @param festival - Prefix of the festival, the default one when undefined
  * @returns Parsed and migrated liked DJs from the server
  * @throws Error if the network request fails
  */
 export const postUpdatedLikes = async (
-	updatedLikedDJs: Like[]
+	updatedLikedDJs: Like[],
+	removedLikedDJs: Like[] = [],
+	festival?: string
 ): Promise<Like[]> => {
 	let token = localStorage.getItem("token") || "";
-	const likesResponse = { token, likes: updatedLikedDJs };
+	const likesResponse = {
+		token,
+		likes: updatedLikedDJs,
+		removed: removedLikedDJs,
+	};
+
+	const likesURL = getApiURL(
+		festival ? `api/lineup/${festival}/likes` : "api/likes"
+	);
 
 	try {
-		const response = await fetch(getApiURL("api/likes"), {
+		const response = await fetch(likesURL, {
 			method: "POST",
 			headers: {
 				"Content-Type": "application/json",
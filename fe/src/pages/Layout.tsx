@@ -127,9 +127,16 @@ const Layout: React.FC<LayoutProps> = ({ festival, stage }) => {
 	// Add likedDJs state
 	const [likedDJs, setLikedDJs] = useState<Like[]>([]);
 
-	const updateLikesWithServer = async (updatedLikedDJs: Like[]) => {
+	const updateLikesWithServer = async (
+		updatedLikedDJs: Like[],
+		removedLikedDJs: Like[] = []
+	) => {
 		try {
-			const likes = await postUpdatedLikes(updatedLikedDJs);
+			const likes = await postUpdatedLikes(
+				updatedLikedDJs,
+				removedLikedDJs,
+				festival
+			);
 			setLikedDJs(likes);
 		} catch (error) {
 			// Handle errors
@@ -145,17 +152,28 @@ const Layout: React.FC<LayoutProps> = ({ festival, stage }) => {
 		const updatedLikedDJs = updateFn(likedDJs);
 
 		console.log("handleLikedDJsChange");
+		// the server keeps the likes of the other devices, it must be told what was unliked
+		const sameLike = (a: Like, b: Like) =>
+			a.dj === b.dj &&
+			a.room === b.room &&
+			new Date(a.started).getTime() === new Date(b.started).getTime();
+		const removedLikedDJs = likedDJs.filter(
+			(like) => !updatedLikedDJs.some((updated) => sameLike(like, updated))
+		);
+
 		// Update the state with the updated liked DJs
 		setLikedDJs(updatedLikedDJs);
-		updateLikesWithServer(updatedLikedDJs);
+		updateLikesWithServer(updatedLikedDJs, removedLikedDJs);
 	};
 
-	// Save likedDJs to localStorage whenever likedDJs changes
+	// Save likedDJs to localStorage whenever likedDJs changes, an empty list too so an
+	// unliked DJ doesn't come back on the next start
+	const [likedDJsLoaded, setLikedDJsLoaded] = useState<boolean>(false);
 	useEffect(() => {
-		if (Object.keys(likedDJs).length > 0) {
+		if (likedDJsLoaded) {
 			localStorage.setItem("likedDJs", JSON.stringify(likedDJs));
 		}
-	}, [likedDJs]);
+	}, [likedDJs, likedDJsLoaded]);
 
 	useEffect(() => {
 		const checkRunningAsWPA = () => {
@@ -177,6 +195,7 @@ const Layout: React.FC<LayoutProps> = ({ festival, stage }) => {
 					console.error("Failed to parse likedDJs from localStorage:", e);
 				}
 			}
+			setLikedDJsLoaded(true);
 			// force standalone to true if not running on mobile
 			const userAgent =
 				navigator.userAgent || navigator.vendor || (window as any).opera;